@@ -0,0 +1,144 @@
+package builder
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm-logged/common"
+)
+
+// alertFingerprints limits count of example fingerprints in FailureSummary
+const alertFingerprints = 5
+
+// FailureSummary describes burst of failures reported by WithFailureAlert
+type FailureSummary struct {
+	// Count is count of failures in Window
+	Count  int
+	Window time.Duration
+	// First and Last are times of the first and the last failure of the burst
+	First time.Time
+	Last  time.Time
+	// ByKind counts failures by message of common error, as example "internal server error"
+	ByKind map[string]int
+	// ByTable counts failures by table, failures of chains without model are counted under empty name
+	ByTable map[string]int
+	// Fingerprints are examples of fingerprints of failures, the most frequent first
+	Fingerprints []string
+}
+
+// alertedFailure is failure remembered by failureDetector
+type alertedFailure struct {
+	at          time.Time
+	kind        string
+	table       string
+	fingerprint string
+}
+
+// failureDetector notifies when n failures happen within window, at most once per window.
+// Failures are kept in ring buffer of size n, which is cleared after window without failures
+type failureDetector struct {
+	n      int
+	window time.Duration
+	notify func(FailureSummary)
+
+	mu       sync.Mutex
+	ring     []alertedFailure
+	next     int
+	notified time.Time
+}
+
+// add remembers failure and returns summary of burst if notification is due
+func (d *failureDetector) add(f alertedFailure) (FailureSummary, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.ring) > 0 {
+		last := d.ring[(d.next+len(d.ring)-1)%len(d.ring)]
+		if f.at.Sub(last.at) > d.window {
+			// healthy period, the next burst is notified right away
+			d.ring = d.ring[:0]
+			d.next = 0
+			d.notified = time.Time{}
+		}
+	}
+	if len(d.ring) < d.n {
+		d.ring = append(d.ring, f)
+	} else {
+		d.ring[d.next] = f
+		d.next = (d.next + 1) % d.n
+	}
+
+	if len(d.ring) < d.n {
+		return FailureSummary{}, false
+	}
+	oldest := d.ring[d.next%len(d.ring)]
+	if f.at.Sub(oldest.at) > d.window || (!d.notified.IsZero() && f.at.Sub(d.notified) < d.window) {
+		return FailureSummary{}, false
+	}
+	d.notified = f.at
+	return d.summary(f.at), true
+}
+
+// summary summarizes failures of the last window
+func (d *failureDetector) summary(now time.Time) FailureSummary {
+	s := FailureSummary{Window: d.window, ByKind: map[string]int{}, ByTable: map[string]int{}}
+	fingerprints := map[string]int{}
+	for _, f := range d.ring {
+		if now.Sub(f.at) > d.window {
+			continue
+		}
+		if s.First.IsZero() || f.at.Before(s.First) {
+			s.First = f.at
+		}
+		if f.at.After(s.Last) {
+			s.Last = f.at
+		}
+		s.Count++
+		s.ByKind[f.kind]++
+		s.ByTable[f.table]++
+		fingerprints[f.fingerprint]++
+	}
+	for fingerprint := range fingerprints {
+		s.Fingerprints = append(s.Fingerprints, fingerprint)
+	}
+	sort.Slice(s.Fingerprints, func(i, j int) bool {
+		a, b := s.Fingerprints[i], s.Fingerprints[j]
+		return fingerprints[a] > fingerprints[b] || fingerprints[a] == fingerprints[b] && a < b
+	})
+	if len(s.Fingerprints) > alertFingerprints {
+		s.Fingerprints = s.Fingerprints[:alertFingerprints]
+	}
+	return s
+}
+
+// alertFailure counts failure by detector of WithFailureAlert, failures caused by data aren't counted.
+// Notification is sent in background, so failing finisher isn't blocked
+func (m *Model) alertFailure(err error, table, fingerprint string) {
+	d := m.cfg.failureAlert
+	if d == nil || err == nil {
+		return
+	}
+	kind := classifyError(err).common
+	if isDataError(kind) {
+		return
+	}
+	summary, ok := d.add(alertedFailure{at: time.Now(), kind: kind.Error(), table: table, fingerprint: fingerprint})
+	if ok {
+		go m.runHook("failureAlert", func() { d.notify(summary) })
+	}
+}
+
+// isDataError reports whether common error is caused by data or request of user rather than by database
+func isDataError(err error) bool {
+	for _, target := range []error{
+		common.ErrDuplicate, common.ErrForeignKey, common.ErrNotNull, common.ErrCheckViolation,
+		common.ErrBadSort, common.ErrBadField, common.ErrCanceled,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
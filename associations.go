@@ -0,0 +1,43 @@
+package builder
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WithAssociations makes Save of chain upsert populated associations of value, as gorm does by default
+func (m *Model) WithAssociations() *Model {
+	trace := m.logTrace.with("withAssociations", true)
+	c := m.chain(m.db, trace)
+	c.withAssociations = true
+	return c
+}
+
+// warnSkippedAssociations logs populated associations of value, which Save doesn't save
+func (m *Model) warnSkippedAssociations(value interface{}) {
+	s, err := m.parseSchema(value)
+	if err != nil {
+		return
+	}
+	v := reflect.Indirect(reflect.ValueOf(value))
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	var skipped []string
+	for name, rel := range s.Relationships.Relations {
+		if _, zero := rel.Field.ValueOf(context.Background(), v); !zero {
+			skipped = append(skipped, name)
+		}
+	}
+	if len(skipped) == 0 {
+		return
+	}
+	sort.Strings(skipped)
+	m.logWarn("save skips populated associations, use WithAssociations to save them", nil, logrus.Fields{
+		"skippedAssociations": skipped,
+		"trace":               m.frames(),
+	})
+}
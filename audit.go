@@ -0,0 +1,171 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// auditCallback is name of gorm callback which records mutations into audit table
+const auditCallback = "gorm-logged:audit"
+
+// auditConfig is configuration of audit log, see WithAudit
+type auditConfig struct {
+	table string
+	actor func(ctx context.Context) string
+}
+
+// AuditRecord is row of audit table, see WithAudit and MigrateAudit
+type AuditRecord struct {
+	ID uint64 `gorm:"primaryKey"`
+	// Operation is "create", "update", "delete" or "upsert"
+	Operation string `gorm:"size:16;not null"`
+	// Table is table of mutated rows
+	Table string `gorm:"column:target_table;size:255;not null;index"`
+	// PrimaryKeys is json array of primary keys of mutated rows, empty array for mutations by filter
+	PrimaryKeys string `gorm:"not null"`
+	// Changes is json of changed columns for updates and of rows passed to creates, upserts and deletes.
+	// Rows of deletes aren't loaded, so deletes by filter record only the value passed to Delete.
+	// Fields hidden from logs by WithRedactedFields or `log:"-"` are recorded as "[REDACTED]" or zero values
+	Changes string `gorm:"not null"`
+	// Actor is taken from context of chain by function passed to WithAudit
+	Actor     string    `gorm:"size:255;index"`
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// MigrateAudit creates or alters audit table configured by WithAudit
+func (m *Model) MigrateAudit() error {
+	if m.cfg.audit == nil {
+		m.logError("queryBuilder.MigrateAudit called without WithAudit option", nil,
+			logrus.Fields{"trace": m.frames()})
+		return common.ErrInternal
+	}
+	if err := m.db.Table(m.cfg.audit.table).Migrator().AutoMigrate(&AuditRecord{}); err != nil {
+		return m.fail("migrateAudit", "can't migrate audit table", err, logrus.Fields{
+			"auditTable": m.cfg.audit.table,
+			"trace":      m.frames(),
+		})
+	}
+	return nil
+}
+
+// audit returns callback which records mutation of operation into audit table inside transaction of the mutation.
+// Failed recording fails the mutation, so gorm rollbacks its transaction
+func audit(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		q, ok := db.Statement.Context.Value(queryKey{}).(*tracedQuery)
+		if !ok || q.m.cfg.audit == nil || db.Error != nil || db.DryRun || db.RowsAffected == 0 {
+			return
+		}
+		if err := q.m.writeAudit(db, db.Statement, operation); err != nil {
+			_ = db.AddError(err)
+		}
+	}
+}
+
+// writeAudit records mutation of operation built by stmt into audit table by connection of conn,
+// mutations of audit table itself aren't recorded
+func (m *Model) writeAudit(conn *gorm.DB, stmt *gorm.Statement, operation string) error {
+	if stmt.Table == m.cfg.audit.table {
+		return nil
+	}
+	record, err := auditRecord(stmt, operation, m.updateDiff, m.cfg.redactedFields)
+	if err != nil {
+		return fmt.Errorf("can't build audit record: %w", err)
+	}
+	if m.cfg.audit.actor != nil {
+		record.Actor = m.cfg.audit.actor(stmt.Context)
+	}
+	tx := conn.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	if err := tx.Table(m.cfg.audit.table).Create(record).Error; err != nil {
+		return fmt.Errorf("can't write audit record: %w", err)
+	}
+	return nil
+}
+
+// auditRecord builds audit record of mutation from its statement, diff of UpdatesDiff is recorded as changes of update.
+// Values of fields hidden from logs are redacted as in logs
+func auditRecord(stmt *gorm.Statement, operation string, diff Diff, denylist map[string]struct{}) (*AuditRecord, error) {
+	keys := primaryKeys(stmt)
+	var changes interface{}
+	if diff != nil && operation == "update" {
+		redacted := make(Diff, len(diff))
+		for name, change := range diff {
+			if isRedactedColumn(stmt, name, denylist) {
+				change = FieldChange{Old: redactedValue, New: redactedValue}
+			}
+			redacted[name] = change
+		}
+		changes = redacted
+	} else if set, ok := stmt.Clauses["SET"].Expression.(clause.Set); ok && operation == "update" {
+		columns := make(map[string]interface{}, len(set))
+		for _, assignment := range set {
+			columns[assignment.Column.Name] = assignment.Value
+			if isRedactedColumn(stmt, assignment.Column.Name, denylist) {
+				columns[assignment.Column.Name] = redactedValue
+			}
+		}
+		changes = columns
+	} else if stmt.ReflectValue.IsValid() {
+		changes = redact(stmt.ReflectValue.Interface(), denylist)
+	}
+
+	keysJSON, err := json.Marshal(keys)
+	if err != nil {
+		return nil, err
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditRecord{
+		Operation:   operation,
+		Table:       stmt.Table,
+		PrimaryKeys: string(keysJSON),
+		Changes:     string(changesJSON),
+		CreatedAt:   stmt.DB.NowFunc(),
+	}, nil
+}
+
+// isRedactedColumn reports whether column or field of statement is hidden from logs, see redact
+func isRedactedColumn(stmt *gorm.Statement, name string, denylist map[string]struct{}) bool {
+	if isDenied(name, denylist) {
+		return true
+	}
+	if stmt.Schema == nil {
+		return false
+	}
+	field := stmt.Schema.LookUpField(name)
+	return field != nil && isRedacted(field.StructField, denylist)
+}
+
+// primaryKeys collects non zero primary keys of struct or slice of structs of statement
+func primaryKeys(stmt *gorm.Statement) []interface{} {
+	keys := []interface{}{}
+	if stmt.Schema == nil || stmt.Schema.PrioritizedPrimaryField == nil || !stmt.ReflectValue.IsValid() {
+		return keys
+	}
+	field := stmt.Schema.PrioritizedPrimaryField
+	collect := func(rv reflect.Value) {
+		if value, zero := field.ValueOf(stmt.Context, rv); !zero {
+			keys = append(keys, value)
+		}
+	}
+	switch rv := reflect.Indirect(stmt.ReflectValue); rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			collect(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		collect(rv)
+	}
+	return keys
+}
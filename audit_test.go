@@ -0,0 +1,76 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+// auditRecords returns records of audit table of model
+func auditRecords(t *testing.T, m *Model) []AuditRecord {
+	t.Helper()
+	var records []AuditRecord
+	if err := m.db.Table("audit_records").Order("id").Find(&records).Error; err != nil {
+		t.Fatalf("can't read audit records: %v", err)
+	}
+	return records
+}
+
+func newAuditedModel(t *testing.T) *Model {
+	t.Helper()
+	m := newTestModel(t, []Option{WithAudit("audit_records", nil), WithRedactedFields("password")}, &redactedUser{})
+	if err := m.MigrateAudit(); err != nil {
+		t.Fatalf("can't migrate audit: %v", err)
+	}
+	return m
+}
+
+func TestAuditIsRedacted(t *testing.T) {
+	m := newAuditedModel(t)
+	user := &redactedUser{Name: "a", Password: "password-value", Token: "token-value"}
+	if err := m.Create(user); err != nil {
+		t.Fatalf("can't create user: %v", err)
+	}
+	if err := m.Model(user).Updates(map[string]interface{}{"password": "new-password", "token": "new-token", "name": "b"}); err != nil {
+		t.Fatalf("can't update user: %v", err)
+	}
+	if _, err := m.UpdatesDiff(user, &redactedUser{Password: "diff-password", Name: "c"}); err != nil {
+		t.Fatalf("can't update user: %v", err)
+	}
+	if err := m.Delete(user); err != nil {
+		t.Fatalf("can't delete user: %v", err)
+	}
+
+	records := auditRecords(t, m)
+	if len(records) != 4 {
+		t.Fatalf("expected 4 audit records, got %+v", records)
+	}
+	for _, record := range records {
+		for _, secret := range []string{"password-value", "token-value", "new-password", "new-token", "diff-password"} {
+			if strings.Contains(record.Changes, secret) {
+				t.Errorf("%s of %s is recorded: %s", secret, record.Operation, record.Changes)
+			}
+		}
+	}
+	for i, kept := range []string{`"a"`, `"b"`, `"c"`} {
+		if !strings.Contains(records[i].Changes, kept) || !strings.Contains(records[i].Changes, redactedValue) {
+			t.Errorf("unexpected changes of %s: %s", records[i].Operation, records[i].Changes)
+		}
+	}
+}
+
+func TestAuditOfDeleteRecordsPassedValue(t *testing.T) {
+	m := newAuditedModel(t)
+	if err := m.Create(&redactedUser{Name: "a"}); err != nil {
+		t.Fatalf("can't create user: %v", err)
+	}
+	if err := m.Where("name = ?", "a").Delete(&redactedUser{}); err != nil {
+		t.Fatalf("can't delete user: %v", err)
+	}
+	records := auditRecords(t, m)
+	if len(records) != 2 || records[1].Operation != "delete" || records[1].PrimaryKeys != "[]" {
+		t.Fatalf("unexpected audit records %+v", records)
+	}
+	if strings.Contains(records[1].Changes, `"a"`) {
+		t.Errorf("deleted row is recorded: %s", records[1].Changes)
+	}
+}
@@ -0,0 +1,94 @@
+package builder
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// explainTimeout limits EXPLAIN of slow query
+const explainTimeout = 5 * time.Second
+
+var (
+	// sqlLiteral matches string and numeric literals of sql, which are replaced by normalizeSQL
+	sqlLiteral = regexp.MustCompile(`'(?:[^']|'')*'|\b\d+(?:\.\d+)?\b`)
+	// sqlLists matches lists of placeholders like (?, ?, ?)
+	sqlLists = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+	// sqlSpaces matches sequences of whitespace
+	sqlSpaces = regexp.MustCompile(`\s+`)
+)
+
+// autoExplainer explains queries slower than threshold, every normalized statement at most once per interval
+type autoExplainer struct {
+	threshold time.Duration
+	interval  time.Duration
+
+	mu        sync.Mutex
+	explained map[string]time.Time
+}
+
+// allow reports whether statement may be explained now and remembers the time of explaining
+func (e *autoExplainer) allow(statement string, now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	key := normalizeSQL(statement)
+	if last, ok := e.explained[key]; ok && now.Sub(last) < e.interval {
+		return false
+	}
+	if e.explained == nil {
+		e.explained = make(map[string]time.Time)
+	}
+	for k, last := range e.explained {
+		if now.Sub(last) >= e.interval {
+			delete(e.explained, k)
+		}
+	}
+	e.explained[key] = now
+	return true
+}
+
+// normalizeSQL replaces literals of statement by placeholders, so statements differing by values are equal
+func normalizeSQL(statement string) string {
+	statement = sqlLiteral.ReplaceAllString(statement, "?")
+	statement = sqlLists.ReplaceAllString(statement, "(?)")
+	return strings.TrimSpace(sqlSpaces.ReplaceAllString(statement, " "))
+}
+
+// explain returns plan of statement by EXPLAIN without ANALYZE, so statement itself is never executed
+func (m *Model) explain(ctx context.Context, statement string) (string, error) {
+	prefix := "EXPLAIN "
+	if m.dialect() == dialectSQLite {
+		prefix = "EXPLAIN QUERY PLAN "
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), explainTimeout)
+	defer cancel()
+	rows, err := m.db.Statement.ConnPool.QueryContext(ctx, prefix+statement)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	values := make([]sql.NullString, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	var lines []string
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return "", err
+		}
+		cells := make([]string, 0, len(values))
+		for _, v := range values {
+			cells = append(cells, v.String)
+		}
+		lines = append(lines, strings.Join(cells, " | "))
+	}
+	return strings.Join(lines, "\n"), rows.Err()
+}
@@ -0,0 +1,133 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// batchWindow is time, during which BatchedFirst lookups are collected into single query
+const batchWindow = 2 * time.Millisecond
+
+// batcherKey is context key of batcher
+type batcherKey struct{}
+
+// batcher collects lookups of BatchedFirst by type of destination and trace of chain
+type batcher struct {
+	mu      sync.Mutex
+	pending map[string]*lookupBatch
+}
+
+// lookupBatch is set of ids looked up by the same chain, which are selected by single query
+type lookupBatch struct {
+	m    *Model
+	ctx  context.Context
+	typ  reflect.Type
+	ids  []interface{}
+	done chan struct{}
+	// rows are found records by primary key, err is error of query, both are set before done is closed
+	rows map[string]reflect.Value
+	err  error
+}
+
+// WithBatching returns context, which makes BatchedFirst lookups of the same chain arriving together
+// be selected by single query, as example lookups of goroutines serving single request
+func WithBatching(ctx context.Context) context.Context {
+	return context.WithValue(ctx, batcherKey{}, &batcher{pending: make(map[string]*lookupBatch)})
+}
+
+// BatchedFirst is gorm extension. Finds record by primary key id into out as First does, but lookups of the same
+// chain with context of WithBatching are collected during short window and selected by single IN query.
+// Missing records fail with not found error individually. Works as First without WithBatching
+func (m *Model) BatchedFirst(ctx context.Context, out interface{}, id interface{}) error {
+	b, ok := ctx.Value(batcherKey{}).(*batcher)
+	if !ok {
+		return m.WithContext(ctx).First(out, id)
+	}
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		m.logError("queryBuilder.BatchedFirst called with out which is not a pointer to struct", nil, logrus.Fields{
+			"typeOfOut": fmt.Sprintf("%T", out),
+			"trace":     m.frames(),
+		})
+		return common.ErrInternal
+	}
+
+	batch := b.join(m, ctx, v.Elem().Type(), id)
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		return m.fail("batchedFirst", "lookup is canceled", ctx.Err(), logrus.Fields{"trace": m.frames()})
+	}
+	if batch.err != nil {
+		return batch.err
+	}
+	row, ok := batch.rows[fmt.Sprint(id)]
+	if !ok {
+		if m.rawErrorsEnabled() {
+			return gorm.ErrRecordNotFound
+		}
+		return &common.NotFoundError{Entity: batch.typ.Name()}
+	}
+	v.Elem().Set(row)
+	return nil
+}
+
+// join adds id to pending batch of chain, new batch is flushed after batchWindow
+func (b *batcher) join(m *Model, ctx context.Context, typ reflect.Type, id interface{}) *lookupBatch {
+	key := typ.String() + "|" + fmt.Sprint(m.logTrace)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	batch, ok := b.pending[key]
+	if !ok {
+		// batch outlives cancellation of the caller, which started it, other callers still wait for it
+		batch = &lookupBatch{m: m, ctx: context.WithoutCancel(ctx), typ: typ, done: make(chan struct{})}
+		b.pending[key] = batch
+		time.AfterFunc(batchWindow, func() {
+			b.mu.Lock()
+			delete(b.pending, key)
+			b.mu.Unlock()
+			batch.load()
+		})
+	}
+	batch.ids = append(batch.ids, id)
+	return batch
+}
+
+// load selects records of batch and wakes up waiting callers
+func (batch *lookupBatch) load() {
+	defer close(batch.done)
+	m := batch.m.WithContext(batch.ctx)
+	s, err := m.parseSchema(reflect.New(batch.typ).Interface())
+	if err != nil {
+		batch.err = m.fail("batchedFirst", "can't parse schema of batched lookup", err, logrus.Fields{"trace": m.frames()})
+		return
+	}
+	if s.PrioritizedPrimaryField == nil {
+		batch.err = m.fail("batchedFirst", "can't batch lookup", fmt.Errorf("%s has no primary key", s.Name),
+			logrus.Fields{"trace": m.frames()})
+		return
+	}
+	pk := s.PrioritizedPrimaryField
+
+	found := reflect.New(reflect.SliceOf(batch.typ))
+	column := clause.Column{Table: clause.CurrentTable, Name: pk.DBName}
+	m = m.chain(m.db.Where(clause.IN{Column: column, Values: batch.ids}), m.logTrace.with("batchedIDs", len(batch.ids)))
+	if batch.err = m.Unlimited().Find(found.Interface()); batch.err != nil {
+		return
+	}
+	batch.rows = make(map[string]reflect.Value, found.Elem().Len())
+	for i := 0; i < found.Elem().Len(); i++ {
+		row := found.Elem().Index(i)
+		key, _ := pk.ValueOf(context.Background(), row)
+		batch.rows[fmt.Sprint(key)] = row
+	}
+}
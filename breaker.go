@@ -0,0 +1,162 @@
+package builder
+
+import (
+	"sync"
+	"time"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// breakerCallback is name of gorm callback which records results of queries for circuit breaker,
+// also marks queries let through by breaker
+const breakerCallback = "gorm-logged:circuit_breaker"
+
+// states of circuit breaker reported by BreakerState
+const (
+	breakerDisabled = "disabled"
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// circuitBreaker counts consecutive connection failures of queries, see WithCircuitBreaker
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	// probing is set while the only query allowed in half-open state runs
+	probing bool
+}
+
+// allow reports whether query may run, moves open breaker to half-open state after cooldown.
+// Returns new state on transition, empty string otherwise
+func (b *circuitBreaker) allow(now time.Time) (allowed bool, transition string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false, ""
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true, breakerHalfOpen
+	case breakerHalfOpen:
+		if b.probing {
+			return false, ""
+		}
+		b.probing = true
+		return true, ""
+	}
+	return true, ""
+}
+
+// record counts result of query, only connection failures trip the breaker.
+// Returns new state on transition, empty string otherwise
+func (b *circuitBreaker) record(err error, now time.Time) (transition string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !isConnectionError(err) {
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.state = breakerClosed
+			return breakerClosed
+		}
+		return ""
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold) {
+		b.state = breakerOpen
+		b.openedAt = now
+		return breakerOpen
+	}
+	return ""
+}
+
+// current returns state of breaker
+func (b *circuitBreaker) current() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// BreakerState returns state of circuit breaker configured by WithCircuitBreaker: "closed", "open" or "half-open",
+// "disabled" when breaker isn't configured. Useful for health endpoints
+func (m *Model) BreakerState() string {
+	if m.cfg == nil || m.cfg.breaker == nil {
+		return breakerDisabled
+	}
+	return m.cfg.breaker.current()
+}
+
+// logBreakerTransition logs change of breaker state by chain of query
+func (m *Model) logBreakerTransition(state string, err error) {
+	if state == "" {
+		return
+	}
+	fields := logrus.Fields{
+		"breakerState":     state,
+		"breakerThreshold": m.cfg.breaker.threshold,
+		"breakerCooldown":  m.cfg.breaker.cooldown.String(),
+	}
+	if state == breakerClosed {
+		m.logWarn("circuit breaker closed, database is available again", nil, fields)
+		return
+	}
+	m.logWarn("circuit breaker state changed", err, fields)
+}
+
+// breakerBefore fails query fast with common.ErrUnavailable while circuit breaker of its chain is open.
+// Dry runs never reach database, so they aren't let through nor recorded by breaker
+func breakerBefore(db *gorm.DB, q *tracedQuery) {
+	if q.m.cfg.breaker == nil || db.Error != nil || db.DryRun {
+		return
+	}
+	if err := q.m.breakerAllow(); err != nil {
+		_ = db.AddError(err)
+		return
+	}
+	db.InstanceSet(breakerCallback, true)
+}
+
+// breakerAfter records result of query which was let through by circuit breaker of its chain
+func breakerAfter(db *gorm.DB) {
+	q, ok := db.Statement.Context.Value(queryKey{}).(*tracedQuery)
+	if !ok || q.m.cfg.breaker == nil {
+		return
+	}
+	if _, admitted := db.InstanceGet(breakerCallback); !admitted {
+		return
+	}
+	q.m.breakerRecord(db.Error)
+}
+
+// breakerAllow consults circuit breaker of chain before query executed outside of gorm callbacks,
+// returns common.ErrUnavailable while breaker is open. Result of allowed query is recorded by breakerRecord
+func (m *Model) breakerAllow() error {
+	if m.cfg.breaker == nil {
+		return nil
+	}
+	allowed, transition := m.cfg.breaker.allow(time.Now())
+	m.logBreakerTransition(transition, nil)
+	if !allowed {
+		return common.ErrUnavailable
+	}
+	return nil
+}
+
+// breakerRecord records result of query allowed by breakerAllow
+func (m *Model) breakerRecord(err error) {
+	if m.cfg.breaker == nil {
+		return
+	}
+	m.logBreakerTransition(m.cfg.breaker.record(err, time.Now()), err)
+}
@@ -0,0 +1,78 @@
+package builder
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/sirupsen/logrus"
+)
+
+// copyLinePattern extracts line number from context of failed COPY, like "COPY users, line 3, column id: ..."
+var copyLinePattern = regexp.MustCompile(`line (\d+)`)
+
+// CopyFrom bulk loads rows into table by postgres COPY protocol, returns count of written rows.
+// Much faster than Create for large amount of rows. Inside transaction copying is a part of it,
+// so failed copy is rolled back with the whole transaction
+func (m *Model) CopyFrom(table string, columns []string, rows [][]interface{}) (int64, error) {
+	if err := m.requireDialect("CopyFrom", dialectPostgres); err != nil {
+		return 0, err
+	}
+	var written int64
+	copyFrom := func(driverConn interface{}) error {
+		conn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("copy is supported by pgx driver only")
+		}
+		var err error
+		written, err = conn.Conn().CopyFrom(m.db.Statement.Context, pgx.Identifier(strings.Split(table, ".")), columns, pgx.CopyFromRows(rows))
+		return err
+	}
+
+	var err error
+	switch {
+	case m.tx == nil:
+		err = m.rawConn(copyFrom)
+	case m.tx.conn != nil:
+		err = m.tx.conn.Raw(copyFrom)
+	default:
+		err = errors.New("transaction is finished or has no dedicated connection")
+	}
+	if err != nil {
+		logFields := logrus.Fields{
+			"copyTable":   table,
+			"copyColumns": columns,
+			"copyRows":    len(rows),
+			"trace":       m.frames(),
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Where != "" {
+			logFields["copyErrorContext"] = pgErr.Where
+			if match := copyLinePattern.FindStringSubmatch(pgErr.Where); match != nil {
+				line, _ := strconv.Atoi(match[1])
+				logFields["copyFailedRowIndex"] = line - 1
+			}
+		}
+		m.tx.remember(err)
+		return 0, m.fail("copyFrom", "can't copy rows into database", err, logFields)
+	}
+	return written, nil
+}
+
+// rawConn takes connection from the pool and passes underlying driver connection to fc
+func (m *Model) rawConn(fc func(driverConn interface{}) error) error {
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(m.db.Statement.Context)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(fc)
+}
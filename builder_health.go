@@ -0,0 +1,105 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// healthTimeout limits health check of HealthHandler
+const healthTimeout = 2 * time.Second
+
+// HealthStatus describes state of database connection pool
+type HealthStatus struct {
+	OpenConnections int
+	Idle            int
+	InUse           int
+	// WaitDuration is total time blocked waiting for a new connection
+	WaitDuration time.Duration
+	// Latency is round trip time of "SELECT 1"
+	Latency time.Duration
+}
+
+// Ping verifies that database is reachable.
+// Returns original error instead of common.ErrInternal, so health handlers can report the cause
+func (m *Model) Ping(ctx context.Context) error {
+	sqlDB, err := m.db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		m.logWarn("database ping failed", err)
+		return fmt.Errorf("database ping failed: %w", err)
+	}
+	return nil
+}
+
+// HealthCheck measures round trip of "SELECT 1" and collects connection pool statistics.
+// Returns original error instead of common.ErrInternal, so health handlers can report the cause
+func (m *Model) HealthCheck(ctx context.Context) (HealthStatus, error) {
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		m.logWarn("database health check failed", err)
+		return HealthStatus{}, fmt.Errorf("database health check failed: %w", err)
+	}
+
+	start := time.Now()
+	var one int
+	err = sqlDB.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+	latency := time.Since(start)
+
+	stats := sqlDB.Stats()
+	status := HealthStatus{
+		OpenConnections: stats.OpenConnections,
+		Idle:            stats.Idle,
+		InUse:           stats.InUse,
+		WaitDuration:    stats.WaitDuration,
+		Latency:         latency,
+	}
+	if err != nil {
+		m.logWarn("database health check failed", err, logrus.Fields{
+			"latency":         latency.String(),
+			"openConnections": stats.OpenConnections,
+			"inUse":           stats.InUse,
+		})
+		return status, fmt.Errorf("database health check failed: %w", err)
+	}
+	return status, nil
+}
+
+// healthResponse is body of HealthHandler response
+type healthResponse struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	OpenConns int     `json:"open_conns"`
+	IdleConns int     `json:"idle_conns"`
+}
+
+// HealthHandler serves HealthCheck as json, 200 when database is healthy and 503 otherwise.
+// Failures are logged as warnings, cause of failure isn't written into response
+func (m *Model) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+		defer cancel()
+		status, err := m.HealthCheck(ctx)
+		res := healthResponse{
+			Status:    "ok",
+			LatencyMs: float64(status.Latency.Microseconds()) / 1000,
+			OpenConns: status.OpenConnections,
+			IdleConns: status.Idle,
+		}
+		code := http.StatusOK
+		if err != nil {
+			res.Status = "unavailable"
+			code = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(res)
+	})
+}
@@ -0,0 +1,95 @@
+package builder
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// serveHealth calls HealthHandler of model and decodes its response
+func serveHealth(t *testing.T, m *Model) (*httptest.ResponseRecorder, healthResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.HealthHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var res healthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatalf("can't decode response %q: %v", rec.Body.String(), err)
+	}
+	return rec, res
+}
+
+func TestHealthHandler(t *testing.T) {
+	m, hook := newLoggedModel(t, nil)
+	rec, res := serveHealth(t, m)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if res.Status != "ok" || res.OpenConns < 1 {
+		t.Errorf("unexpected response %+v", res)
+	}
+	for _, key := range []string{`"status"`, `"latency_ms"`, `"open_conns"`, `"idle_conns"`} {
+		if !strings.Contains(rec.Body.String(), key) {
+			t.Errorf("response doesn't contain %s: %s", key, rec.Body.String())
+		}
+	}
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("healthy check is logged: %v", hook.AllEntries())
+	}
+}
+
+func TestHealthHandlerClosedDatabase(t *testing.T) {
+	m, hook := newLoggedModel(t, nil)
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		t.Fatalf("can't get connection pool: %v", err)
+	}
+	sqlDB.Close()
+
+	rec, res := serveHealth(t, m)
+	if rec.Code != http.StatusServiceUnavailable || res.Status != "unavailable" {
+		t.Errorf("expected unavailable database, got %d %+v", rec.Code, res)
+	}
+	if len(entriesAt(hook, logrus.ErrorLevel)) != 0 {
+		t.Error("failed check is logged as error")
+	}
+	if len(entriesAt(hook, logrus.WarnLevel)) != 1 {
+		t.Errorf("failed check isn't logged as warning: %v", hook.AllEntries())
+	}
+}
+
+func TestHealthHandlerUnreachableDatabase(t *testing.T) {
+	dsn := "postgres://healthuser:topsecret@" + closedAddr(t) + "/healthdb?connect_timeout=1"
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("can't open postgres database: %v", err)
+	}
+	l, hook := test.NewNullLogger()
+	m := NewFromDB(db, WithLogger(l))
+
+	rec, res := serveHealth(t, &m)
+	if rec.Code != http.StatusServiceUnavailable || res.Status != "unavailable" {
+		t.Errorf("expected unavailable database, got %d %+v", rec.Code, res)
+	}
+	for _, secret := range []string{"healthuser", "topsecret", "healthdb", "127.0.0.1"} {
+		if strings.Contains(rec.Body.String(), secret) {
+			t.Errorf("response exposes %q: %s", secret, rec.Body.String())
+		}
+	}
+	if len(entriesAt(hook, logrus.ErrorLevel)) != 0 {
+		t.Error("failed check is logged as error")
+	}
+	if len(entriesAt(hook, logrus.WarnLevel)) != 1 {
+		t.Errorf("failed check isn't logged as warning: %v", hook.AllEntries())
+	}
+}
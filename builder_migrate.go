@@ -0,0 +1,193 @@
+package builder
+
+import (
+	"fmt"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// MigrationBuilder Interface for managing database schema
+type MigrationBuilder interface {
+	Migrate(models ...interface{}) error
+	HasTable(model interface{}) (bool, error)
+	DropTable(models ...interface{}) error
+	CreateIndex(model interface{}, name string) error
+	ColumnTypes(model interface{}) ([]ColumnInfo, error)
+	Indexes(model interface{}) ([]IndexInfo, error)
+	Diff(model interface{}) ([]string, error)
+	MigrateAudit() error
+}
+
+// ColumnInfo describes existing column of table
+type ColumnInfo struct {
+	Name       string
+	Type       string
+	Nullable   bool
+	Default    string
+	Unique     bool
+	PrimaryKey bool
+}
+
+// IndexInfo describes existing index of table
+type IndexInfo struct {
+	Name       string
+	Columns    []string
+	Unique     bool
+	PrimaryKey bool
+}
+
+// Migrate creates or alters tables of given models according to their declaration
+func (m *Model) Migrate(models ...interface{}) error {
+	tables := make([]string, 0, len(models))
+	for _, model := range models {
+		table, err := m.tableName(model)
+		if err == nil {
+			err = m.db.Migrator().AutoMigrate(model)
+		}
+		if err != nil {
+			return m.fail("migrate", "can't migrate model", err, logrus.Fields{
+				"migratedTables":     tables,
+				"migrateFailedModel": fmt.Sprintf("%T", model),
+				"migrateFailedTable": table,
+				"trace":              m.frames(),
+			})
+		}
+		tables = append(tables, table)
+	}
+	m.logDebug("models are migrated", nil, logrus.Fields{"migratedTables": tables})
+	return nil
+}
+
+// HasTable reports whether table of model exists
+func (m *Model) HasTable(model interface{}) (bool, error) {
+	if _, err := m.tableName(model); err != nil {
+		return false, m.fail("hasTable", "can't check table existence", err, logrus.Fields{
+			"hasTableModel": fmt.Sprintf("%T", model),
+			"trace":         m.frames(),
+		})
+	}
+	return m.db.Migrator().HasTable(model), nil
+}
+
+// DropTable drops tables of given models, requires WithAllowDestructive option
+func (m *Model) DropTable(models ...interface{}) error {
+	if !m.cfg.allowDestructive {
+		m.logError("queryBuilder.DropTable called without WithAllowDestructive option", nil,
+			logrus.Fields{"trace": m.frames()})
+		return common.ErrDestructiveNotAllowed
+	}
+	for _, model := range models {
+		if err := m.db.Migrator().DropTable(model); err != nil {
+			table, _ := m.tableName(model)
+			return m.fail("dropTable", "can't drop table", err, logrus.Fields{
+				"dropTableModel": fmt.Sprintf("%T", model),
+				"dropTableName":  table,
+				"trace":          m.frames(),
+			})
+		}
+	}
+	return nil
+}
+
+// CreateIndex creates index declared in model by its name
+func (m *Model) CreateIndex(model interface{}, name string) error {
+	if err := m.db.Migrator().CreateIndex(model, name); err != nil {
+		table, _ := m.tableName(model)
+		return m.fail("createIndex", "can't create index", err, logrus.Fields{
+			"createIndexModel": fmt.Sprintf("%T", model),
+			"createIndexTable": table,
+			"createIndexName":  name,
+			"trace":            m.frames(),
+		})
+	}
+	return nil
+}
+
+// tableName resolves table name of model according to naming strategy of database
+func (m *Model) tableName(model interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: m.db}
+	if err := stmt.Parse(model); err != nil {
+		return "", err
+	}
+	return stmt.Schema.Table, nil
+}
+
+// ColumnTypes returns columns which exist in table of model
+func (m *Model) ColumnTypes(model interface{}) ([]ColumnInfo, error) {
+	columnTypes, err := m.db.Migrator().ColumnTypes(model)
+	if err != nil {
+		return nil, m.fail("columnTypes", "can't get column types", err, logrus.Fields{
+			"columnTypesModel": fmt.Sprintf("%T", model),
+			"trace":            m.frames(),
+		})
+	}
+	res := make([]ColumnInfo, 0, len(columnTypes))
+	for _, columnType := range columnTypes {
+		info := ColumnInfo{Name: columnType.Name(), Type: columnType.DatabaseTypeName()}
+		if fullType, ok := columnType.ColumnType(); ok {
+			info.Type = fullType
+		}
+		info.Nullable, _ = columnType.Nullable()
+		info.Default, _ = columnType.DefaultValue()
+		info.Unique, _ = columnType.Unique()
+		info.PrimaryKey, _ = columnType.PrimaryKey()
+		res = append(res, info)
+	}
+	return res, nil
+}
+
+// Indexes returns indexes which exist in table of model
+func (m *Model) Indexes(model interface{}) ([]IndexInfo, error) {
+	indexes, err := m.db.Migrator().GetIndexes(model)
+	if err != nil {
+		return nil, m.fail("indexes", "can't get indexes", err, logrus.Fields{
+			"indexesModel": fmt.Sprintf("%T", model),
+			"trace":        m.frames(),
+		})
+	}
+	res := make([]IndexInfo, 0, len(indexes))
+	for _, index := range indexes {
+		info := IndexInfo{Name: index.Name(), Columns: index.Columns()}
+		info.Unique, _ = index.Unique()
+		info.PrimaryKey, _ = index.PrimaryKey()
+		res = append(res, info)
+	}
+	return res, nil
+}
+
+// Diff compares declaration of model with its table.
+// Returns human readable list of struct fields without column and columns without struct field
+func (m *Model) Diff(model interface{}) ([]string, error) {
+	stmt := &gorm.Statement{DB: m.db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, m.fail("diff", "can't parse model for diff", err, logrus.Fields{
+			"diffModel": fmt.Sprintf("%T", model),
+			"trace":     m.frames(),
+		})
+	}
+	columns, err := m.ColumnTypes(model)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		existing[column.Name] = true
+	}
+	var diff []string
+	for _, dbName := range stmt.Schema.DBNames {
+		if !existing[dbName] {
+			diff = append(diff, fmt.Sprintf("field %s.%s has no column %q", stmt.Schema.Name, stmt.Schema.FieldsByDBName[dbName].Name, dbName))
+		}
+		delete(existing, dbName)
+	}
+	for _, column := range columns {
+		if existing[column.Name] {
+			diff = append(diff, fmt.Sprintf("column %q of table %q has no field in %s", column.Name, stmt.Schema.Table, stmt.Schema.Name))
+		}
+	}
+	return diff, nil
+}
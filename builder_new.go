@@ -0,0 +1,273 @@
+package builder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+	"gorm.io/plugin/dbresolver"
+)
+
+// New connects to postgres database by connURL
+func New(connURL string, opts ...Option) (Model, error) {
+	return NewWithContext(context.Background(), connURL, opts...)
+}
+
+// NewWithContext works as New, cancelling of ctx aborts connection retries configured by WithConnectRetry
+func NewWithContext(ctx context.Context, connURL string, opts ...Option) (Model, error) {
+	cfg := newConfig(opts)
+	db, err := cfg.open(ctx, cfg.dialector(dialectPostgres, connURL))
+	if err != nil {
+		return Model{}, fmt.Errorf("can't connect to database at %s: %w", dsnHost(connURL), err)
+	}
+	if err := cfg.setup(db); err != nil {
+		return Model{}, err
+	}
+	return Model{db: db, cfg: cfg}, nil
+}
+
+// NewMySQL connects to mysql database by dsn
+func NewMySQL(dsn string, opts ...Option) (Model, error) {
+	cfg := newConfig(opts)
+	db, err := cfg.open(context.Background(), mysql.Open(dsn))
+	if err != nil {
+		return Model{}, fmt.Errorf("can't connect to mysql database: %w", err)
+	}
+	if err := cfg.setup(db); err != nil {
+		return Model{}, err
+	}
+	return Model{db: db, cfg: cfg}, nil
+}
+
+// NewWithDialector connects to database by gorm dialector, as example of dialect without own constructor.
+// Options are applied as by New, see package sqlitedb for sqlite
+func NewWithDialector(dialector gorm.Dialector, opts ...Option) (Model, error) {
+	cfg := newConfig(opts)
+	db, err := cfg.open(context.Background(), dialector)
+	if err != nil {
+		return Model{}, fmt.Errorf("can't connect to %s database: %w", dialector.Name(), err)
+	}
+	if err := cfg.setup(db); err != nil {
+		return Model{}, err
+	}
+	return Model{db: db, cfg: cfg}, nil
+}
+
+// NewFromDB wraps already configured gorm instance, dialing, logger and connection level configuration
+// like replicas are left to the caller
+func NewFromDB(db *gorm.DB, opts ...Option) Model {
+	if db == nil {
+		panic("builder.NewFromDB called with nil db")
+	}
+	if err := registerCallbacks(db); err != nil {
+		panic(fmt.Sprintf("builder.NewFromDB can't register callbacks: %v", err))
+	}
+	return Model{db: db, cfg: newConfig(opts)}
+}
+
+// NewFromSQLDB builds model over existing connection pool, so the pool can be shared with other libraries.
+// Dialect is chosen by driver of the pool, pgx and mysql drivers are supported.
+// The pool is owned by the caller, so options of connection pool like WithMaxOpenConns are ignored.
+// WithSimpleProtocol makes every query request simple protocol, since configuration of pgx pool can't be changed
+func NewFromSQLDB(sqlDB *sql.DB, opts ...Option) (Model, error) {
+	if sqlDB == nil {
+		return Model{}, fmt.Errorf("builder.NewFromSQLDB called with nil sqlDB")
+	}
+	cfg := newConfig(opts)
+	dialector, err := cfg.poolDialector(sqlDB)
+	if err != nil {
+		return Model{}, err
+	}
+	if len(cfg.pool) > 0 {
+		cfg.logger.Warn("options of connection pool are ignored, since the pool is owned by the caller", logrus.Fields{
+			"ignoredOptions": len(cfg.pool),
+		})
+		cfg.pool = nil
+	}
+	db, err := gorm.Open(dialector, cfg.gormConfig())
+	if err != nil {
+		return Model{}, fmt.Errorf("can't open database over existing connection pool: %w", err)
+	}
+	if err := sqlDB.Ping(); err != nil {
+		return Model{}, fmt.Errorf("can't ping database: %w", err)
+	}
+	if err := cfg.setup(db); err != nil {
+		return Model{}, err
+	}
+	return Model{db: db, cfg: cfg}, nil
+}
+
+// Use registers gorm plugin, returns descriptive error since registration happens on startup
+func (m *Model) Use(plugin gorm.Plugin) error {
+	if err := m.db.Use(plugin); err != nil {
+		m.logError("can't register gorm plugin", err, logrus.Fields{
+			"pluginName": plugin.Name(),
+			"trace":      m.frames(),
+		})
+		return fmt.Errorf("can't register gorm plugin %s: %w", plugin.Name(), err)
+	}
+	return nil
+}
+
+// Close closes connection pool of database, should be called on shutdown
+func (m *Model) Close() error {
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return fmt.Errorf("can't get connection pool: %w", err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		return fmt.Errorf("can't close connection pool: %w", err)
+	}
+	return nil
+}
+
+// Stats returns statistics of connection pool, empty statistics if pool is unavailable
+func (m *Model) Stats() sql.DBStats {
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return sql.DBStats{}
+	}
+	return sqlDB.Stats()
+}
+
+// dsnHost extracts host and port from connection string for logging, so credentials never leak into logs
+func dsnHost(connURL string) string {
+	connConfig, err := pgconn.ParseConfig(connURL)
+	if err != nil {
+		return "unknown host"
+	}
+	return net.JoinHostPort(connConfig.Host, strconv.Itoa(int(connConfig.Port)))
+}
+
+// open opens database by dialector, retrying failed attempts according to WithConnectRetry option
+func (cfg *config) open(ctx context.Context, dialector gorm.Dialector) (*gorm.DB, error) {
+	delay := cfg.connectBackoff
+	for attempt := 1; ; attempt++ {
+		db, err := gorm.Open(dialector, cfg.gormConfig())
+		if err == nil {
+			return db, nil
+		}
+		if db != nil {
+			// gorm keeps pool opened when ping fails
+			if sqlDB, err := db.DB(); err == nil {
+				_ = sqlDB.Close()
+			}
+		}
+		if attempt >= cfg.connectAttempts {
+			return nil, err
+		}
+
+		next := delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+		cfg.logger.Warn("can't connect to database, retrying", logrus.Fields{
+			logrus.ErrorKey: err,
+			"attempt":       attempt,
+			"maxAttempts":   cfg.connectAttempts,
+			"nextDelay":     next.String(),
+		})
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("connecting is aborted after %d attempts, last error %v: %w", attempt, err, ctx.Err())
+		case <-time.After(next):
+		}
+		delay *= 2
+	}
+}
+
+// setup applies connection level options to opened database
+func (cfg *config) setup(db *gorm.DB) error {
+	if err := registerCallbacks(db); err != nil {
+		return fmt.Errorf("can't register callbacks: %w", err)
+	}
+	if len(cfg.pool) > 0 {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return fmt.Errorf("can't get connection pool: %w", err)
+		}
+		for _, apply := range cfg.pool {
+			apply(sqlDB)
+		}
+	}
+	for _, plugin := range cfg.plugins {
+		if err := db.Use(plugin); err != nil {
+			return fmt.Errorf("can't register gorm plugin %s: %w", plugin.Name(), err)
+		}
+	}
+	if len(cfg.replicas) > 0 {
+		replicas := make([]gorm.Dialector, 0, len(cfg.replicas))
+		for _, dsn := range cfg.replicas {
+			replicas = append(replicas, cfg.dialector(db.Dialector.Name(), dsn))
+		}
+		if err := db.Use(dbresolver.Register(dbresolver.Config{Replicas: replicas})); err != nil {
+			return fmt.Errorf("can't register database replicas: %w", err)
+		}
+	}
+	return nil
+}
+
+// dialector returns dialector of given dialect for dsn
+func (cfg *config) dialector(dialect, dsn string) gorm.Dialector {
+	switch dialect {
+	case dialectMySQL:
+		return mysql.Open(dsn)
+	default:
+		return postgres.New(postgres.Config{DSN: dsn, PreferSimpleProtocol: cfg.simpleProtocol})
+	}
+}
+
+// poolDialector returns dialector over existing connection pool according to its driver
+func (cfg *config) poolDialector(sqlDB *sql.DB) (gorm.Dialector, error) {
+	switch sqlDB.Driver().(type) {
+	case *stdlib.Driver:
+		var conn gorm.ConnPool = sqlDB
+		if cfg.simpleProtocol {
+			conn = &simpleProtocolPool{ConnPool: sqlDB}
+		}
+		return postgres.New(postgres.Config{Conn: conn}), nil
+	case *mysqldriver.MySQLDriver:
+		if cfg.simpleProtocol {
+			return nil, fmt.Errorf("simple protocol is supported by postgres only")
+		}
+		return mysql.New(mysql.Config{Conn: sqlDB}), nil
+	default:
+		return nil, fmt.Errorf("unsupported driver %T of connection pool, wrap gorm instance by NewFromDB instead", sqlDB.Driver())
+	}
+}
+
+// gormConfig builds configuration of gorm according to construction options
+func (cfg *config) gormConfig() *gorm.Config {
+	namer := cfg.namer
+	if namer == nil {
+		namer = schema.NamingStrategy{TablePrefix: cfg.tablePrefix, SingularTable: cfg.singularTables}
+	}
+	return &gorm.Config{
+		NamingStrategy: namer,
+		PrepareStmt:    cfg.prepareStmt,
+		Logger: gormLogger{
+			// slow queries are logged by gormLogger itself
+			Interface: logger.New(
+				log.New(cfg.logWriter, "\r\n", log.LstdFlags), // io writer
+				logger.Config{
+					LogLevel:                  cfg.gormLogLevel,
+					IgnoreRecordNotFoundError: true,
+					Colorful:                  cfg.colorful,
+				},
+			),
+			cfg:   cfg,
+			level: cfg.gormLogLevel,
+		},
+	}
+}
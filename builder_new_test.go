@@ -0,0 +1,181 @@
+package builder
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestNewFromDBKeepsLogger(t *testing.T) {
+	l := logger.Discard.LogMode(logger.Info)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: l})
+	if err != nil {
+		t.Fatalf("can't open sqlite database: %v", err)
+	}
+	m := NewFromDB(db)
+	defer m.Close()
+	if m.db.Config.Logger != l {
+		t.Errorf("logger of gorm is replaced by %T", m.db.Config.Logger)
+	}
+}
+
+func TestNewFromDBPanicsOnNil(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for nil db")
+		}
+	}()
+	NewFromDB(nil)
+}
+
+// closedAddr returns local address where nothing listens
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("can't listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func TestNewReturnsConnectionError(t *testing.T) {
+	addr := closedAddr(t)
+	started := time.Now()
+	_, err := New("postgres://user:topsecret@" + addr + "/db?connect_timeout=2")
+	if err == nil {
+		t.Fatal("expected error of unreachable database")
+	}
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Errorf("error is returned after %v, longer than dial timeout", elapsed)
+	}
+	if !strings.Contains(err.Error(), addr) {
+		t.Errorf("error doesn't name host: %v", err)
+	}
+	if strings.Contains(err.Error(), "topsecret") {
+		t.Errorf("error leaks password: %v", err)
+	}
+}
+
+func TestNewWithContextAbortsRetries(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	l, _ := test.NewNullLogger()
+	started := time.Now()
+	_, err := NewWithContext(ctx, "postgres://user@"+closedAddr(t)+"/db?connect_timeout=2",
+		WithConnectRetry(10, time.Second), WithLogger(l))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected error of canceled context, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("retries aren't aborted, error is returned after %v", elapsed)
+	}
+}
+
+func TestNewFromSQLDBRejectsUnknownDriver(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("can't open sqlite database: %v", err)
+	}
+	defer sqlDB.Close()
+	if _, err := NewFromSQLDB(sqlDB); err == nil || !strings.Contains(err.Error(), "unsupported driver") {
+		t.Errorf("expected error of unsupported driver, got %v", err)
+	}
+}
+
+func TestNewFromSQLDBReturnsPingError(t *testing.T) {
+	sqlDB, err := sql.Open("pgx", "postgres://user@"+closedAddr(t)+"/db?connect_timeout=2")
+	if err != nil {
+		t.Fatalf("can't open connection pool: %v", err)
+	}
+	defer sqlDB.Close()
+	if _, err := NewFromSQLDB(sqlDB, WithSimpleProtocol(true)); err == nil {
+		t.Error("expected error of unreachable database")
+	}
+}
+
+func TestNewFromSQLDBKeepsPoolSettings(t *testing.T) {
+	sqlDB := openSQLDB(t, "pgx", postgresDSNEnv)
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(3)
+	l, hook := test.NewNullLogger()
+	if _, err := NewFromSQLDB(sqlDB, WithMaxOpenConns(10), WithLogger(l)); err != nil {
+		t.Fatalf("can't build model: %v", err)
+	}
+	if max := sqlDB.Stats().MaxOpenConnections; max != 3 {
+		t.Errorf("settings of caller-owned pool are changed, max open connections %d", max)
+	}
+	if entry := hook.LastEntry(); entry == nil || !strings.Contains(entry.Message, "ignored") {
+		t.Errorf("ignored options aren't logged: %v", hook.AllEntries())
+	}
+}
+
+// argsConn records arguments of queries
+type argsConn struct {
+	recordingTxConn
+	args [][]interface{}
+}
+
+func (c *argsConn) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	c.args = append(c.args, args)
+	return c.recordingTxConn.ExecContext(ctx, query, args...)
+}
+
+func (c *argsConn) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	c.args = append(c.args, args)
+	return c.recordingTxConn.QueryContext(ctx, query, args...)
+}
+
+func TestSimpleProtocolPool(t *testing.T) {
+	conn := &argsConn{}
+	pool := &simpleProtocolPool{ConnPool: conn}
+	_, _ = pool.ExecContext(context.Background(), "UPDATE nodes SET name = $1", "a")
+	_, _ = pool.QueryContext(context.Background(), "SELECT 1")
+	if len(conn.args) != 2 {
+		t.Fatalf("unexpected queries %v", conn.args)
+	}
+	for _, args := range conn.args {
+		if len(args) == 0 || args[0] != pgx.QuerySimpleProtocol(true) {
+			t.Errorf("simple protocol isn't requested: %v", args)
+		}
+	}
+	if len(conn.args[0]) != 2 || conn.args[0][1] != "a" {
+		t.Errorf("arguments of query are lost: %v", conn.args[0])
+	}
+	if _, err := pool.GetDBConn(); !errors.Is(err, gorm.ErrInvalidDB) {
+		t.Errorf("expected error of pool without *sql.DB, got %v", err)
+	}
+}
+
+func TestSimpleProtocolPoolBeginsTransaction(t *testing.T) {
+	sqlDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("can't open sqlite database: %v", err)
+	}
+	defer sqlDB.Close()
+	pool := &simpleProtocolPool{ConnPool: sqlDB}
+	if got, err := pool.GetDBConn(); got != sqlDB || err != nil {
+		t.Errorf("wrapped pool isn't exposed: %v, %v", got, err)
+	}
+	tx, err := pool.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("can't begin transaction: %v", err)
+	}
+	if _, ok := tx.(*simpleProtocolTx); !ok {
+		t.Fatalf("transaction doesn't use simple protocol: %T", tx)
+	}
+	if err := tx.(gorm.TxCommitter).Commit(); err != nil {
+		t.Errorf("can't commit transaction: %v", err)
+	}
+}
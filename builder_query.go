@@ -1,11 +1,10 @@
 package builder
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"gorm.io/gorm/logger"
-	"log"
-	"os"
+	"io"
 	"reflect"
 	"strconv"
 	"time"
@@ -13,10 +12,9 @@ import (
 	"gorm-logged/common"
 
 	"github.com/sirupsen/logrus"
-	"github.com/xolodniy/pretty"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
 )
 
 type Model struct {
@@ -25,7 +23,7 @@ type Model struct {
 	// support field for QueryBuilder interface
 	// Used for tracing during building sql query.
 	// Must be initialized separately for each query.
-	logTrace logrus.Fields
+	logTrace chainTrace
 
 	// store preload fields instead of instant preloading
 	// allows to use builder outside model tier with a both preloading and counting
@@ -33,83 +31,188 @@ type Model struct {
 		field      string
 		conditions []interface{}
 	}
-}
 
-func New(connURL string) Model {
-	postgres.New(postgres.Config{}) // required for connect right driver
-	db, err := gorm.Open(postgres.Open(connURL), &gorm.Config{
-		Logger: logger.New(
-			log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
-			logger.Config{
-				SlowThreshold:             200 * time.Millisecond,
-				LogLevel:                  logger.Warn,
-				IgnoreRecordNotFoundError: true,
-				Colorful:                  true,
-			},
-		),
-	})
-	if err != nil {
-		logrus.WithError(err).Fatal("can't connect to database")
-	}
-	return Model{db: db}
+	// buildTrace are calling frames of the first chainer of chain, see CaptureBuildTrace
+	buildTrace *common.LazyFrames
+
+	// tx is shared between all models derived from the same transaction, nil outside of transaction
+	tx *txState
+
+	// cfg is configuration passed on construction, shared between all derived models
+	cfg *config
+
+	// op is name of operation set by Named
+	op string
+
+	// unsampled disables sampling of error logs for chain
+	unsampled bool
+	// silent skips error logs of chain, errorLevel demotes them
+	silent     bool
+	errorLevel *logrus.Level
+
+	// queryLogLevel enables logging of finished queries for chain, overrides WithQueryLogging
+	queryLogLevel *logrus.Level
+
+	// rawErrors makes finishers of chain return errors of gorm as is
+	rawErrors bool
+
+	// slowThreshold overrides threshold of slow queries for chain
+	slowThreshold time.Duration
+
+	// schema is postgres schema of chain set by Schema
+	schema string
+
+	// limitedPreloads are loaded after main query of finisher, see PreloadLimited
+	limitedPreloads []limitedPreload
+
+	// counts are associations counted after main query of finisher, see WithCount
+	counts []string
+
+	// updateDiff is recorded by audit instead of updated values, see UpdatesDiff
+	updateDiff Diff
+
+	// allowClear allows SyncMany2Many to remove all related records, see AllowClear
+	allowClear bool
+
+	// withAssociations makes Save of chain save associations, see WithAssociations
+	withAssociations bool
+
+	// strict fails finishers of chain on columns without fields in destination, see Strict
+	strict bool
+
+	// cacheTTL serves read finishers of chain from cache, see Cached
+	cacheTTL time.Duration
+
+	// unlimited bypasses default and max limits, see Unlimited
+	unlimited bool
+
+	// retry enables retries of read finishers of chain on broken connection
+	retry *RetryOptions
 }
 
 // QueryBuilder expands default gorm methods
 // there are embed logging, common errors and little bit more simply signature
 type QueryBuilder interface {
 	Preload(column string, conditions ...interface{}) *Model
+	PreloadLimited(column string, limit int, order string, conditions ...interface{}) *Model
+	WithCount(associations ...string) *Model
+	JoinPreload(association string) *Model
+	Cached(ttl time.Duration) *Model
+	Strict() *Model
+	SelectColumns(allowed map[string]string, requested []string) *Model
+	GroupByColumns(allowed map[string]string, requested []string) *Model
+	InvalidateCache(pattern string) error
 	Debug() *Model
+	DebugDump(w io.Writer) *Model
+	WithContext(ctx context.Context) *Model
 	Unscoped() *Model
 	IgnoreConflicts() *Model
+	UsePrimary() *Model
+	Prepared() *Model
+	Unsampled() *Model
+	Silent() *Model
+	LogLevel(level logrus.Level) *Model
+	Verbose() *Model
+	Named(op string) *Model
+	WithLogFields(fields logrus.Fields) *Model
+	WithLogField(key string, value interface{}) *Model
+	RawErrors() *Model
+	SlowThreshold(d time.Duration) *Model
+	Retry(attempts int, backoff time.Duration) *Model
+	Schema(name string) *Model
 	Model(value interface{}) *Model
 	Select(query interface{}, args ...interface{}) *Model
 	Table(name string) *Model
+	Union(other *Model) *Model
+	UnionAll(other *Model) *Model
 	Limit(limit int) *Model
+	Unlimited() *Model
 	Offset(offset int) *Model
 	Order(value interface{}) *Model
+	OrderFromString(spec string, allowed map[string]string) *Model
 	Set(name string, value interface{}) *Model
 	Pluck(column string, value interface{}) error
+	PluckMap(keyColumn, valueColumn string, dest interface{}) error
 	First(out interface{}, where ...interface{}) error
+	Reload(dest interface{}) error
+	BatchedFirst(ctx context.Context, out interface{}, id interface{}) error
 	Last(out interface{}, where ...interface{}) error
 	Find(out interface{}, where ...interface{}) error
 	Scan(dest interface{}) error
 	Create(value interface{}) error
+	CreateInBatches(value interface{}, batchSize int) error
+	UpsertBatch(values interface{}, conflictColumns, updateColumns []string, batchSize int) (inserted, updated int64, err error)
 	Save(value interface{}) error
+	WithAssociations() *Model
+	AllowClear() *Model
+	AddToMany2Many(model interface{}, association string, related ...interface{}) error
+	RemoveFromMany2Many(model interface{}, association string, related ...interface{}) error
+	SyncMany2Many(model interface{}, association string, related []interface{}) error
 	Omit(value ...string) *Model
 	Updates(attrs interface{}) error
+	UpdatesDiff(current interface{}, attrs interface{}) (Diff, error)
+	Touch(model interface{}, columns ...string) error
+	UpdatesWithNulls(attrs interface{}, nullFields ...string) error
+	UpdatesAll(attrs interface{}, includeFields ...string) error
 	Delete(value interface{}, where ...interface{}) error
 	Where(query interface{}, args ...interface{}) *Model
+	ApplyFilter(filter interface{}) *Model
+	WhereFullText(column string, query string, config ...string) *Model
+	OrderByRank(column string, query string, config ...string) *Model
+	WhereSimilar(column, term string, threshold float64) *Model
+	OrderBySimilarity(column, term string) *Model
 	Count() (int64, error)
 	Not(query interface{}, args ...interface{}) *Model
 	Group(name string) *Model
 	Having(query interface{}, args ...interface{}) *Model
 	Take(dest interface{}, conds ...interface{}) error
 	BatchFind(dest interface{}, batchSize int, fc func(tx *Model, batch int) error) error
+	FindEach(dest interface{}, fc func() error) error
+	StreamJSON(w io.Writer, newElem func() interface{}) (int64, error)
+	StreamCSV(w io.Writer, opts CSVOptions) (int64, error)
+	DequeueBatch(dest interface{}, n int, markClaimed func(tx *Model, ids []interface{}) error) error
+	FindMaps() ([]map[string]interface{}, error)
+	FirstMap() (map[string]interface{}, error)
 	Joins(query string, args ...interface{}) *Model
 	UpdateByFilter(filter interface{}, values interface{}) error
+	CopyFrom(table string, columns []string, rows [][]interface{}) (int64, error)
+	ImportCSV(r io.Reader, model interface{}, opts ImportOptions) (int64, error)
 
 	// exec(sql string, values ...interface{}) error
 }
 
-func initLogTrace(trace logrus.Fields) logrus.Fields {
-	if trace == nil {
-		return make(logrus.Fields)
+// chain copies builder state into new model with given gorm instance and trace
+func (m *Model) chain(db *gorm.DB, trace chainTrace) *Model {
+	c := *m
+	c.db = db
+	c.logTrace = trace
+	if c.buildTrace == nil && c.cfg != nil && c.cfg.captureBuildTrace {
+		frames := c.frames()
+		c.buildTrace = &frames
 	}
-	return trace
+	return &c
+}
+
+// failed returns copy of chain, which finishers fail with err. Used by chainers to report invalid arguments
+func (m *Model) failed(err error) *Model {
+	c := m.chain(m.db.Session(&gorm.Session{}), m.logTrace)
+	_ = c.db.AddError(err)
+	return c
 }
 
 // Preload is gorm interface func
 // ACHTUNG! do not edit if you don't sure how is pointers work here
 func (m *Model) Preload(column string, conditions ...interface{}) *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["preloadColumn-"+column] = column
+	trace := m.logTrace.with("preloadColumn-"+column, column)
 	if len(conditions) > 0 {
-		trace["preloadConditions-"+column] = conditions
+		trace = trace.with("preloadConditions-"+column, conditions)
 	}
-	return &Model{db: m.db, logTrace: trace, preloads: append(m.preloads, struct {
+	c := m.chain(m.db, trace)
+	c.preloads = append(m.preloads, struct {
 		field      string
 		conditions []interface{}
-	}{field: column, conditions: conditions})}
+	}{field: column, conditions: conditions})
+	return c
 }
 
 // recursive apply preloads
@@ -120,348 +223,578 @@ func (m *Model) Preload(column string, conditions ...interface{}) *Model {
 // we will apply preloads to the whole model, bkz query will be just a pointer to
 func (m *Model) applyPreloads() *Model {
 	if len(m.preloads) > 0 {
-		m := &Model{
-			db:       m.db.Preload(m.preloads[0].field, m.preloads[0].conditions...),
-			logTrace: m.logTrace,
-			preloads: m.preloads[1:]}
+		m := m.chain(m.db.Preload(m.preloads[0].field, m.preloads[0].conditions...), m.logTrace)
+		m.preloads = m.preloads[1:]
 		return m.applyPreloads()
 	}
-	return &Model{db: m.db, logTrace: m.logTrace}
+	m = m.chain(m.db, m.logTrace)
+	m.preloads = nil
+	m.db = m.traced()
+	return m
 }
 
 // Debug is gorm interface func
 func (m *Model) Debug() *Model {
-	return &Model{db: m.db.Debug(), logTrace: m.logTrace, preloads: m.preloads}
+	return m.chain(m.db.Debug(), m.logTrace)
+}
+
+// WithContext is gorm interface func, fields configured by WithTraceContextKeys and
+// WithContextFieldExtractor are taken from ctx into error logs of chain
+func (m *Model) WithContext(ctx context.Context) *Model {
+	return m.chain(m.db.WithContext(ctx), m.logTrace)
 }
 
 // Unscoped is gorm interface func
 func (m *Model) Unscoped() *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["unscoped"] = true
-	return &Model{db: m.db.Unscoped(), logTrace: m.logTrace, preloads: m.preloads}
+	trace := m.logTrace.with("unscoped", true)
+	return m.chain(m.db.Unscoped(), trace)
 }
 
 // Model is gorm interface func
 func (m *Model) Model(value interface{}) *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["model"] = pretty.Print(value)
-	return &Model{db: m.db.Model(value), logTrace: trace, preloads: m.preloads}
+	trace := m.logTrace.with("model", deferPrint(value))
+	return m.chain(m.db.Model(value), trace)
 }
 
 // Select is gorm interface func
 func (m *Model) Select(query interface{}, args ...interface{}) *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["selectQuery"] = query
+	trace := m.logTrace
+	i := trace.freeIndex("selectQuery")
+	trace = trace.with("selectQuery"+i, query)
 	if len(args) > 0 {
-		trace["selectArgs"] = pretty.Print(args)
+		trace = trace.with("selectArgs"+i, deferPrint(args))
 	}
-	return &Model{db: m.db.Select(query, args...), logTrace: trace, preloads: m.preloads}
+	return m.chain(m.db.Select(query, args...), trace)
 }
 
 // Table is gorm interface func
 func (m *Model) Table(name string) *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["tableName"] = name
-	return &Model{db: m.db.Table(name), logTrace: trace, preloads: m.preloads}
+	trace := m.logTrace.with("tableName", name)
+	return m.chain(m.db.Table(name), trace)
 }
 
-// Limit is gorm interface func
+// Limit is gorm interface func, limit above WithMaxLimit option is clamped
 func (m *Model) Limit(limit int) *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["limit"] = limit
-	return &Model{db: m.db.Limit(limit), logTrace: trace, preloads: m.preloads}
+	clamped := m.clampLimit(limit)
+	trace := m.logTrace.with("limit", clamped)
+	if clamped != limit {
+		trace = trace.with("limitClamped", limit)
+	}
+	return m.chain(m.db.Limit(clamped), trace)
 }
 
 // Offset is gorm interface func
 func (m *Model) Offset(offset int) *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["offset"] = offset
-	return &Model{db: m.db.Offset(offset), logTrace: trace, preloads: m.preloads}
+	trace := m.logTrace.with("offset", offset)
+	return m.chain(m.db.Offset(offset), trace)
 }
 
 // Order is gorm interface func
 func (m *Model) Order(value interface{}) *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["order"] = pretty.Print(value)
-	return &Model{db: m.db.Order(value), logTrace: trace, preloads: m.preloads}
+	trace := m.logTrace.with("orderValue"+m.logTrace.freeIndex("orderValue"), deferPrint(value))
+	order, ok := orderByValue(value)
+	if !ok {
+		return m.chain(m.db, trace)
+	}
+	return m.chain(addOrder(m.db, order), trace)
 }
 
 // Joins is gorm interface func
 func (m *Model) Joins(query string, args ...interface{}) *Model {
-	trace := initLogTrace(m.logTrace)
-	var i int
-	for {
-		if _, ok := trace["joinsQuery"+strconv.Itoa(i)]; !ok {
-			break
-		}
-		i++
-	}
-	trace["joinsQuery"+strconv.Itoa(i)] = query
+	trace := m.logTrace
+	i := trace.freeIndex("joinsQuery")
+	trace = trace.with("joinsQuery"+i, query)
 	if len(args) > 0 {
-		trace["joinsArgs"+strconv.Itoa(i)] = pretty.Print(args)
+		trace = trace.with("joinsArgs"+i, deferPrint(args))
 	}
-	return &Model{db: m.db.Joins(query, args), logTrace: trace, preloads: m.preloads}
+	return m.chain(m.db.Joins(query, args...), trace)
+}
+
+// JoinPreload is gorm extension. Loads belongs to or has one association by LEFT JOIN of the main query,
+// so parent and association are selected in one round trip. Other associations are loaded by Preload as usual
+func (m *Model) JoinPreload(association string) *Model {
+	trace := m.logTrace.with("joinPreload"+m.logTrace.freeIndex("joinPreload"), association)
+	return m.chain(m.db.Joins(association), trace)
 }
 
 func (m *Model) Set(name string, value interface{}) *Model {
-	trace := initLogTrace(m.logTrace)
-	var i int
-	for {
-		if _, ok := trace["setName"+strconv.Itoa(i)]; !ok {
-			break
-		}
-		i++
-	}
-	trace["setName"+strconv.Itoa(i)] = name
-	trace["setValue"+strconv.Itoa(i)] = value
-	return &Model{db: m.db.Set(name, value), logTrace: trace, preloads: m.preloads}
+	trace := m.logTrace
+	i := trace.freeIndex("setName")
+	trace = trace.with("setName"+i, name)
+	trace = trace.with("setValue"+i, value)
+	return m.chain(m.db.Set(name, value), trace)
 }
 func (m *Model) IgnoreConflicts() *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["ignoreConflicts"] = true
-	return &Model{db: m.db.Clauses(clause.OnConflict{DoNothing: true}), logTrace: trace, preloads: m.preloads}
+	trace := m.logTrace.with("ignoreConflicts", true)
+	if m.dialect() == dialectMySQL {
+		// mysql has no ON CONFLICT, INSERT IGNORE is its equivalent
+		return m.chain(m.db.Clauses(clause.Insert{Modifier: "IGNORE"}), trace)
+	}
+	return m.chain(m.db.Clauses(clause.OnConflict{DoNothing: true}), trace)
+}
+
+// UsePrimary routes query of chain to the primary even if replicas are configured.
+// Useful for reading just written data, which may not be replicated yet
+func (m *Model) UsePrimary() *Model {
+	trace := m.logTrace.with("forcePrimary", true)
+	return m.chain(m.db.Clauses(dbresolver.Write), trace)
+}
+
+// Prepared caches prepared statements of chain queries, see WithPrepareStmt to enable it for all queries
+func (m *Model) Prepared() *Model {
+	trace := m.logTrace.with("prepared", true)
+	return m.chain(m.db.Session(&gorm.Session{PrepareStmt: true}), trace)
 }
 
 // Pluck is gorm interface func
 func (m *Model) Pluck(column string, value interface{}) error {
-	err := m.applyPreloads().db.Pluck(column, value).Error
+	res := m.read("pluck", func() *gorm.DB { return m.applyPreloads().db.Pluck(column, value) })
+	err := res.Error
 	if err != nil {
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logrus.Fields{
+		m.tx.remember(err)
+		return m.fail("pluck", "can't pluck object from the database", err, m.sqlFields(res), logrus.Fields{
 			"typeOfPluckingValue": fmt.Sprintf("%T", value),
 			"pluckColumnName":     column,
-			"trace":               common.GetFrames(),
-		}).Error("can't pluck object from the database")
+			"trace":               m.frames(),
+		})
+	}
+	return nil
+}
+
+// PluckMap is gorm extension. Selects two columns and fills map pointed by dest with key column to value column pairs.
+// Types of keys and values are taken from the map type. For duplicated keys the last value wins
+func (m *Model) PluckMap(keyColumn, valueColumn string, dest interface{}) error {
+	logFields := logrus.Fields{
+		"typeOfPluckMapDest":  fmt.Sprintf("%T", dest),
+		"pluckMapKeyColumn":   keyColumn,
+		"pluckMapValueColumn": valueColumn,
+	}
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() || destValue.Elem().Kind() != reflect.Map {
+		m.logError("queryBuilder.PluckMap called with dest which is not a pointer to map", nil, logFields,
+			logrus.Fields{"trace": m.frames()})
 		return common.ErrInternal
 	}
+	mapValue := destValue.Elem()
+	if mapValue.IsNil() {
+		mapValue.Set(reflect.MakeMap(mapValue.Type()))
+	}
+
+	duplicates, err := pluckMap(m.applyPreloads().db, keyColumn, valueColumn, mapValue)
+	if err != nil {
+		m.tx.remember(err)
+		return m.fail("pluckMap", "can't pluck map from the database", err, logFields,
+			logrus.Fields{"trace": m.frames()})
+	}
+	if duplicates > 0 {
+		m.logDebug("queryBuilder.PluckMap got duplicated keys, the last values are kept", nil, logFields,
+			logrus.Fields{"pluckMapDuplicates": duplicates})
+	}
 	return nil
 }
 
+// pluckMap scans key and value columns into mapValue, returns count of duplicated keys
+func pluckMap(db *gorm.DB, keyColumn, valueColumn string, mapValue reflect.Value) (int, error) {
+	rows, err := db.Clauses(clause.Select{Columns: []clause.Column{{Name: keyColumn}, {Name: valueColumn}}}).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var duplicates int
+	keyType, valueType := mapValue.Type().Key(), mapValue.Type().Elem()
+	for rows.Next() {
+		key, value := reflect.New(keyType), reflect.New(valueType)
+		if err := rows.Scan(key.Interface(), value.Interface()); err != nil {
+			return duplicates, err
+		}
+		if mapValue.MapIndex(key.Elem()).IsValid() {
+			duplicates++
+		}
+		mapValue.SetMapIndex(key.Elem(), value.Elem())
+	}
+	return duplicates, rows.Err()
+}
+
 // First is gorm interface func
 func (m *Model) First(out interface{}, where ...interface{}) error {
-	err := m.applyPreloads().db.First(out, where...).Error
+	key, cached := m.fromCache("first", out, func(db *gorm.DB) *gorm.DB { return db.First(out, where...) })
+	if cached {
+		return nil
+	}
+	if err := m.checkStrict("first", out, func(db *gorm.DB) *gorm.DB { return db.First(out, where...) }); err != nil {
+		return err
+	}
+	res := m.read("first", func() *gorm.DB { return m.applyPreloads().db.First(out, where...) })
+	err := res.Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return common.ErrNotFound
+		return m.notFound(out, res)
 	}
 	if err != nil {
 		logFields := logrus.Fields{
-			"trace":    common.GetFrames(),
-			"firstOut": pretty.Print(out),
+			"trace":    m.frames(),
+			"firstOut": m.summarize(out),
 		}
 		if len(where) > 0 {
-			logFields["firstWhere"] = pretty.Print(where)
+			logFields["firstWhere"] = m.summarize(where)
 		}
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logFields).Error("can't get first object from the database")
-		return common.ErrInternal
+		m.tx.remember(err)
+		return m.fail("first", "can't get first object from the database", err, m.sqlFields(res), logFields)
+	}
+	if err := m.loadAfterFind("first", out); err != nil {
+		return err
 	}
+	m.toCache(key, out)
 	return nil
 }
 
 // Last is gorm interface func
 func (m *Model) Last(out interface{}, where ...interface{}) error {
-	err := m.applyPreloads().db.Last(out, where...).Error
+	key, cached := m.fromCache("last", out, func(db *gorm.DB) *gorm.DB { return db.Last(out, where...) })
+	if cached {
+		return nil
+	}
+	res := m.read("last", func() *gorm.DB { return m.applyPreloads().db.Last(out, where...) })
+	err := res.Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return common.ErrNotFound
+		return m.notFound(out, res)
 	}
 	if err != nil {
 		logFields := logrus.Fields{
-			"trace":   common.GetFrames(),
-			"lastOut": pretty.Print(out),
+			"trace":   m.frames(),
+			"lastOut": m.summarize(out),
 		}
 		if len(where) > 0 {
-			logFields["lastWhere"] = pretty.Print(where)
+			logFields["lastWhere"] = m.summarize(where)
 		}
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logFields).Error("can't get last object from the database")
-		return common.ErrInternal
+		m.tx.remember(err)
+		return m.fail("last", "can't get last object from the database", err, m.sqlFields(res), logFields)
+	}
+	if err := m.loadAfterFind("last", out); err != nil {
+		return err
 	}
+	m.toCache(key, out)
 	return nil
 }
 
 // Take is gorm interface func
 func (m *Model) Take(dest interface{}, conds ...interface{}) error {
-	err := m.applyPreloads().db.Take(dest, conds...).Error
+	key, cached := m.fromCache("take", dest, func(db *gorm.DB) *gorm.DB { return db.Take(dest, conds...) })
+	if cached {
+		return nil
+	}
+	res := m.read("take", func() *gorm.DB { return m.applyPreloads().db.Take(dest, conds...) })
+	err := res.Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return common.ErrNotFound
+		return m.notFound(dest, res)
 	}
 	if err != nil {
 		logFields := logrus.Fields{
 			"takeWhereCondition": fmt.Sprintf("%+v", conds),
-			"takeDest":           pretty.Print(dest),
-			"trace":              common.GetFrames(),
+			"takeDest":           m.summarize(dest),
+			"trace":              m.frames(),
 		}
 		if len(conds) > 0 {
-			logFields["takeConds"] = pretty.Print(conds)
+			logFields["takeConds"] = m.summarize(conds)
 		}
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logFields).Error("can't take object from the database")
-		return common.ErrInternal
+		m.tx.remember(err)
+		return m.fail("take", "can't take object from the database", err, m.sqlFields(res), logFields)
 	}
+	if err := m.loadAfterFind("take", dest); err != nil {
+		return err
+	}
+	m.toCache(key, dest)
 	return nil
 }
 
 // Find is gorm interface func
 func (m *Model) Find(out interface{}, where ...interface{}) error {
-	err := m.applyPreloads().db.Find(out, where...).Error
+	m = m.defaultLimit()
+	key, cached := m.fromCache("find", out, func(db *gorm.DB) *gorm.DB { return db.Find(out, where...) })
+	if cached {
+		return nil
+	}
+	if err := m.checkStrict("find", out, func(db *gorm.DB) *gorm.DB { return db.Find(out, where...) }); err != nil {
+		return err
+	}
+	res := m.read("find", func() *gorm.DB { return m.applyPreloads().db.Find(out, where...) })
+	err := res.Error
 	if err != nil {
 		logFields := logrus.Fields{
-			"findOut": pretty.Print(out),
-			"trace":   common.GetFrames(),
+			"findOut": m.summarize(out),
+			"trace":   m.frames(),
 		}
 		if len(where) > 0 {
-			logFields["findWhere"] = pretty.Print(where)
+			logFields["findWhere"] = m.summarize(where)
 		}
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logFields).Error("can't find from the database")
-		return common.ErrInternal
+		m.tx.remember(err)
+		return m.fail("find", "can't find from the database", err, m.sqlFields(res), logFields)
 	}
+	if err := m.loadAfterFind("find", out); err != nil {
+		return err
+	}
+	m.toCache(key, out)
 	return nil
 }
 
+// loadAfterFind loads limited preloads and counts of associations into dest found by finisher op
+func (m *Model) loadAfterFind(op string, dest interface{}) error {
+	if err := m.loadLimitedPreloads(op, dest); err != nil {
+		return err
+	}
+	return m.loadCounts(op, dest)
+}
+
+// maxLoggedSQLLen limits length of logged sql and its vars
+const maxLoggedSQLLen = 4096
+
+// FindMaps is gorm extension. Finds rows as column name to value maps,
+// useful with Table for ad-hoc queries without declared struct
+func (m *Model) FindMaps() ([]map[string]interface{}, error) {
+	m = m.defaultLimit()
+	var out []map[string]interface{}
+	q := m.startQuery("findMaps")
+	res := q.done(m.applyPreloads().db.Find(&out))
+	if err := res.Error; err != nil {
+		m.tx.remember(err)
+		return nil, m.fail("findMaps", "can't find maps from the database", err, m.sqlFields(res), logrus.Fields{
+			"findMapsRows": len(out),
+			"findMapsOut":  m.summarize(out),
+			"trace":        m.frames(),
+		})
+	}
+	return out, nil
+}
+
+// FirstMap is gorm extension. Takes the first row in order of chain as column name to value map
+func (m *Model) FirstMap() (map[string]interface{}, error) {
+	out := make(map[string]interface{})
+	q := m.startQuery("firstMap")
+	res := q.done(m.applyPreloads().db.Take(&out))
+	err := res.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, m.notFound(&out, res)
+	}
+	if err != nil {
+		m.tx.remember(err)
+		return nil, m.fail("firstMap", "can't get first map from the database", err, m.sqlFields(res), logrus.Fields{
+			"firstMapOut": m.summarize(out),
+			"trace":       m.frames(),
+		})
+	}
+	return out, nil
+}
+
+// printCapped summarizes value, cutting result to maxLen bytes
+func (m *Model) printCapped(value interface{}, maxLen int) string {
+	res := m.summarize(value)
+	if len(res) <= maxLen {
+		return res
+	}
+	return res[:maxLen] + "... (" + strconv.Itoa(len(res)) + " bytes total)"
+}
+
 // Scan is gorm interface func
 func (m *Model) Scan(dest interface{}) error {
-	err := m.applyPreloads().db.Scan(dest).Error
+	m = m.defaultLimit()
+	if err := m.checkStrict("scan", dest, func(db *gorm.DB) *gorm.DB { return db.Scan(dest) }); err != nil {
+		return err
+	}
+	res := m.read("scan", func() *gorm.DB { return m.applyPreloads().db.Scan(dest) })
+	err := res.Error
 	if err != nil {
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logrus.Fields{
-			"scanDest": pretty.Print(dest),
-			"trace":    common.GetFrames(),
-		}).Error("can't scan from the database")
-		return common.ErrInternal
+		m.tx.remember(err)
+		return m.fail("scan", "can't scan from the database", err, m.sqlFields(res), logrus.Fields{
+			"scanDest": m.summarize(dest),
+			"trace":    m.frames(),
+		})
 	}
 	return nil
 }
 
 // Create is gorm interface func
 func (m *Model) Create(value interface{}) error {
-	err := m.applyPreloads().db.Create(value).Error
+	q := m.startQuery("create")
+	res := q.done(m.applyPreloads().db.Create(value))
+	err := res.Error
 	if err != nil {
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logrus.Fields{
-			"createValue": pretty.Print(value),
-			"trace":       common.GetFrames(),
-		}).Error("can't create value in database")
-		return common.ErrInternal
+		m.tx.remember(err)
+		return m.fail("create", "can't create value in database", err, m.sqlFields(res), logrus.Fields{
+			"createValue": m.summarize(value),
+			"trace":       m.frames(),
+		})
 	}
 	return nil
 }
 
-// Save is gorm interface func
+// CreateInBatches is gorm interface func
+func (m *Model) CreateInBatches(value interface{}, batchSize int) error {
+	q := m.startQuery("createInBatches")
+	res := q.done(m.applyPreloads().db.CreateInBatches(value, batchSize))
+	if err := res.Error; err != nil {
+		m.tx.remember(err)
+		return m.fail("createInBatches", "can't create values in database", err, m.sqlFields(res), logrus.Fields{
+			"createValue":     m.summarize(value),
+			"createBatchSize": batchSize,
+			"trace":           m.frames(),
+		})
+	}
+	return nil
+}
+
+// Save is gorm interface func, but associations of value are not saved unless chain is marked by WithAssociations.
+// Migration: chains which rely on saving of nested structs must call WithAssociations, until then
+// WithSaveAssociations option restores the previous behavior for all chains. Skipped populated associations are logged
 func (m *Model) Save(value interface{}) error {
-	if err := m.applyPreloads().db.Save(value).Error; err != nil {
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logrus.Fields{
-			"saveValue": pretty.Print(value),
-			"trace":     common.GetFrames(),
-		}).Error("can't save object in a database")
-		return common.ErrInternal
+	db := m.applyPreloads().db
+	if !m.withAssociations && !m.cfg.saveAssociations {
+		m.warnSkippedAssociations(value)
+		db = db.Omit(clause.Associations)
+	}
+	q := m.startQuery("save")
+	res := q.done(db.Save(value))
+	if err := res.Error; err != nil {
+		m.tx.remember(err)
+		return m.fail("save", "can't save object in a database", err, m.sqlFields(res), logrus.Fields{
+			"saveValue": m.summarize(value),
+			"trace":     m.frames(),
+		})
 	}
 	return nil
 }
 
 // Omit is gorm interface func
 func (m *Model) Omit(value ...string) *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["omit"] = value
-	return &Model{db: m.db.Omit(value...), logTrace: trace, preloads: m.preloads}
+	trace := m.logTrace.with("omit"+m.logTrace.freeIndex("omit"), value)
+	return m.chain(m.db.Omit(value...), trace)
 }
 
 // Updates is gorm interface func
 func (m *Model) Updates(attrs interface{}) error {
-	if err := m.applyPreloads().db.Updates(attrs).Error; err != nil {
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logrus.Fields{
-			"updateAttrs": pretty.Print(attrs),
-			"trace":       common.GetFrames(),
-		}).Error("can't update object in database")
-		return common.ErrInternal
+	q := m.startQuery("updates")
+	res := q.done(m.applyPreloads().db.Updates(attrs))
+	if err := res.Error; err != nil {
+		m.tx.remember(err)
+		return m.fail("updates", "can't update object in database", err, m.sqlFields(res), logrus.Fields{
+			"updateAttrs": m.summarize(attrs),
+			"trace":       m.frames(),
+		})
 	}
 	return nil
 }
 
 // Delete is gorm interface func
 func (m *Model) Delete(value interface{}, where ...interface{}) error {
-	if err := m.applyPreloads().db.Delete(value, where...).Error; err != nil {
+	q := m.startQuery("delete")
+	res := q.done(m.applyPreloads().db.Delete(value, where...))
+	if err := res.Error; err != nil {
 		logFields := logrus.Fields{
-			"deleteValue": pretty.Print(value),
-			"trace":       common.GetFrames(),
+			"deleteValue": m.summarize(value),
+			"trace":       m.frames(),
 		}
 		if len(where) > 0 {
-			logFields["deleteWhere"] = pretty.Print(where)
+			logFields["deleteWhere"] = m.summarize(where)
 		}
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logFields).Error("can't delete object from DB")
-		return common.ErrInternal
+		m.tx.remember(err)
+		return m.fail("delete", "can't delete object from DB", err, m.sqlFields(res), logFields)
 	}
 	return nil
 }
 
-// Where is gorm interface func
+// Where is gorm interface func. Named arguments are passed as single map or as sql.NamedArg values,
+// like Where("created_at > @from", map[string]interface{}{"from": from}), missing ones fail finisher of chain
 func (m *Model) Where(query interface{}, args ...interface{}) *Model {
-	trace := initLogTrace(m.logTrace)
-	var i int
-	for {
-		if _, ok := trace["whereQuery"+strconv.Itoa(i)]; !ok {
-			break
+	trace := m.logTrace
+	i := trace.freeIndex("whereQuery")
+	trace = trace.with("whereQuery"+i, deferPrint(query))
+	if named, ok := namedArgs(args); ok {
+		trace = trace.with("whereNamedArgs"+i, deferPrint(named))
+		if sql, ok := query.(string); ok {
+			if err := checkNamedArgs(sql, named); err != nil {
+				return m.chain(m.db, trace).failed(err)
+			}
 		}
-		i++
-	}
-	trace["whereQuery"+strconv.Itoa(i)] = pretty.Print(query)
-	if len(args) > 0 {
-		trace["whereArgs"+strconv.Itoa(i)] = pretty.Print(args)
+	} else if len(args) > 0 {
+		trace = trace.with("whereArgs"+i, deferPrint(args))
 	}
-	return &Model{db: m.db.Where(query, args...), logTrace: trace, preloads: m.preloads}
+	return m.chain(m.db.Where(query, args...), trace)
 }
 
 // Count is gorm interface func
 func (m *Model) Count() (int64, error) {
 	var c int64
-	if err := m.db.Count(&c).Error; err != nil {
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logrus.Fields{
-			"trace": common.GetFrames(),
-		}).Error("can't count objects in DB")
-		return 0, common.ErrInternal
+	res := m.read("count", func() *gorm.DB { return m.traced().Count(&c) })
+	if err := res.Error; err != nil {
+		m.tx.remember(err)
+		return 0, m.fail("count", "can't count objects in DB", err, m.sqlFields(res), logrus.Fields{
+			"trace": m.frames(),
+		})
 	}
 	return c, nil
 }
 
 // Not is gorm interface func
 func (m *Model) Not(query interface{}, args ...interface{}) *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["notQuery"] = pretty.Print(query)
+	trace := m.logTrace.with("notQuery", deferPrint(query))
 	if len(args) > 0 {
-		trace["notArgs"] = args
+		trace = trace.with("notArgs", args)
 	}
-	return &Model{db: m.db.Not(query, args...), logTrace: trace, preloads: m.preloads}
+	return m.chain(m.db.Not(query, args...), trace)
 }
 
 // Group is gorm interface func
 func (m *Model) Group(name string) *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["groupName"] = name
-	return &Model{db: m.db.Group(name), logTrace: trace, preloads: m.preloads}
+	trace := m.logTrace.with("groupName"+m.logTrace.freeIndex("groupName"), name)
+	return m.chain(m.db.Group(name), trace)
 }
 
 // Having is gorm interface func
 func (m *Model) Having(query interface{}, args ...interface{}) *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["havingQuery"] = query
+	trace := m.logTrace
+	i := trace.freeIndex("havingQuery")
+	trace = trace.with("havingQuery"+i, query)
 	if len(args) > 0 {
-		trace["havingArgs"] = args
+		trace = trace.with("havingArgs"+i, args)
 	}
-	return &Model{db: m.db.Having(query, args...), logTrace: trace, preloads: m.preloads}
+	return m.chain(m.db.Having(query, args...), trace)
 }
 
+// exec executes sql, values are positional or named, see Where
 func (m *Model) exec(sql string, values ...interface{}) error {
-	if err := m.applyPreloads().db.Exec(sql, values...).Error; err != nil {
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logrus.Fields{
-			"trace":      common.GetFrames(),
+	if named, ok := namedArgs(values); ok {
+		if err := checkNamedArgs(sql, named); err != nil {
+			return m.fail("exec", "can't exec sql in DB", err, logrus.Fields{
+				"trace":         m.frames(),
+				"execSql":       sql,
+				"execNamedArgs": m.summarize(named),
+			})
+		}
+	}
+	q := m.startQuery("exec")
+	res := q.done(m.applyPreloads().db.Exec(sql, values...))
+	if err := res.Error; err != nil {
+		m.tx.remember(err)
+		return m.fail("exec", "can't exec sql in DB", err, m.sqlFields(res), logrus.Fields{
+			"trace":      m.frames(),
 			"execSql":    sql,
 			"execValues": values,
-		}).Error("can't exec sql in DB")
-		return common.ErrInternal
+		})
 	}
 	return nil
 }
 
+// raw is gorm Raw, values are positional or named, see Where
 func (m *Model) raw(sql string, values ...interface{}) *Model {
-	trace := initLogTrace(m.logTrace)
-	trace["rawSql"] = sql
-	if len(values) > 0 {
-		trace["rawValues"] = values
+	trace := m.logTrace.with("rawSql", sql)
+	if named, ok := namedArgs(values); ok {
+		trace = trace.with("rawNamedArgs", deferPrint(named))
+		if err := checkNamedArgs(sql, named); err != nil {
+			return m.chain(m.db, trace).failed(err)
+		}
+	} else if len(values) > 0 {
+		trace = trace.with("rawValues", values)
 	}
-	return &Model{db: m.db.Raw(sql, values...), logTrace: trace, preloads: m.preloads}
+	return m.chain(m.db.Raw(sql, values...), trace)
 }
 
 // BatchFind is gorm interface func
@@ -474,29 +807,118 @@ func (m *Model) BatchFind(dest interface{}, batchSize int, fc func(tx *Model, ba
 	}).Error
 	if err != nil {
 		logFields := logrus.Fields{
-			"batchFindDest": pretty.Print(dest),
+			"batchFindDest": m.summarize(dest),
 			"batchSize":     batchSize,
-			"trace":         common.GetFrames(),
+			"trace":         m.frames(),
 		}
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logFields).Error("can't find from the database")
+		m.tx.remember(err)
+		return m.fail("batchFind", "can't find from the database", err, logFields)
+	}
+	return nil
+}
+
+// findEachBatchSize is count of records fetched by single query of FindEach
+const findEachBatchSize = 1000
+
+// FindEach is gorm extension. Calls fc for each found record, placing the record into dest before call.
+// Records are fetched by primary key batches, so the whole result set is never loaded into memory.
+// Ordered chains and models without single primary key are fetched by offset batches instead.
+// The first fc error stops iteration and is returned as is
+func (m *Model) FindEach(dest interface{}, fc func() error) error {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() {
+		m.logError("queryBuilder.FindEach called with non pointer dest", nil, logrus.Fields{
+			"findEachDest": fmt.Sprintf("%T", dest),
+			"trace":        m.frames(),
+		})
 		return common.ErrInternal
 	}
+	records := reflect.New(reflect.SliceOf(destValue.Elem().Type()))
+
+	var (
+		fcErr     error
+		lastBatch int
+		offset    int
+	)
+	eachInBatch := func(batch int) error {
+		for i := 0; i < records.Elem().Len(); i++ {
+			destValue.Elem().Set(records.Elem().Index(i))
+			if fcErr = fc(); fcErr != nil {
+				return fcErr
+			}
+			offset++
+		}
+		lastBatch = batch
+		return nil
+	}
+
+	query := m.applyPreloads().db.Session(&gorm.Session{})
+	var err error
+	if _, ordered := query.Statement.Clauses["ORDER BY"]; ordered || !hasPrioritizedPrimaryKey(query, dest) {
+		err = findInOffsetBatches(query, records.Interface(), findEachBatchSize, eachInBatch)
+	} else {
+		err = query.FindInBatches(records.Interface(), findEachBatchSize, func(tx *gorm.DB, batch int) error {
+			return eachInBatch(batch)
+		}).Error
+	}
+	if fcErr != nil {
+		return fcErr
+	}
+	if err != nil {
+		m.tx.remember(err)
+		return m.fail("findEach", "can't find from the database", err, logrus.Fields{
+			"findEachDest":   fmt.Sprintf("%T", dest),
+			"findEachBatch":  lastBatch + 1,
+			"findEachOffset": offset,
+			"trace":          m.frames(),
+		})
+	}
 	return nil
 }
 
+// findInOffsetBatches fetches records into dest by Limit/Offset batches and calls fc after each non-empty batch
+func findInOffsetBatches(db *gorm.DB, dest interface{}, batchSize int, fc func(batch int) error) error {
+	for batch := 1; ; batch++ {
+		result := db.Offset((batch - 1) * batchSize).Limit(batchSize).Find(dest)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		if err := fc(batch); err != nil {
+			return err
+		}
+		if int(result.RowsAffected) < batchSize {
+			return nil
+		}
+	}
+}
+
+// hasPrioritizedPrimaryKey reports whether model of dest has primary key suitable for FindInBatches
+func hasPrioritizedPrimaryKey(db *gorm.DB, dest interface{}) bool {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(dest); err != nil {
+		return false
+	}
+	return stmt.Schema.PrioritizedPrimaryField != nil
+}
+
 // UpdateByFilter is gorm extension. Allow to omit .Model() and .Where() methods
 func (m *Model) UpdateByFilter(filter interface{}, values interface{}) error {
 	if reflect.DeepEqual(filter, reflect.Zero(reflect.TypeOf(filter)).Interface()) {
-		logrus.Error("queryBuilder.UpdateByFilter called for empty filter")
+		m.logError("queryBuilder.UpdateByFilter called for empty filter", nil)
 		return common.ErrInternal
 	}
-	if err := m.applyPreloads().db.Model(filter).Where(filter).Updates(values).Error; err != nil {
-		logrus.WithError(err).WithFields(m.logTrace).WithFields(logrus.Fields{
-			"UpdateByFilterFilter": pretty.Print(filter),
-			"UpdateByFilterValues": pretty.Print(values),
-			"trace":                common.GetFrames(),
-		}).Error("can't update object in database")
-		return common.ErrInternal
+	q := m.startQuery("updateByFilter")
+	res := q.done(m.applyPreloads().db.Model(filter).Where(filter).Updates(values))
+	if err := res.Error; err != nil {
+		m.tx.remember(err)
+		return m.fail("updateByFilter", "can't update object in database", err, m.sqlFields(res), logrus.Fields{
+			"UpdateByFilterFilter": m.summarize(filter),
+			"UpdateByFilterValues": m.summarize(values),
+			"trace":                m.frames(),
+		})
 	}
 	return nil
 }
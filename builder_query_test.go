@@ -0,0 +1,291 @@
+package builder
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm-logged/common"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type preparedNode struct {
+	ID   int
+	Name string
+}
+
+// preparedStmts returns count of statements prepared by pool, -1 if pool doesn't prepare statements
+func preparedStmts(pool gorm.ConnPool) int {
+	stmts, ok := pool.(*gorm.PreparedStmtDB)
+	if !ok {
+		return -1
+	}
+	stmts.Mux.RLock()
+	defer stmts.Mux.RUnlock()
+	return len(stmts.Stmts)
+}
+
+func TestPreparedCachesStatements(t *testing.T) {
+	m := newTestModel(t, nil, &preparedNode{})
+	if err := m.Create(&preparedNode{Name: "a"}); err != nil {
+		t.Fatalf("can't create node: %v", err)
+	}
+	if count := preparedStmts(m.db.Statement.ConnPool); count != -1 {
+		t.Fatalf("statements are prepared without Prepared, %d cached", count)
+	}
+
+	c := m.Prepared()
+	for i := 0; i < 3; i++ {
+		var node preparedNode
+		if err := c.Where("name = ?", "a").First(&node); err != nil {
+			t.Fatalf("can't find node: %v", err)
+		}
+	}
+	if count := preparedStmts(c.db.Statement.ConnPool); count != 1 {
+		t.Fatalf("expected single statement prepared for repeated query, got %d", count)
+	}
+}
+
+func TestWithPrepareStmt(t *testing.T) {
+	m := newTestModel(t, []Option{WithPrepareStmt(true)}, &preparedNode{})
+	var nodes []preparedNode
+	if err := m.Find(&nodes); err != nil {
+		t.Fatalf("can't find nodes: %v", err)
+	}
+	if count := preparedStmts(m.db.ConnPool); count < 1 {
+		t.Fatalf("expected statements prepared for all queries, got %d", count)
+	}
+}
+
+func TestWithSimpleProtocol(t *testing.T) {
+	for _, simple := range []bool{false, true} {
+		cfg := newConfig([]Option{WithSimpleProtocol(simple)})
+		d, ok := cfg.dialector(dialectPostgres, "host=localhost").(*postgres.Dialector)
+		if !ok {
+			t.Fatalf("expected postgres dialector, got %T", d)
+		}
+		if d.PreferSimpleProtocol != simple {
+			t.Errorf("WithSimpleProtocol(%v) sets PreferSimpleProtocol %v", simple, d.PreferSimpleProtocol)
+		}
+	}
+}
+
+// BenchmarkPrepared compares repeated First calls with and without cached prepared statements
+func BenchmarkPrepared(b *testing.B) {
+	m := newTestModel(b, nil, &preparedNode{})
+	if err := m.Create(&preparedNode{Name: "a"}); err != nil {
+		b.Fatalf("can't create node: %v", err)
+	}
+	for _, bench := range []struct {
+		name  string
+		chain *Model
+	}{
+		{"plain", m},
+		{"prepared", m.Prepared()},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var node preparedNode
+				if err := bench.chain.Where("name = ?", "a").First(&node); err != nil {
+					b.Fatalf("can't find node: %v", err)
+				}
+			}
+		})
+	}
+}
+
+type mapNode struct {
+	ID        int
+	Name      *string
+	Score     float64
+	CreatedAt time.Time
+}
+
+func TestFindMaps(t *testing.T) {
+	m := newTestModel(t, nil, &mapNode{})
+	name := "a"
+	createdAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	for _, node := range []mapNode{{Name: &name, Score: 1.5, CreatedAt: createdAt}, {Score: 2, CreatedAt: createdAt}} {
+		if err := m.Create(&node); err != nil {
+			t.Fatalf("can't create node: %v", err)
+		}
+	}
+
+	rows, err := m.Table("map_nodes").Order("id").FindMaps()
+	if err != nil {
+		t.Fatalf("can't find maps: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if rows[0]["name"] != "a" || rows[0]["score"] != 1.5 {
+		t.Errorf("unexpected values of the first row: %v", rows[0])
+	}
+	if value, ok := rows[1]["name"]; !ok || value != nil {
+		t.Errorf("expected nil for NULL column, got %#v", value)
+	}
+	if at, ok := rows[0]["created_at"].(time.Time); !ok || !at.Equal(createdAt) {
+		t.Errorf("expected timestamp %v, got %#v", createdAt, rows[0]["created_at"])
+	}
+
+	row, err := m.Table("map_nodes").Where("score > ?", 1.5).FirstMap()
+	if err != nil {
+		t.Fatalf("can't get first map: %v", err)
+	}
+	if row["score"] != 2.0 || row["name"] != nil {
+		t.Errorf("unexpected first row %v", row)
+	}
+}
+
+func TestFirstMapNotFound(t *testing.T) {
+	m := newTestModel(t, nil, &mapNode{})
+	row, err := m.Table("map_nodes").FirstMap()
+	if !errors.Is(err, common.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if row != nil {
+		t.Errorf("expected nil row, got %v", row)
+	}
+}
+
+func TestPrintCapped(t *testing.T) {
+	m := newTestModel(t, nil)
+	rows := make([]map[string]interface{}, 3)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"payload": strings.Repeat("x", 100)}
+	}
+	printed := m.printCapped(rows, 64)
+	if !strings.HasPrefix(printed, m.summarize(rows)[:64]) || !strings.HasSuffix(printed, "bytes total)") {
+		t.Errorf("value isn't capped: %s", printed)
+	}
+	if short := m.printCapped(1, 64); short != m.summarize(1) {
+		t.Errorf("short value is changed: %s", short)
+	}
+}
+
+func TestRepeatedChainersAreTraced(t *testing.T) {
+	m, hook := newLoggedModel(t, nil)
+	var dest []map[string]interface{}
+	err := m.Table("missing_table").
+		Select("id").Select("name").
+		Order("id").Order("name DESC").
+		Group("id").Group("name").
+		Having("COUNT(*) > ?", 1).Having("SUM(id) < ?", 10).
+		Omit("a").Omit("b").
+		Find(&dest)
+	if err == nil {
+		t.Fatal("expected error of missing table")
+	}
+	entries := hook.AllEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected single log, got %d", len(entries))
+	}
+	logged := entries[0].Data
+	for _, key := range []string{
+		"selectQuery0", "selectQuery1", "orderValue0", "orderValue1", "groupName0", "groupName1",
+		"havingQuery0", "havingQuery1", "havingArgs0", "havingArgs1", "omit0", "omit1",
+	} {
+		if _, ok := logged[key]; !ok {
+			t.Errorf("%s isn't logged", key)
+		}
+	}
+	if logged["groupName0"] != "id" || logged["groupName1"] != "name" {
+		t.Errorf("values of repeated chainer are mixed up: %v, %v", logged["groupName0"], logged["groupName1"])
+	}
+}
+
+func TestFreeIndex(t *testing.T) {
+	trace := chainTrace(nil).with("where0", 1).with("where1", 2).with("order0", 3)
+	if i := trace.freeIndex("where"); i != "2" {
+		t.Errorf("expected free index 2 of where, got %s", i)
+	}
+	if i := trace.freeIndex("select"); i != "0" {
+		t.Errorf("expected free index 0 of unused key, got %s", i)
+	}
+}
+
+type joinAuthor struct {
+	ID   int
+	Name string
+}
+
+type joinTag struct {
+	ID         int
+	JoinBookID int
+	Name       string
+}
+
+type joinBook struct {
+	ID           int
+	Title        string
+	JoinAuthorID int
+	JoinAuthor   joinAuthor
+	JoinTags     []joinTag
+}
+
+// countQueries counts select statements executed by model
+func countQueries(t *testing.T, m *Model) *int {
+	t.Helper()
+	count := new(int)
+	err := m.db.Callback().Query().After("gorm:query").Register("test:count_queries", func(*gorm.DB) { *count++ })
+	if err != nil {
+		t.Fatalf("can't register counting callback: %v", err)
+	}
+	return count
+}
+
+func TestJoinPreload(t *testing.T) {
+	m := newTestModel(t, nil, &joinAuthor{}, &joinBook{}, &joinTag{})
+	book := joinBook{Title: "book", JoinAuthor: joinAuthor{Name: "author"}, JoinTags: []joinTag{{Name: "a"}, {Name: "b"}}}
+	if err := m.WithAssociations().Create(&book); err != nil {
+		t.Fatalf("can't create book: %v", err)
+	}
+	count := countQueries(t, m)
+
+	var books []joinBook
+	if err := m.JoinPreload("JoinAuthor").Find(&books); err != nil {
+		t.Fatalf("can't find books: %v", err)
+	}
+	if *count != 1 {
+		t.Errorf("expected single query for book and author, got %d", *count)
+	}
+	if len(books) != 1 || books[0].JoinAuthor.Name != "author" {
+		t.Errorf("author isn't loaded: %+v", books)
+	}
+
+	*count = 0
+	books = nil
+	if err := m.JoinPreload("JoinAuthor").Preload("JoinTags").Find(&books); err != nil {
+		t.Fatalf("can't find books: %v", err)
+	}
+	if *count != 2 {
+		t.Errorf("expected query of books with authors and query of tags, got %d", *count)
+	}
+	if len(books) != 1 || books[0].JoinAuthor.Name != "author" || len(books[0].JoinTags) != 2 {
+		t.Errorf("associations aren't loaded: %+v", books)
+	}
+}
+
+func TestJoinPreloadIsTraced(t *testing.T) {
+	m := newTestModel(t, nil)
+	c := m.JoinPreload("JoinAuthor").JoinPreload("Publisher")
+	if !c.logTrace.has("joinPreload0") || !c.logTrace.has("joinPreload1") {
+		t.Errorf("associations aren't traced: %v", c.logTrace)
+	}
+}
+
+func TestJoinsArgs(t *testing.T) {
+	m := NewDryRun(dialectPostgres)
+	var books []joinBook
+	if err := m.Joins("JOIN join_authors ON join_authors.id = join_books.join_author_id AND join_authors.name = ?", "author").Find(&books); err != nil {
+		t.Fatalf("can't build query: %v", err)
+	}
+	sql, vars := m.LastSQL()
+	if !strings.Contains(sql, "join_authors.name = $1") || len(vars) != 1 || vars[0] != "author" {
+		t.Errorf("args of joins aren't passed: %s %v", sql, vars)
+	}
+}
@@ -1,46 +1,169 @@
 package builder
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"gorm-logged/common"
 
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
 	"github.com/sirupsen/logrus"
 )
 
 // TransactionBuilder Interface for orchestrating transactions outside of model tier
 type TransactionBuilder interface {
 	Begin() *Model
+	BeginTx(opts *sql.TxOptions) *Model
 	Commit() error
 	RollbackWithError(err error) error
 	RollBack()
+	EnsureRollback()
+	SavePoint(name string) error
+	RollbackTo(name string) error
+	ReleaseSavePoint(name string) error
+	Transaction(fc func(tx *Model) error) error
+	TransactionWithRetry(fc func(tx *Model) error, opts RetryOptions) error
+	InTransaction() bool
+	SetLocal(name string, value interface{}) error
+	AsUser(ctx context.Context, userID string, fn func(tx *Model) error) error
+	TxDone() bool
+	OnCommit(fc func())
+	OnRollback(fc func())
 }
 
+// RetryOptions configures TransactionWithRetry
+type RetryOptions struct {
+	// MaxAttempts is total count of attempts, including the first one
+	MaxAttempts int
+	// Backoff is delay before the first retry, every next retry waits twice longer
+	Backoff time.Duration
+}
+
+// txState is shared between all models derived from the same transaction
+type txState struct {
+	// lastErr is the last database error happened inside transaction.
+	// Finishers replace it by common errors, so it is the only way to know real cause of failure
+	lastErr error
+	// done is set after Commit or Rollback, transaction can't be used anymore
+	done bool
+	// committed is set after successful Commit
+	committed bool
+
+	// conn is dedicated connection, transaction is opened on.
+	// Gives access to driver specific features inside transaction
+	conn *sql.Conn
+
+	// schema is search_path set by Schema inside transaction
+	schema string
+
+	// settings are set by SetLocal inside transaction, guarded by mu
+	settings map[string]string
+
+	// callbacks queued by OnCommit and OnRollback
+	mu         sync.Mutex
+	onCommit   []func()
+	onRollback []func()
+}
+
+// remember stores database error happened inside transaction, does nothing outside of transaction
+func (s *txState) remember(err error) {
+	if s == nil {
+		return
+	}
+	s.lastErr = err
+}
+
+// savePointSeq used for generating unique names of savepoints in nested Transaction calls
+var savePointSeq uint64
+
 // Begin initiate model layer as single transaction, you need to commit your changes at the end
 func (m *Model) Begin() *Model {
-	return &Model{db: m.db.Begin()}
+	return m.BeginTx(nil)
+}
+
+// BeginTx works as Begin, but allows to specify isolation level and read only mode.
+// Transaction is opened on dedicated connection, so driver specific features like CopyFrom work inside it
+func (m *Model) BeginTx(opts *sql.TxOptions) *Model {
+	state := &txState{}
+	db := m.db
+	if sqlDB, err := m.db.DB(); err == nil {
+		if conn, err := sqlDB.Conn(m.db.Statement.Context); err == nil {
+			state.conn = conn
+			db = m.db.WithContext(m.db.Statement.Context)
+			db.Statement.ConnPool = conn
+			if _, ok := m.db.Statement.ConnPool.(*simpleProtocolPool); ok {
+				db.Statement.ConnPool = &simpleProtocolPool{ConnPool: conn}
+			}
+		}
+	}
+	tx := db.Begin(opts)
+	if tx.Error != nil && state.conn != nil {
+		_ = state.conn.Close()
+		state.conn = nil
+	}
+	// transaction inherits settings of chain, but not its trace and preloads
+	c := m.chain(tx, nil)
+	c.preloads = nil
+	c.tx = state
+	if m.op != "" {
+		c.logTrace = c.logTrace.with("operation", m.op)
+	}
+	for _, e := range m.logTrace {
+		if strings.HasPrefix(e.Key, logFieldPrefix) {
+			c.logTrace = c.logTrace.with(e.Key, e.Value)
+		}
+	}
+	if m.schema != "" && tx.Error == nil {
+		return c.Schema(m.schema)
+	}
+	return c
+}
+
+// InTransaction reports whether model is bound to opened transaction
+func (m *Model) InTransaction() bool {
+	return m.tx != nil && !m.tx.done
+}
+
+// TxDone reports whether Commit or Rollback was already called for transaction of model
+func (m *Model) TxDone() bool {
+	return m.tx != nil && m.tx.done
 }
 
 // Commit stories changes of transaction
 func (m *Model) Commit() error {
+	if m.tx == nil {
+		m.logError("commit called outside of transaction", nil, logrus.Fields{"trace": m.frames()})
+		return common.ErrNoTransaction
+	}
 	if err := m.db.Commit().Error; err != nil {
-		logrus.WithError(err).Error("can't commit transaction")
-		return common.ErrInternal
+		m.tx.remember(err)
+		m.finishTx(false)
+		return m.fail("commit", "can't commit transaction", err)
 	}
+	m.finishTx(true)
 	return nil
 }
 
 // RollbackWithError skips changes from transaction exempts connection
 func (m *Model) RollbackWithError(err error) error {
+	defer m.finishTx(false)
 	if err := m.db.Rollback().Error; err != nil {
-		logrus.WithError(err).Error("can't rollback transaction")
+		m.logError("can't rollback transaction", err)
 	}
 	return err
 }
 
 // RollBack skips changes from transaction exempts connection
 func (m *Model) RollBack() {
+	defer m.finishTx(false)
 	err := m.db.Rollback().Error
 	if err == nil {
 		return
@@ -48,5 +171,208 @@ func (m *Model) RollBack() {
 	if errors.Is(err, sql.ErrTxDone) {
 		return
 	}
-	logrus.WithError(err).Error("can't rollback transaction")
+	m.logError("can't rollback transaction", err)
+}
+
+// EnsureRollback rollbacks transaction unless it was committed.
+// Designed for deferring right after Begin, so panic in between doesn't leak connection:
+//
+//	tx := m.Begin()
+//	defer tx.EnsureRollback()
+func (m *Model) EnsureRollback() {
+	if !m.InTransaction() {
+		return
+	}
+	m.RollBack()
+}
+
+// OnCommit queues fc to be called after successful Commit of transaction.
+// Callbacks are called in order of queueing, panic of one doesn't prevent others.
+// Rollback discards queued callbacks. Outside of transaction fc is called immediately,
+// because all changes are already persisted.
+func (m *Model) OnCommit(fc func()) {
+	if m.tx == nil {
+		m.runTxCallback(fc)
+		return
+	}
+	m.tx.mu.Lock()
+	defer m.tx.mu.Unlock()
+	m.tx.onCommit = append(m.tx.onCommit, fc)
+}
+
+// OnRollback queues fc to be called after Rollback or failed Commit of transaction.
+// Does nothing outside of transaction.
+func (m *Model) OnRollback(fc func()) {
+	if m.tx == nil {
+		return
+	}
+	m.tx.mu.Lock()
+	defer m.tx.mu.Unlock()
+	m.tx.onRollback = append(m.tx.onRollback, fc)
+}
+
+// finishTx marks transaction as done and runs callbacks queued for its outcome.
+// Does nothing outside of transaction
+func (m *Model) finishTx(committed bool) {
+	if m.tx == nil {
+		return
+	}
+	m.tx.mu.Lock()
+	m.tx.done = true
+	m.tx.committed = m.tx.committed || committed
+	callbacks := m.tx.onRollback
+	if committed {
+		callbacks = m.tx.onCommit
+	}
+	m.tx.onCommit, m.tx.onRollback = nil, nil
+	conn := m.tx.conn
+	m.tx.conn = nil
+	m.tx.mu.Unlock()
+
+	if conn != nil {
+		if err := conn.Close(); err != nil {
+			m.logError("can't release transaction connection", err)
+		}
+	}
+
+	for _, fc := range callbacks {
+		m.runTxCallback(fc)
+	}
+}
+
+// runTxCallback calls fc, recovers and logs its panic
+func (m *Model) runTxCallback(fc func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			m.logError("transaction callback panicked", nil, logrus.Fields{
+				"panic": r,
+				"trace": m.frames(),
+			})
+		}
+	}()
+	fc()
+}
+
+// SavePoint marks current state of transaction, which can be restored later by RollbackTo.
+// Name must be unquoted identifier
+func (m *Model) SavePoint(name string) error {
+	return m.execSavePoint("savePoint", "can't create savepoint", "SAVEPOINT", name)
+}
+
+// RollbackTo skips changes of transaction made after savepoint with given name
+func (m *Model) RollbackTo(name string) error {
+	return m.execSavePoint("rollbackTo", "can't rollback to savepoint", "ROLLBACK TO SAVEPOINT", name)
+}
+
+// ReleaseSavePoint forgets savepoint with given name, changes made after it are kept
+func (m *Model) ReleaseSavePoint(name string) error {
+	return m.execSavePoint("releaseSavePoint", "can't release savepoint", "RELEASE SAVEPOINT", name)
+}
+
+// execSavePoint executes statement of savepoint with given name
+func (m *Model) execSavePoint(op, msg, statement, name string) error {
+	fields := logrus.Fields{
+		"savePointName": name,
+		"trace":         m.frames(),
+	}
+	if !pgIdentifier.MatchString(name) {
+		return m.fail(op, msg, fmt.Errorf("invalid savepoint name %q", name), fields)
+	}
+	// postgres and sqlite dialectors of gorm drop errors of savepoints, so statement is executed directly
+	if err := m.db.Exec(statement + " " + name).Error; err != nil {
+		m.tx.remember(err)
+		return m.fail(op, msg, err, fields)
+	}
+	return nil
+}
+
+// Transaction runs fc inside transaction, commits on success and rollbacks on error or panic.
+// If model is already transactional, the scope of fc is wrapped into auto named savepoint instead,
+// so failure of fc rollbacks only changes made by fc itself.
+func (m *Model) Transaction(fc func(tx *Model) error) error {
+	_, err := m.transaction(fc)
+	return err
+}
+
+// TransactionWithRetry works as Transaction, but reruns fc in a fresh transaction
+// when it fails by serialization failure or deadlock.
+// Nested calls are not retried, because such errors abort the whole outer transaction.
+func (m *Model) TransactionWithRetry(fc func(tx *Model) error, opts RetryOptions) error {
+	if m.InTransaction() {
+		return m.Transaction(fc)
+	}
+	backoff := opts.Backoff
+	for attempt := 1; ; attempt++ {
+		tx, err := m.transaction(fc)
+		if err == nil || attempt >= opts.MaxAttempts {
+			return err
+		}
+		if !isRetryable(err) && (tx == nil || !isRetryable(tx.lastErr)) {
+			return err
+		}
+		m.logWarn("transaction failed by concurrent update, retrying", err, logrus.Fields{
+			"attempt":     attempt,
+			"maxAttempts": opts.MaxAttempts,
+			"backoff":     backoff.String(),
+		})
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// transaction is implementation of Transaction, returns state of created transaction for error inspection
+func (m *Model) transaction(fc func(tx *Model) error) (state *txState, err error) {
+	panicked := true
+
+	if m.InTransaction() {
+		name := "sp" + strconv.FormatUint(atomic.AddUint64(&savePointSeq, 1), 10)
+		if err := m.SavePoint(name); err != nil {
+			return m.tx, err
+		}
+		defer func() {
+			if !panicked && err == nil {
+				err = m.ReleaseSavePoint(name)
+				return
+			}
+			// failed rollback leaves outer transaction aborted, so its error is returned along with error of fc
+			if rollbackErr := m.RollbackTo(name); rollbackErr != nil {
+				err = errors.Join(err, rollbackErr)
+			}
+		}()
+		err = fc(m)
+		panicked = false
+		return m.tx, err
+	}
+
+	tx := m.Begin()
+	if err := tx.db.Error; err != nil {
+		return nil, m.fail("begin", "can't begin transaction", err, logrus.Fields{
+			"trace": m.frames(),
+		})
+	}
+	defer func() {
+		if panicked || err != nil {
+			tx.RollBack()
+		}
+	}()
+	if err = fc(tx); err != nil {
+		panicked = false
+		return tx.tx, err
+	}
+	panicked = false
+	return tx.tx, tx.Commit()
+}
+
+// isRetryable reports whether err is caused by serialization failure or deadlock
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		// deadlock found and lock wait timeout
+		return mysqlErr.Number == 1213 || mysqlErr.Number == 1205
+	}
+	return false
 }
@@ -0,0 +1,220 @@
+package builder
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+type txNode struct {
+	ID   int
+	Name string
+}
+
+// txNodeNames returns names of all nodes ordered by id
+func txNodeNames(t *testing.T, m *Model) []string {
+	t.Helper()
+	var names []string
+	if err := m.Model(&txNode{}).Order("id").Pluck("name", &names); err != nil {
+		t.Fatalf("can't pluck names: %v", err)
+	}
+	return names
+}
+
+func TestNestedTransactionRollbacksInnerScope(t *testing.T) {
+	m := newTestModel(t, nil, &txNode{})
+	failure := errors.New("inner failure")
+	err := m.Transaction(func(tx *Model) error {
+		if err := tx.Create(&txNode{Name: "outer"}); err != nil {
+			return err
+		}
+		innerErr := tx.Transaction(func(tx *Model) error {
+			if err := tx.Create(&txNode{Name: "inner"}); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(innerErr, failure) {
+			t.Errorf("expected error of inner scope, got %v", innerErr)
+		}
+		return tx.Create(&txNode{Name: "after"})
+	})
+	if err != nil {
+		t.Fatalf("outer transaction failed: %v", err)
+	}
+	if names := txNodeNames(t, m); len(names) != 2 || names[0] != "outer" || names[1] != "after" {
+		t.Errorf("expected writes of outer scope only, got %v", names)
+	}
+}
+
+func TestSavePoint(t *testing.T) {
+	m := newTestModel(t, nil, &txNode{})
+	tx := m.Begin()
+	defer tx.EnsureRollback()
+	if err := tx.Create(&txNode{Name: "kept"}); err != nil {
+		t.Fatalf("can't create node: %v", err)
+	}
+	if err := tx.SavePoint("before_skipped"); err != nil {
+		t.Fatalf("can't create savepoint: %v", err)
+	}
+	if err := tx.Create(&txNode{Name: "skipped"}); err != nil {
+		t.Fatalf("can't create node: %v", err)
+	}
+	if err := tx.RollbackTo("before_skipped"); err != nil {
+		t.Fatalf("can't rollback to savepoint: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("can't commit: %v", err)
+	}
+	if names := txNodeNames(t, m); len(names) != 1 || names[0] != "kept" {
+		t.Errorf("expected node created before savepoint only, got %v", names)
+	}
+}
+
+func TestRollbackToUnknownSavePoint(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &txNode{})
+	tx := m.Begin()
+	defer tx.EnsureRollback()
+	if err := tx.RollbackTo("missing"); err == nil {
+		t.Fatal("expected error of unknown savepoint")
+	}
+	entries := entriesAt(hook, logrus.ErrorLevel)
+	if len(entries) != 1 {
+		t.Fatalf("expected single error log, got %d", len(entries))
+	}
+	if entries[0].Data["savePointName"] != "missing" || entries[0].Data["trace"] == nil {
+		t.Errorf("savepoint name and trace aren't logged: %v", entries[0].Data)
+	}
+	if tx.tx.lastErr == nil {
+		t.Error("error of savepoint isn't remembered by transaction")
+	}
+}
+
+func TestSavePointRejectsInvalidName(t *testing.T) {
+	conn := &recordingTxConn{}
+	m, hook := newRecordingTxModel(t, conn)
+	tx := m.Begin()
+	defer tx.EnsureRollback()
+	if err := tx.SavePoint("sp; DROP TABLE tx_nodes"); err == nil {
+		t.Error("expected error of invalid savepoint name")
+	}
+	if len(conn.statements) != 0 {
+		t.Errorf("invalid savepoint name is sent: %q", conn.statements)
+	}
+	if len(entriesAt(hook, logrus.ErrorLevel)) != 1 {
+		t.Errorf("invalid savepoint name isn't logged: %v", hook.AllEntries())
+	}
+}
+
+func TestNestedTransactionReleasesSavePoint(t *testing.T) {
+	conn := &recordingTxConn{}
+	m, _ := newRecordingTxModel(t, conn)
+	err := m.Transaction(func(tx *Model) error {
+		return tx.Transaction(func(*Model) error { return nil })
+	})
+	if err != nil {
+		t.Fatalf("transaction failed: %v", err)
+	}
+	if len(conn.statements) != 2 || !strings.HasPrefix(conn.statements[0], "SAVEPOINT sp") ||
+		conn.statements[1] != "RELEASE "+conn.statements[0] {
+		t.Errorf("unexpected statements: %q", conn.statements)
+	}
+}
+
+func TestNestedTransactionReturnsRollbackError(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &txNode{})
+	failure := errors.New("inner failure")
+	var innerErr error
+	_ = m.Transaction(func(tx *Model) error {
+		innerErr = tx.Transaction(func(tx *Model) error {
+			// savepoint is lost by commit, so rollback to it fails
+			if err := tx.exec("COMMIT"); err != nil {
+				return err
+			}
+			return failure
+		})
+		return innerErr
+	})
+	if !errors.Is(innerErr, failure) || !errors.Is(innerErr, common.ErrInternal) {
+		t.Errorf("expected error of inner scope joined with error of rollback, got %v", innerErr)
+	}
+	var rollbackLogged bool
+	for _, entry := range entriesAt(hook, logrus.ErrorLevel) {
+		rollbackLogged = rollbackLogged || entry.Message == "can't rollback to savepoint"
+	}
+	if !rollbackLogged {
+		t.Errorf("failed rollback isn't logged: %v", hook.AllEntries())
+	}
+}
+
+func TestEnsureRollbackReleasesConnectionOnPanic(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &txNode{})
+	inUse := m.Stats().InUse
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic")
+			}
+		}()
+		tx := m.Begin()
+		defer tx.EnsureRollback()
+		if err := tx.Create(&txNode{Name: "rolled back"}); err != nil {
+			t.Fatalf("can't create node: %v", err)
+		}
+		if m.Stats().InUse != inUse+1 {
+			t.Fatalf("transaction doesn't hold connection, %d in use", m.Stats().InUse)
+		}
+		panic("failure")
+	}()
+
+	if got := m.Stats().InUse; got != inUse {
+		t.Errorf("connection isn't returned to pool, %d in use before and %d after", inUse, got)
+	}
+	if names := txNodeNames(t, m); len(names) != 0 {
+		t.Errorf("changes of transaction aren't rolled back: %v", names)
+	}
+	if entries := entriesAt(hook, logrus.ErrorLevel); len(entries) != 0 {
+		t.Errorf("unexpected error log %q", entries[0].Message)
+	}
+}
+
+func TestTransactionReleasesConnectionOnPanic(t *testing.T) {
+	m := newTestModel(t, nil, &txNode{})
+	inUse := m.Stats().InUse
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic")
+			}
+		}()
+		_ = m.Transaction(func(tx *Model) error {
+			panic("failure")
+		})
+	}()
+	if got := m.Stats().InUse; got != inUse {
+		t.Errorf("connection isn't returned to pool, %d in use before and %d after", inUse, got)
+	}
+}
+
+func TestEnsureRollbackAfterCommit(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &txNode{})
+	tx := m.Begin()
+	if err := tx.Create(&txNode{Name: "committed"}); err != nil {
+		t.Fatalf("can't create node: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("can't commit: %v", err)
+	}
+	tx.EnsureRollback()
+	if names := txNodeNames(t, m); len(names) != 1 {
+		t.Errorf("committed changes are lost: %v", names)
+	}
+	if entries := hook.AllEntries(); len(entries) != 0 {
+		t.Errorf("unexpected log %q", entries[0].Message)
+	}
+}
@@ -0,0 +1,103 @@
+// Tests are declared outside of the package, since frames of the package are left out of traces
+package builder_test
+
+import (
+	"strings"
+	"testing"
+
+	builder "gorm-logged"
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+type workerNode struct {
+	ID int
+}
+
+// runWorker executes chain as background worker does
+func runWorker(chain *builder.Model) error {
+	var nodes []workerNode
+	return chain.Find(&nodes)
+}
+
+// loggedFrames returns frames logged under key by the only error log of hook
+func loggedFrames(t *testing.T, hook *test.Hook, key string) common.Frames {
+	t.Helper()
+	entry := hook.LastEntry()
+	if entry == nil || entry.Level != logrus.ErrorLevel {
+		t.Fatalf("failure isn't logged: %v", hook.AllEntries())
+	}
+	frames, ok := entry.Data[key].(common.LazyFrames)
+	if !ok {
+		t.Fatalf("%s isn't logged: %v", key, entry.Data)
+	}
+	return frames.Frames()
+}
+
+// hasFrame reports whether frames contain function, which name contains name
+func hasFrame(frames common.Frames, name string) bool {
+	for _, frame := range frames {
+		if strings.Contains(frame.Function, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBuildTraceOfBackgroundWorker(t *testing.T) {
+	m, hook := newLoggedModel(t, []builder.Option{builder.CaptureBuildTrace(true)}, &workerNode{})
+	chain := m.Where("no_such_column = ?", 1)
+
+	errs := make(chan error)
+	go func() {
+		errs <- runWorker(chain)
+	}()
+	if err := <-errs; err == nil {
+		t.Fatal("expected error of unknown column")
+	}
+
+	if _, ok := hook.LastEntry().Data["trace"]; ok {
+		t.Error("distinct traces are logged as single trace")
+	}
+	build := loggedFrames(t, hook, "buildTrace")
+	exec := loggedFrames(t, hook, "execTrace")
+	if !hasFrame(build, "TestBuildTraceOfBackgroundWorker") || hasFrame(build, "runWorker") {
+		t.Errorf("buildTrace doesn't point to chainer: %v", build)
+	}
+	if !hasFrame(exec, "runWorker") {
+		t.Errorf("execTrace doesn't point to finisher: %v", exec)
+	}
+}
+
+func TestBuildTraceOfSameCall(t *testing.T) {
+	m, hook := newLoggedModel(t, []builder.Option{builder.CaptureBuildTrace(true)}, &workerNode{})
+	var nodes []workerNode
+	if err := m.Where("no_such_column = ?", 1).Find(&nodes); err == nil {
+		t.Fatal("expected error of unknown column")
+	}
+	loggedFrames(t, hook, "trace")
+	if _, ok := hook.LastEntry().Data["buildTrace"]; ok {
+		t.Error("the same trace is logged twice")
+	}
+}
+
+func TestBuildTraceIsDisabledByDefault(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &workerNode{})
+	chain := m.Where("no_such_column = ?", 1)
+	errs := make(chan error)
+	go func() {
+		errs <- runWorker(chain)
+	}()
+	if err := <-errs; err == nil {
+		t.Fatal("expected error of unknown column")
+	}
+	exec := loggedFrames(t, hook, "trace")
+	if !hasFrame(exec, "runWorker") {
+		t.Errorf("trace doesn't point to finisher: %v", exec)
+	}
+	if _, ok := hook.LastEntry().Data["buildTrace"]; ok {
+		t.Error("buildTrace is captured by default")
+	}
+}
@@ -0,0 +1,177 @@
+package builder
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Cache stores results of read finishers of Cached chains, see WithCache.
+// Keys look like "table:hash", so pattern "countries:*" matches all cached results of countries table
+type Cache interface {
+	// Get returns cached value, false when key is missing or expired
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Invalidate removes values with keys matching pattern, where * matches any sequence of characters
+	Invalidate(ctx context.Context, pattern string) error
+}
+
+// Cached is gorm extension. Serves First, Last, Take and Find of chain from cache configured by WithCache
+// for ttl, so the same query isn't run again till then. Result is cached by generated sql and its vars,
+// errors of cache fall back to database
+func (m *Model) Cached(ttl time.Duration) *Model {
+	trace := m.logTrace.with("cachedTTL", ttl.String())
+	c := m.chain(m.db, trace)
+	c.cacheTTL = ttl
+	return c
+}
+
+// InvalidateCache removes cached results with keys matching pattern, as example "countries:*" after countries are changed.
+// Does nothing without WithCache
+func (m *Model) InvalidateCache(pattern string) error {
+	if m.cfg.cache == nil {
+		return nil
+	}
+	if err := m.cfg.cache.Invalidate(m.db.Statement.Context, pattern); err != nil {
+		m.logWarn("can't invalidate cached results", err, logrus.Fields{"cachePattern": pattern})
+		return fmt.Errorf("can't invalidate cached results: %w", err)
+	}
+	return nil
+}
+
+// fromCache reads result of finisher op into out from cache, returns key to store result by and whether result is served.
+// query builds the same query as finisher does, it is run in dry run mode to get sql
+func (m *Model) fromCache(op string, out interface{}, query func(db *gorm.DB) *gorm.DB) (string, bool) {
+	if m.cacheTTL <= 0 {
+		return "", false
+	}
+	if m.cfg.cache == nil {
+		m.logDebug("chain is cached, but cache isn't configured by WithCache", nil)
+		return "", false
+	}
+	stmt := query(m.db.Session(&gorm.Session{DryRun: true})).Statement
+	if stmt.Error != nil {
+		m.logDebug("can't build cache key of query", stmt.Error)
+		return "", false
+	}
+	preloads := make([]string, 0, len(m.preloads))
+	for _, p := range m.preloads {
+		preloads = append(preloads, fmt.Sprintf("%s%#v", p.field, p.conditions))
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s|%T|%s|%#v|%v|%v|%v",
+		op, out, stmt.SQL.String(), stmt.Vars, preloads, m.limitedPreloads, m.counts)))
+	key := stmt.Table + ":" + hex.EncodeToString(hash[:])
+
+	data, ok, err := m.cfg.cache.Get(m.db.Statement.Context, key)
+	if err != nil {
+		m.logDebug("can't get cached result, querying database", err, logrus.Fields{"cacheKey": key})
+		return key, false
+	}
+	if !ok {
+		return key, false
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		m.logDebug("can't decode cached result, querying database", err, logrus.Fields{"cacheKey": key})
+		return key, false
+	}
+	return key, true
+}
+
+// toCache stores result of finisher by key of fromCache, does nothing for empty key
+func (m *Model) toCache(key string, out interface{}) {
+	if key == "" {
+		return
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		m.logDebug("can't encode result for cache", err, logrus.Fields{"cacheKey": key})
+		return
+	}
+	if err := m.cfg.cache.Set(m.db.Statement.Context, key, data, m.cacheTTL); err != nil {
+		m.logDebug("can't cache result", err, logrus.Fields{"cacheKey": key})
+	}
+}
+
+// LRUCache is in memory Cache, which evicts least recently used values above its size
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// lruEntry is value of LRUCache
+type lruEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+// NewLRUCache creates in memory cache of at most size values
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{size: size, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// Get is Cache func
+func (c *LRUCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := e.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(e)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(e)
+	return entry.value, true, nil
+}
+
+// Set is Cache func
+func (c *LRUCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &lruEntry{key: key, value: value, expiresAt: time.Now().Add(ttl)}
+	if e, ok := c.entries[key]; ok {
+		e.Value = entry
+		c.order.MoveToFront(e)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// Invalidate is Cache func
+func (c *LRUCache) Invalidate(_ context.Context, pattern string) error {
+	re, err := regexp.Compile("^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$")
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		if re.MatchString(key) {
+			c.order.Remove(e)
+			delete(c.entries, key)
+		}
+	}
+	return nil
+}
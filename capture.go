@@ -0,0 +1,101 @@
+package builder
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// captureCallback is name of gorm callback which captures sql of failed queries and accounts queries into QueryStats
+const captureCallback = "gorm-logged:capture_sql"
+
+// beforeCallback is name of gorm callback which checks queries of chain before execution
+const beforeCallback = "gorm-logged:before"
+
+// queryKey is context key of query run by finisher
+type queryKey struct{}
+
+// tracedQuery is stashed into context of finisher query.
+// Gives access to trace of chain for gorm logger and to sql of failed query, which gorm resets after execution
+type tracedQuery struct {
+	m    *Model
+	sql  string
+	vars []interface{}
+	// table is table of failed query, chains may get their model only by finisher
+	table string
+	// stmt is statement of the last executed query, gorm logger reads its sql and vars before gorm resets them
+	stmt *gorm.Statement
+	// elapsed is duration of failed query, set by gorm logger
+	elapsed time.Duration
+}
+
+// traced returns gorm instance with query stashed into context
+func (m *Model) traced() *gorm.DB {
+	return m.db.WithContext(context.WithValue(m.db.Statement.Context, queryKey{}, &tracedQuery{m: m}))
+}
+
+// registerCallbacks registers callbacks of the package, already registered ones are kept
+func registerCallbacks(db *gorm.DB) error {
+	capture := func(db *gorm.DB) {
+		statsAfter(db)
+		q, ok := db.Statement.Context.Value(queryKey{}).(*tracedQuery)
+		if !ok {
+			return
+		}
+		q.stmt = db.Statement
+		if db.Error == nil {
+			return
+		}
+		q.sql = db.Statement.SQL.String()
+		q.vars = redactVars(db.Statement, q.m.cfg.redactedFields)
+		q.table = db.Statement.Table
+	}
+	callbacks := db.Callback()
+	if callbacks.Query().Get(captureCallback) != nil {
+		return nil
+	}
+	for _, err := range []error{
+		callbacks.Create().After("*").Register(captureCallback, capture),
+		callbacks.Query().After("*").Register(captureCallback, capture),
+		callbacks.Update().After("*").Register(captureCallback, capture),
+		callbacks.Delete().After("*").Register(captureCallback, capture),
+		callbacks.Row().After("*").Register(captureCallback, capture),
+		callbacks.Raw().After("*").Register(captureCallback, capture),
+
+		callbacks.Create().Before("*").Register(beforeCallback, before),
+		callbacks.Query().Before("*").Register(beforeCallback, before),
+		callbacks.Update().Before("*").Register(beforeCallback, before),
+		callbacks.Delete().Before("*").Register(beforeCallback, before),
+		callbacks.Row().Before("*").Register(beforeCallback, before),
+		callbacks.Raw().Before("*").Register(beforeCallback, before),
+		callbacks.Create().After("*").Register(breakerCallback, breakerAfter),
+		callbacks.Query().After("*").Register(breakerCallback, breakerAfter),
+		callbacks.Update().After("*").Register(breakerCallback, breakerAfter),
+		callbacks.Delete().After("*").Register(breakerCallback, breakerAfter),
+		callbacks.Row().After("*").Register(breakerCallback, breakerAfter),
+		callbacks.Raw().After("*").Register(breakerCallback, breakerAfter),
+
+		callbacks.Create().After("gorm:create").Register(auditCallback, audit("create")),
+		callbacks.Update().After("gorm:update").Register(auditCallback, audit("update")),
+		callbacks.Delete().After("gorm:delete").Register(auditCallback, audit("delete")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// before checks query of chain before execution: requires schema, qualifies table by it and consults circuit breaker.
+// Starts accounting of query into QueryStats of context
+func before(db *gorm.DB) {
+	statsBefore(db)
+	q, ok := db.Statement.Context.Value(queryKey{}).(*tracedQuery)
+	if !ok {
+		return
+	}
+	requireSchema(db, q)
+	qualifySchema(db, q)
+	breakerBefore(db, q)
+}
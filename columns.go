@@ -0,0 +1,71 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm-logged/common"
+
+	"gorm.io/gorm/clause"
+)
+
+// SelectColumns is gorm extension. Selects requested fields, which are mapped to column expressions by allowed,
+// so client input never reaches sql as is. Unknown fields fail finishers of chain with common.ErrBadField
+func (m *Model) SelectColumns(allowed map[string]string, requested []string) *Model {
+	columns, trace, err := m.allowedColumns("selectColumns", "SelectColumns", allowed, requested)
+	if err != nil {
+		return m.chain(m.db, trace).failed(err)
+	}
+	if len(columns) == 0 {
+		return m.chain(m.db, trace)
+	}
+	return m.chain(m.db.Clauses(clause.Select{Columns: columns}), trace)
+}
+
+// GroupByColumns is gorm extension. Groups by requested fields, which are mapped to column expressions by allowed,
+// so client input never reaches sql as is. Unknown fields fail finishers of chain with common.ErrBadField
+func (m *Model) GroupByColumns(allowed map[string]string, requested []string) *Model {
+	columns, trace, err := m.allowedColumns("groupByColumns", "GroupByColumns", allowed, requested)
+	if err != nil {
+		return m.chain(m.db, trace).failed(err)
+	}
+	if len(columns) == 0 {
+		return m.chain(m.db, trace)
+	}
+	return m.chain(m.db.Clauses(clause.GroupBy{Columns: columns}), trace)
+}
+
+// allowedColumns maps requested fields to columns by allowed, requested, accepted and rejected fields are added
+// to trace with keys like selectColumns0, acceptedSelectColumns0 and rejectedSelectColumns0.
+// Returns error wrapping common.ErrBadField for unknown fields
+func (m *Model) allowedColumns(key, suffix string, allowed map[string]string, requested []string) ([]clause.Column, chainTrace, error) {
+	var (
+		columns  []clause.Column
+		accepted []string
+		rejected []string
+	)
+	for _, field := range requested {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		column, ok := allowed[field]
+		if !ok {
+			rejected = append(rejected, field)
+			continue
+		}
+		columns = append(columns, clause.Column{Name: column, Raw: true})
+		accepted = append(accepted, column)
+	}
+
+	i := m.logTrace.freeIndex(key)
+	trace := m.logTrace.with(key+i, requested)
+	if len(accepted) > 0 {
+		trace = trace.with("accepted"+suffix+i, accepted)
+	}
+	if len(rejected) > 0 {
+		trace = trace.with("rejected"+suffix+i, rejected)
+		return nil, trace, fmt.Errorf("%w: %s", common.ErrBadField, strings.Join(rejected, ", "))
+	}
+	return columns, trace, nil
+}
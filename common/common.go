@@ -1,16 +1,162 @@
 package common
 
 import (
+	"encoding/json"
 	"errors"
-	"runtime"
+	"strconv"
 	"strings"
 )
 
 var (
-	ErrInternal = errors.New("internal server error")
-	ErrNotFound = errors.New("not found")
+	ErrInternal      = errors.New("internal server error")
+	ErrNotFound      = errors.New("not found")
+	ErrNoTransaction = errors.New("no transaction")
+	ErrDuplicate     = errors.New("already exists")
+
+	ErrForeignKey     = errors.New("referenced object doesn't exist or is still referenced")
+	ErrNotNull        = errors.New("required value is missing")
+	ErrCheckViolation = errors.New("value is not valid")
+	ErrBadSort        = errors.New("sorting by requested field is not supported")
+	ErrBadField       = errors.New("requested field is not supported")
+
+	ErrCanceled    = errors.New("request is canceled")
+	ErrTimeout     = errors.New("request timed out")
+	ErrUnavailable = errors.New("database is unavailable")
+
+	ErrDestructiveNotAllowed = errors.New("destructive operation is not allowed")
+	ErrUnsupportedDialect    = errors.New("operation is not supported by database dialect")
 )
 
+// NotFoundError is ErrNotFound with details of what wasn't found, matches ErrNotFound by errors.Is
+type NotFoundError struct {
+	// Entity is type name of searched object
+	Entity string
+	// Query is sql of search
+	Query string
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Entity == "" {
+		return ErrNotFound.Error()
+	}
+	return e.Entity + " " + ErrNotFound.Error()
+}
+
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// InternalError is ErrInternal with reference, which is logged together with the cause.
+// Matches ErrInternal by errors.Is, the cause is reachable by errors.As
+type InternalError struct {
+	// Ref is short random reference of error log, can be shown to end user
+	Ref string
+	// Err is the cause
+	Err error
+}
+
+func (e *InternalError) Error() string {
+	return ErrInternal.Error() + ", reference " + e.Ref
+}
+
+func (e *InternalError) Is(target error) bool {
+	return target == ErrInternal
+}
+
+func (e *InternalError) Unwrap() error {
+	return e.Err
+}
+
+// ConstraintError is violation of constraint with friendly message registered by WithConstraintMessages option.
+// Matches common error of the violation by errors.Is, the cause is reachable by errors.As
+type ConstraintError struct {
+	// Constraint is name of violated constraint, or table and column as "table.column"
+	Constraint string
+	// Msg is registered message, can be shown to end user
+	Msg string
+	// Err is common error of the violation
+	Err error
+}
+
+func (e *ConstraintError) Error() string {
+	return e.Err.Error()
+}
+
+// Message returns registered message of violated constraint
+func (e *ConstraintError) Message() string {
+	return e.Msg
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// FingerprintedError is error of failed finisher with fingerprint of the failure,
+// failures of the same call site, table and kind of error have the same fingerprint
+type FingerprintedError struct {
+	Err error
+	// Print is the fingerprint
+	Print string
+}
+
+func (e *FingerprintedError) Error() string {
+	return e.Err.Error()
+}
+
+// Fingerprint returns fingerprint of the failure, which is logged as "fingerprint" field
+func (e *FingerprintedError) Fingerprint() string {
+	return e.Print
+}
+
+func (e *FingerprintedError) Unwrap() error {
+	return e.Err
+}
+
+// Fingerprint returns fingerprint of error returned by finisher, empty string for other errors
+func Fingerprint(err error) string {
+	var fingerprinted *FingerprintedError
+	if errors.As(err, &fingerprinted) {
+		return fingerprinted.Print
+	}
+	return ""
+}
+
+// wrappedError is common error which keeps original cause reachable by errors.Is and errors.As
+type wrappedError struct {
+	common error
+	cause  error
+}
+
+// Wrap returns error which matches common error by errors.Is and keeps cause reachable by errors.As.
+// Message is message of common error only, so the result still can be passed to end user
+func Wrap(common, cause error) error {
+	if cause == nil {
+		return common
+	}
+	return &wrappedError{common: common, cause: cause}
+}
+
+func (e *wrappedError) Error() string {
+	return e.common.Error()
+}
+
+func (e *wrappedError) Unwrap() []error {
+	return []error{e.common, e.cause}
+}
+
+// Unwrap returns original cause of error returned by Wrap or of InternalError, err itself for other errors
+func Unwrap(err error) error {
+	var wrapped *wrappedError
+	if errors.As(err, &wrapped) {
+		return wrapped.cause
+	}
+	var internal *InternalError
+	if errors.As(err, &internal) {
+		return internal.Err
+	}
+	return err
+}
+
 // Frame is short format of runtime.Frime
 type Frame struct {
 	Function string
@@ -18,34 +164,52 @@ type Frame struct {
 	Line     int
 }
 
-// GetFrames function for retrieve calling trace,
-// can be used if you want to write calling trace to log
-func GetFrames() []Frame {
-	const projectName = "myProject" // should be according to your project name
-
-	maxLength := make([]uintptr, 99)
-	// skip firs 2 callers which is "runtime.Callers" and common.GetFrames
-	n := runtime.Callers(2, maxLength)
-
-	var res []Frame
-	if n > 0 {
-		frames := runtime.CallersFrames(maxLength[:n])
-		for more, frameIndex := true, 0; more; frameIndex++ {
-
-			var frameCandidate runtime.Frame
-			frameCandidate, more = frames.Next()
-
-			// skip tracing when called function not from our project (as example external dependency gin, urfaveCli)
-			if !strings.Contains(frameCandidate.Function, projectName) {
-				break
-			}
-			res = append(res, Frame{
-				Function: frameCandidate.Function,
-				File:     frameCandidate.File,
-				Line:     frameCandidate.Line,
-			})
+// String prints frame compactly as function without package path and file trimmed to two last segments,
+// as example "orders.(*Service).Get orders/service.go:123"
+func (f Frame) String() string {
+	function := f.Function
+	if i := strings.LastIndex(function, "/"); i >= 0 {
+		function = function[i+1:]
+	}
+	file := f.File
+	if i := strings.LastIndex(file, "/"); i >= 0 {
+		if j := strings.LastIndex(file[:i], "/"); j >= 0 {
+			file = file[j+1:]
 		}
 	}
+	return function + " " + file + ":" + strconv.Itoa(f.Line)
+}
+
+// Frames is calling trace, which is marshaled to json as array of compact frames, see Frame.String
+type Frames []Frame
 
+// Strings returns compact frames
+func (f Frames) Strings() []string {
+	res := make([]string, 0, len(f))
+	for _, frame := range f {
+		res = append(res, frame.String())
+	}
 	return res
 }
+
+func (f Frames) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Strings())
+}
+
+// defaultMaxFrames is count of calling frames scanned by GetFrames
+const defaultMaxFrames = 99
+
+// GetFrames function for retrieve calling trace,
+// can be used if you want to write calling trace to log.
+// Trace contains project frames, see SetFrameFilter, and frames of this module
+func GetFrames() []Frame {
+	// skip GetFrames itself
+	return GetFramesSkip(1, defaultMaxFrames)
+}
+
+// GetFramesSkip returns calling trace like GetFrames, skipping first skip frames, where 0 is the caller
+// of GetFramesSkip. Up to max frames are scanned, frames which aren't kept by filter are left out
+func GetFramesSkip(skip, max int) []Frame {
+	// skip GetFramesSkip
+	return CaptureFrames(skip+1, max).Frames()
+}
@@ -0,0 +1,34 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	cause := errors.New("pq: duplicate key value")
+	err := Wrap(ErrDuplicate, cause)
+	if !errors.Is(err, ErrDuplicate) || !errors.Is(err, cause) {
+		t.Errorf("wrapped error doesn't match common error and cause: %v", err)
+	}
+	if err.Error() != ErrDuplicate.Error() {
+		t.Errorf("message of cause leaks: %s", err)
+	}
+	if Unwrap(fmt.Errorf("%w: users_email_key", err)) != cause {
+		t.Error("cause isn't returned by Unwrap")
+	}
+	if Wrap(ErrDuplicate, nil) != ErrDuplicate {
+		t.Error("wrapping of nil cause isn't common error itself")
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	cause := errors.New("connection reset")
+	if got := Unwrap(&InternalError{Ref: "ABC123", Err: cause}); got != cause {
+		t.Errorf("cause of internal error isn't returned, got %v", got)
+	}
+	if got := Unwrap(ErrNotFound); got != ErrNotFound {
+		t.Errorf("error without cause isn't returned as is, got %v", got)
+	}
+}
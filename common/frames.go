@@ -0,0 +1,82 @@
+package common
+
+import (
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+var (
+	frameFilterMu sync.RWMutex
+	// frameFilter reports whether frame belongs to project, nil means default filter
+	frameFilter func(runtime.Frame) bool
+
+	// defaultFilter keeps frames of main module, which is detected on the first use
+	defaultFilter     func(runtime.Frame) bool
+	defaultFilterOnce sync.Once
+)
+
+// wrapperModule is path of this module, its frames are kept in traces, so trace reaches the first frame of application
+var wrapperModule = strings.TrimSuffix(reflect.TypeOf(Frame{}).PkgPath(), "/common")
+
+// SetProjectName makes GetFrames keep frames of functions which full names contain name,
+// as example "github.com/company/project"
+func SetProjectName(name string) {
+	SetFrameFilter(func(frame runtime.Frame) bool {
+		return strings.Contains(frame.Function, name)
+	})
+}
+
+// SetFrameFilter makes GetFrames keep frames for which filter returns true, nil restores default filter.
+// By default frames of main module of binary and of package main are kept.
+// Frames of this module are kept regardless of filter
+func SetFrameFilter(filter func(frame runtime.Frame) bool) {
+	frameFilterMu.Lock()
+	defer frameFilterMu.Unlock()
+	frameFilter = filter
+}
+
+// currentFrameFilter returns filter set by SetFrameFilter or default filter
+func currentFrameFilter() func(runtime.Frame) bool {
+	frameFilterMu.RLock()
+	filter := frameFilter
+	frameFilterMu.RUnlock()
+	if filter != nil {
+		return filter
+	}
+	defaultFilterOnce.Do(func() {
+		defaultFilter = mainModuleFilter(mainModulePath())
+	})
+	return defaultFilter
+}
+
+// mainModulePath returns path of main module of binary, empty string if binary has no build info
+func mainModulePath() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	return info.Main.Path
+}
+
+// mainModuleFilter keeps frames of package main and of packages of module
+func mainModuleFilter(module string) func(runtime.Frame) bool {
+	return func(frame runtime.Frame) bool {
+		if strings.HasPrefix(frame.Function, "main.") {
+			return true
+		}
+		return module != "" && isFrameOf(frame, module)
+	}
+}
+
+// isWrapperFrame reports whether frame belongs to this module
+func isWrapperFrame(frame runtime.Frame) bool {
+	return isFrameOf(frame, wrapperModule)
+}
+
+// isFrameOf reports whether function of frame is declared in module or its packages
+func isFrameOf(frame runtime.Frame, module string) bool {
+	return strings.HasPrefix(frame.Function, module+".") || strings.HasPrefix(frame.Function, module+"/")
+}
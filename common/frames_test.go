@@ -0,0 +1,94 @@
+package common
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// hasFunction reports whether frames contain function with given prefix
+func hasFunction(frames []Frame, prefix string) bool {
+	for _, frame := range frames {
+		if strings.HasPrefix(frame.Function, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDefaultFrameFilter(t *testing.T) {
+	frames := GetFrames()
+	if !hasFunction(frames, wrapperModule+"/common.TestDefaultFrameFilter") {
+		t.Errorf("frame of caller isn't kept: %v", frames)
+	}
+	// runner of test doesn't belong to main module
+	if hasFunction(frames, "testing.") {
+		t.Errorf("frames of dependencies are kept: %v", frames)
+	}
+}
+
+func TestMainModulePath(t *testing.T) {
+	// main module of test binary is module of tested package
+	if got := mainModulePath(); got != wrapperModule {
+		t.Errorf("expected main module %q, got %q", wrapperModule, got)
+	}
+}
+
+func TestMainModuleFilter(t *testing.T) {
+	filter := mainModuleFilter("github.com/company/app")
+	tests := map[string]bool{
+		"main.main":                                 true,
+		"main.(*server).handle":                     true,
+		"github.com/company/app.Run":                true,
+		"github.com/company/app/repo.(*Users).Find": true,
+		"github.com/company/apple.Run":              false,
+		"github.com/gin-gonic/gin.(*Context).Next":  false,
+		"net/http.HandlerFunc.ServeHTTP":            false,
+	}
+	for function, expected := range tests {
+		if got := filter(runtime.Frame{Function: function}); got != expected {
+			t.Errorf("filter(%s) = %v, expected %v", function, got, expected)
+		}
+	}
+	if mainModuleFilter("")(runtime.Frame{Function: "github.com/company/app.Run"}) {
+		t.Error("frames are kept without main module")
+	}
+}
+
+func TestSetFrameFilter(t *testing.T) {
+	defer SetFrameFilter(nil)
+	SetFrameFilter(func(frame runtime.Frame) bool {
+		return strings.HasPrefix(frame.Function, "testing.")
+	})
+	frames := GetFrames()
+	if !hasFunction(frames, "testing.tRunner") {
+		t.Errorf("frames kept by filter are left out: %v", frames)
+	}
+	// frames of this module are kept regardless of filter
+	if !hasFunction(frames, wrapperModule+"/common.TestSetFrameFilter") {
+		t.Errorf("frame of caller isn't kept: %v", frames)
+	}
+
+	SetFrameFilter(nil)
+	if frames := GetFrames(); hasFunction(frames, "testing.") {
+		t.Errorf("default filter isn't restored: %v", frames)
+	}
+}
+
+func TestSetProjectName(t *testing.T) {
+	defer SetFrameFilter(nil)
+	SetProjectName("testing.tRunner")
+	frames := GetFrames()
+	if !hasFunction(frames, "testing.tRunner") {
+		t.Errorf("frames of project are left out: %v", frames)
+	}
+}
+
+func TestWrapperFramesAreKept(t *testing.T) {
+	if !isWrapperFrame(runtime.Frame{Function: wrapperModule + ".(*Model).Find"}) {
+		t.Error("frame of wrapper isn't kept")
+	}
+	if isWrapperFrame(runtime.Frame{Function: wrapperModule + "-fork.Find"}) {
+		t.Error("frame of other module is kept as wrapper frame")
+	}
+}
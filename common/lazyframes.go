@@ -0,0 +1,195 @@
+package common
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// frameCacheSize limits count of call stacks which resolved frames are cached
+const frameCacheSize = 1024
+
+// LazyFrames is calling trace captured by CaptureFrames. Capturing is cheap, frames are resolved
+// only when trace is printed or Frames is called, so logs suppressed by sampling never pay for it.
+// Resolved call stacks are cached, program counters are stable for binary
+type LazyFrames struct {
+	pcs []uintptr
+	// skipLeading reports whether leading frame is left out, see SkipLeading
+	skipLeading func(function string) bool
+	// verbose prints frames as structs, see Verbose
+	verbose bool
+}
+
+// CaptureFrames captures calling trace skipping first skip frames, where 0 is the caller of CaptureFrames.
+// Up to max frames are captured, 99 if max isn't positive
+func CaptureFrames(skip, max int) LazyFrames {
+	if max <= 0 {
+		max = defaultMaxFrames
+	}
+	pcs := make([]uintptr, max)
+	// skip runtime.Callers and CaptureFrames
+	n := runtime.Callers(skip+2, pcs)
+	return LazyFrames{pcs: pcs[:n]}
+}
+
+// SkipLeading leaves out frames on top of trace while skip returns true for their functions,
+// as example frames of wrapper package. Trace is kept as is if all its frames are skipped
+func (f LazyFrames) SkipLeading(skip func(function string) bool) LazyFrames {
+	f.skipLeading = skip
+	return f
+}
+
+// Verbose makes trace printed and marshaled as structs with full function names and paths instead of compact strings
+func (f LazyFrames) Verbose() LazyFrames {
+	f.verbose = true
+	return f
+}
+
+// Frames resolves trace, frames which aren't kept by filter are left out, see SetFrameFilter
+func (f LazyFrames) Frames() Frames {
+	filter := currentFrameFilter()
+	var res Frames
+	for _, frame := range f.resolve() {
+		// skip frames not from our project (as example external dependency gin, urfaveCli), middleware frames interleave with ours
+		if !isWrapperFrame(frame) && !filter(frame) {
+			continue
+		}
+		res = append(res, Frame{
+			Function: frame.Function,
+			File:     frame.File,
+			Line:     frame.Line,
+		})
+	}
+	return res
+}
+
+// First returns the top frame of trace after leading frames, regardless of filter
+func (f LazyFrames) First() (Frame, bool) {
+	frames := f.resolve()
+	if len(frames) == 0 || f.skipLeading != nil && f.skipLeading(frames[0].Function) {
+		return Frame{}, false
+	}
+	return Frame{Function: frames[0].Function, File: frames[0].File, Line: frames[0].Line}, true
+}
+
+// verboseFrame is Frame printed by fmt as struct
+type verboseFrame Frame
+
+// String prints resolved frames, compact ones by default
+func (f LazyFrames) String() string {
+	frames := f.Frames()
+	if !f.verbose {
+		return "[" + strings.Join(frames.Strings(), ", ") + "]"
+	}
+	verbose := make([]verboseFrame, 0, len(frames))
+	for _, frame := range frames {
+		verbose = append(verbose, verboseFrame(frame))
+	}
+	return fmt.Sprint(verbose)
+}
+
+// MarshalJSON marshals resolved frames, as array of compact strings by default
+func (f LazyFrames) MarshalJSON() ([]byte, error) {
+	if f.verbose {
+		return json.Marshal([]Frame(f.Frames()))
+	}
+	return json.Marshal(f.Frames())
+}
+
+// resolve returns frames of trace without leading skipped ones
+func (f LazyFrames) resolve() []runtime.Frame {
+	frames := resolvedFrames.get(f.pcs)
+	if f.skipLeading == nil {
+		return frames
+	}
+	for i, frame := range frames {
+		if !f.skipLeading(frame.Function) {
+			return frames[i:]
+		}
+	}
+	return frames
+}
+
+// resolvedFrames caches resolved call stacks
+var resolvedFrames = &frameCache{entries: make(map[uint64]*list.Element), order: list.New()}
+
+// frameCache is LRU cache of resolved frames by program counters
+type frameCache struct {
+	mu      sync.Mutex
+	entries map[uint64]*list.Element
+	// order holds *frameCacheEntry, the most recently used first
+	order *list.List
+}
+
+type frameCacheEntry struct {
+	key    uint64
+	pcs    []uintptr
+	frames []runtime.Frame
+}
+
+// get returns frames of program counters, resolving and caching them on miss
+func (c *frameCache) get(pcs []uintptr) []runtime.Frame {
+	if len(pcs) == 0 {
+		return nil
+	}
+	key := hashPCs(pcs)
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok && equalPCs(el.Value.(*frameCacheEntry).pcs, pcs) {
+		c.order.MoveToFront(el)
+		frames := el.Value.(*frameCacheEntry).frames
+		c.mu.Unlock()
+		return frames
+	}
+	c.mu.Unlock()
+
+	// resolving is slow, so it runs unlocked, concurrent misses of the same stack resolve it twice
+	var frames []runtime.Frame
+	callers := runtime.CallersFrames(pcs)
+	for more := true; more; {
+		var frame runtime.Frame
+		frame, more = callers.Next()
+		frames = append(frames, frame)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.order.Remove(el)
+	}
+	c.entries[key] = c.order.PushFront(&frameCacheEntry{key: key, pcs: pcs, frames: frames})
+	if c.order.Len() > frameCacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*frameCacheEntry).key)
+	}
+	return frames
+}
+
+// hashPCs hashes program counters for cache key
+func hashPCs(pcs []uintptr) uint64 {
+	h := fnv.New64a()
+	b := make([]byte, 0, 20)
+	for _, pc := range pcs {
+		b = strconv.AppendUint(b[:0], uint64(pc), 16)
+		b = append(b, ',')
+		_, _ = h.Write(b)
+	}
+	return h.Sum64()
+}
+
+func equalPCs(a, b []uintptr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,252 @@
+package builder
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	"gorm-logged/common"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// dsn of databases for conformance tests, tests of dialect are skipped when its dsn isn't set.
+// Tables of tests are dropped and created again, so databases should be disposable
+const (
+	postgresDSNEnv = "GORM_LOGGED_TEST_POSTGRES_DSN"
+	mysqlDSNEnv    = "GORM_LOGGED_TEST_MYSQL_DSN"
+)
+
+type conformanceNode struct {
+	ID    int
+	Name  string `gorm:"size:64;uniqueIndex"`
+	Score int
+}
+
+// constructor opens model for conformance test
+type constructor func(t *testing.T) *Model
+
+// TestConformance checks that QueryBuilder behaves the same regardless of dialect and constructor
+func TestConformance(t *testing.T) {
+	constructors := []struct {
+		name string
+		open constructor
+	}{
+		{"NewWithDialector/sqlite", func(t *testing.T) *Model {
+			return newTestModel(t, nil)
+		}},
+		{"NewFromDB/sqlite", func(t *testing.T) *Model {
+			db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+			if err != nil {
+				t.Fatalf("can't open sqlite database: %v", err)
+			}
+			sqlDB, err := db.DB()
+			if err != nil {
+				t.Fatalf("can't get sqlite connection pool: %v", err)
+			}
+			// in-memory database exists per connection
+			sqlDB.SetMaxOpenConns(1)
+			t.Cleanup(func() { sqlDB.Close() })
+			m := NewFromDB(db)
+			return &m
+		}},
+		{"New", func(t *testing.T) *Model {
+			dsn := requireDSN(t, postgresDSNEnv)
+			m, err := New(dsn)
+			return closeOnCleanup(t, m, err)
+		}},
+		{"NewFromDB/postgres", func(t *testing.T) *Model {
+			dsn := requireDSN(t, postgresDSNEnv)
+			db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+			if err != nil {
+				t.Fatalf("can't open postgres database: %v", err)
+			}
+			return closeOnCleanup(t, NewFromDB(db), nil)
+		}},
+		{"NewFromSQLDB/postgres", func(t *testing.T) *Model {
+			sqlDB := openSQLDB(t, "pgx", postgresDSNEnv)
+			m, err := NewFromSQLDB(sqlDB, WithSimpleProtocol(true))
+			return closeOnCleanup(t, m, err)
+		}},
+		{"NewMySQL", func(t *testing.T) *Model {
+			dsn := requireDSN(t, mysqlDSNEnv)
+			m, err := NewMySQL(dsn)
+			return closeOnCleanup(t, m, err)
+		}},
+		{"NewFromDB/mysql", func(t *testing.T) *Model {
+			dsn := requireDSN(t, mysqlDSNEnv)
+			db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{Logger: logger.Discard})
+			if err != nil {
+				t.Fatalf("can't open mysql database: %v", err)
+			}
+			return closeOnCleanup(t, NewFromDB(db), nil)
+		}},
+		{"NewFromSQLDB/mysql", func(t *testing.T) *Model {
+			sqlDB := openSQLDB(t, "mysql", mysqlDSNEnv)
+			m, err := NewFromSQLDB(sqlDB)
+			return closeOnCleanup(t, m, err)
+		}},
+	}
+	for _, c := range constructors {
+		t.Run(c.name, func(t *testing.T) {
+			runConformance(t, c.open)
+		})
+	}
+}
+
+// requireDSN returns dsn from environment variable, skips test if it isn't set
+func requireDSN(t *testing.T, env string) string {
+	t.Helper()
+	dsn := os.Getenv(env)
+	if dsn == "" {
+		t.Skipf("%s is not set", env)
+	}
+	return dsn
+}
+
+// openSQLDB opens connection pool of driver by dsn from environment variable, skips test if it isn't set
+func openSQLDB(t *testing.T, driver, env string) *sql.DB {
+	t.Helper()
+	sqlDB, err := sql.Open(driver, requireDSN(t, env))
+	if err != nil {
+		t.Fatalf("can't open connection pool: %v", err)
+	}
+	return sqlDB
+}
+
+// closeOnCleanup fails test on error of constructor and closes model at the end of test
+func closeOnCleanup(t *testing.T, m Model, err error) *Model {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("can't open database: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return &m
+}
+
+// runConformance runs the same checks of QueryBuilder against fresh table of every model opened by open
+func runConformance(t *testing.T, open constructor) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, m *Model)
+	}{
+		{"create and first", func(t *testing.T, m *Model) {
+			created := conformanceNode{Name: "a", Score: 1}
+			if err := m.Create(&created); err != nil {
+				t.Fatalf("can't create node: %v", err)
+			}
+			if created.ID == 0 {
+				t.Fatal("primary key isn't set by Create")
+			}
+			var found conformanceNode
+			if err := m.First(&found, created.ID); err != nil {
+				t.Fatalf("can't find node: %v", err)
+			}
+			if found != created {
+				t.Errorf("found %+v, created %+v", found, created)
+			}
+		}},
+		{"find with conditions", func(t *testing.T, m *Model) {
+			createNodes(t, m, "a", "b", "c", "d")
+			var nodes []conformanceNode
+			err := m.Where("score > ?", 1).Order("score DESC").Limit(2).Offset(1).Find(&nodes)
+			if err != nil {
+				t.Fatalf("can't find nodes: %v", err)
+			}
+			if len(nodes) != 2 || nodes[0].Name != "c" || nodes[1].Name != "b" {
+				t.Errorf("unexpected nodes %+v", nodes)
+			}
+		}},
+		{"updates, count and pluck", func(t *testing.T, m *Model) {
+			createNodes(t, m, "a", "b", "c")
+			if err := m.Model(&conformanceNode{}).Where("name IN ?", []string{"a", "b"}).Updates(map[string]interface{}{"score": 10}); err != nil {
+				t.Fatalf("can't update nodes: %v", err)
+			}
+			count, err := m.Model(&conformanceNode{}).Where("score = ?", 10).Count()
+			if err != nil {
+				t.Fatalf("can't count nodes: %v", err)
+			}
+			if count != 2 {
+				t.Errorf("expected 2 updated nodes, got %d", count)
+			}
+			var names []string
+			if err := m.Model(&conformanceNode{}).Order("name").Pluck("name", &names); err != nil {
+				t.Fatalf("can't pluck names: %v", err)
+			}
+			if len(names) != 3 || names[0] != "a" || names[2] != "c" {
+				t.Errorf("unexpected names %v", names)
+			}
+		}},
+		{"delete", func(t *testing.T, m *Model) {
+			createNodes(t, m, "a", "b")
+			if err := m.Where("name = ?", "a").Delete(&conformanceNode{}); err != nil {
+				t.Fatalf("can't delete node: %v", err)
+			}
+			count, err := m.Model(&conformanceNode{}).Count()
+			if err != nil {
+				t.Fatalf("can't count nodes: %v", err)
+			}
+			if count != 1 {
+				t.Errorf("expected single node left, got %d", count)
+			}
+		}},
+		{"not found", func(t *testing.T, m *Model) {
+			var node conformanceNode
+			if err := m.Where("name = ?", "missing").First(&node); !errors.Is(err, common.ErrNotFound) {
+				t.Errorf("expected not found error, got %v", err)
+			}
+		}},
+		{"duplicate", func(t *testing.T, m *Model) {
+			createNodes(t, m, "a")
+			if err := m.Create(&conformanceNode{Name: "a"}); !errors.Is(err, common.ErrDuplicate) {
+				t.Errorf("expected duplicate error, got %v", err)
+			}
+		}},
+		{"transaction rollback", func(t *testing.T, m *Model) {
+			failure := errors.New("failure")
+			err := m.Transaction(func(tx *Model) error {
+				if err := tx.Create(&conformanceNode{Name: "a"}); err != nil {
+					return err
+				}
+				return failure
+			})
+			if !errors.Is(err, failure) {
+				t.Fatalf("expected error of transaction, got %v", err)
+			}
+			count, err := m.Model(&conformanceNode{}).Count()
+			if err != nil {
+				t.Fatalf("can't count nodes: %v", err)
+			}
+			if count != 0 {
+				t.Errorf("created node isn't rolled back, %d nodes found", count)
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := open(t)
+			if err := m.db.Migrator().DropTable(&conformanceNode{}); err != nil {
+				t.Fatalf("can't drop table: %v", err)
+			}
+			if err := m.Migrate(&conformanceNode{}); err != nil {
+				t.Fatalf("can't migrate table: %v", err)
+			}
+			test.run(t, m)
+		})
+	}
+}
+
+// createNodes creates nodes with given names, score of node is its position starting from 1
+func createNodes(t *testing.T, m *Model, names ...string) {
+	t.Helper()
+	for i, name := range names {
+		if err := m.Create(&conformanceNode{Name: name, Score: i + 1}); err != nil {
+			t.Fatalf("can't create node %s: %v", name, err)
+		}
+	}
+}
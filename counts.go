@@ -0,0 +1,145 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// countSuffix is suffix of struct field, which receives count of association loaded by WithCount
+const countSuffix = "Count"
+
+// WithCount is gorm extension. Counts records of has many and many to many associations of records found
+// by First, Last, Take and Find into int fields named after associations, as example Comments are counted
+// into CommentsCount, count fields should be tagged `gorm:"-"`. Every association is counted by single grouped query
+func (m *Model) WithCount(associations ...string) *Model {
+	trace := m.logTrace.with("withCount"+m.logTrace.freeIndex("withCount"), associations)
+	c := m.chain(m.db, trace)
+	c.counts = append(m.counts[:len(m.counts):len(m.counts)], associations...)
+	return c
+}
+
+// loadCounts counts associations of WithCount for found dest
+func (m *Model) loadCounts(op string, dest interface{}) error {
+	if len(m.counts) == 0 {
+		return nil
+	}
+	s, err := m.parseSchema(dest)
+	if err != nil {
+		return m.fail(op, "can't parse schema of counted parent", err, logrus.Fields{"trace": m.frames()})
+	}
+	parents := reflect.Indirect(reflect.ValueOf(dest))
+	elems := make([]reflect.Value, 0, 1)
+	if parents.Kind() == reflect.Slice || parents.Kind() == reflect.Array {
+		for i := 0; i < parents.Len(); i++ {
+			elems = append(elems, reflect.Indirect(parents.Index(i)))
+		}
+	} else {
+		elems = append(elems, parents)
+	}
+	for _, association := range m.counts {
+		if err := m.loadCount(s, elems, association); err != nil {
+			return m.fail(op, "can't count association", err, logrus.Fields{
+				"countedAssociation": association,
+				"countField":         association + countSuffix,
+				"trace":              m.frames(),
+			})
+		}
+	}
+	return nil
+}
+
+// loadCount counts records of association for parents and sets count fields of parents
+func (m *Model) loadCount(s *schema.Schema, parents []reflect.Value, association string) error {
+	countField, ok := s.ModelType.FieldByName(association + countSuffix)
+	if !ok || !isIntKind(countField.Type.Kind()) {
+		return fmt.Errorf("%s has no int field %s for count of %s", s.Name, association+countSuffix, association)
+	}
+	rel := s.Relationships.Relations[association]
+	if rel == nil || (rel.Type != schema.HasMany && rel.Type != schema.Many2Many) {
+		return fmt.Errorf("%s of %s is not has many or many to many association", association, s.Name)
+	}
+	var ref *schema.Reference
+	for _, r := range rel.References {
+		if r.OwnPrimaryKey {
+			if ref != nil {
+				return fmt.Errorf("%s of %s has composite foreign key", association, s.Name)
+			}
+			ref = r
+		}
+	}
+	if ref == nil {
+		return fmt.Errorf("%s of %s has no foreign key referencing %s", association, s.Name, s.Name)
+	}
+
+	ctx := context.Background()
+	keys := make([]interface{}, 0, len(parents))
+	for _, parent := range parents {
+		if key, zero := ref.PrimaryKey.ValueOf(ctx, parent); !zero {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	fk := clause.Column{Name: ref.ForeignKey.DBName}
+	query := m.traced().Session(&gorm.Session{NewDB: true})
+	if rel.Type == schema.Many2Many {
+		query = query.Table(rel.JoinTable.Table)
+	} else {
+		// model applies soft delete of associated records
+		query = query.Model(reflect.New(rel.FieldSchema.ModelType).Interface())
+	}
+	rows, err := query.Select("?, COUNT(*)", fk).
+		Where(clause.IN{Column: fk, Values: keys}).
+		Group(fk.Name).
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64, len(keys))
+	for rows.Next() {
+		var (
+			key   interface{}
+			count int64
+		)
+		if err := rows.Scan(&key, &count); err != nil {
+			return err
+		}
+		if b, ok := key.([]byte); ok {
+			key = string(b)
+		}
+		counts[fmt.Sprint(key)] = count
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, parent := range parents {
+		key, _ := ref.PrimaryKey.ValueOf(ctx, parent)
+		field := parent.FieldByIndex(countField.Index)
+		if field.CanInt() {
+			field.SetInt(counts[fmt.Sprint(key)])
+		} else {
+			field.SetUint(uint64(counts[fmt.Sprint(key)]))
+		}
+	}
+	return nil
+}
+
+// isIntKind reports whether kind is signed or unsigned integer
+func isIntKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
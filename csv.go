@@ -0,0 +1,152 @@
+package builder
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// csvTag is struct tag, which names header of column in StreamCSV, as example `csv:"Created at"`
+const csvTag = "csv"
+
+// CSVOptions configures StreamCSV
+type CSVOptions struct {
+	// Comma is field delimiter, ',' by default
+	Comma rune
+	// TimeFormat formats time values, time.RFC3339 by default
+	TimeFormat string
+	// Null is written for NULL values, empty string by default
+	Null string
+	// NoHeader skips header row
+	NoHeader bool
+	// Model is struct, which csv tags name headers of its columns, column names are headers by default
+	Model interface{}
+}
+
+// StreamCSV is gorm extension. Writes rows of chain into w as csv, header is derived from selected columns.
+// Rows are read by cursor and written one by one, so the whole result is never loaded into memory.
+// Writers implementing http.Flusher or Flush() error are flushed periodically. Returns count of written rows
+func (m *Model) StreamCSV(w io.Writer, opts CSVOptions) (int64, error) {
+	if opts.TimeFormat == "" {
+		opts.TimeFormat = time.RFC3339
+	}
+	out := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		out.Comma = opts.Comma
+	}
+
+	q := m.startQuery("streamCSV")
+	res := m.applyPreloads().db
+	rows, err := res.Rows()
+	q.done(res)
+	if err != nil {
+		m.tx.remember(err)
+		return 0, m.fail("streamCSV", "can't select rows for csv", err, m.sqlFields(res), logrus.Fields{
+			"trace": m.frames(),
+		})
+	}
+	defer rows.Close()
+
+	n, err := m.writeCSV(out, w, rows, opts)
+	if err != nil {
+		m.tx.remember(err)
+		return n, m.fail("streamCSV", "can't stream rows as csv", err, logrus.Fields{
+			"csvRowNumber": n + 1,
+			"trace":        m.frames(),
+		})
+	}
+	return n, nil
+}
+
+// writeCSV writes header and rows into out, which writes into w, returns count of written rows
+func (m *Model) writeCSV(out *csv.Writer, w io.Writer, rows *sql.Rows, opts CSVOptions) (int64, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !opts.NoHeader {
+		if err := out.Write(m.csvHeader(columns, opts.Model)); err != nil {
+			return 0, err
+		}
+	}
+
+	var n int64
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	record := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return n, err
+		}
+		for i, value := range values {
+			record[i] = csvValue(value, opts)
+		}
+		if err := out.Write(record); err != nil {
+			return n, err
+		}
+		n++
+		if n%streamFlushRows == 0 {
+			if err := flushCSV(out, w); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	return n, flushCSV(out, w)
+}
+
+// csvHeader names columns by csv tags of fields of model, column names are kept for other columns
+func (m *Model) csvHeader(columns []string, model interface{}) []string {
+	header := append([]string(nil), columns...)
+	if model == nil {
+		return header
+	}
+	s, err := m.parseSchema(model)
+	if err != nil {
+		m.logDebug("can't parse schema of csv model, column names are used as header", err)
+		return header
+	}
+	for i, column := range columns {
+		field := s.LookUpField(column)
+		if field == nil {
+			continue
+		}
+		if name, _, _ := strings.Cut(field.StructField.Tag.Get(csvTag), ","); name != "" && name != "-" {
+			header[i] = name
+		}
+	}
+	return header
+}
+
+// csvValue formats value of column for csv
+func csvValue(value interface{}, opts CSVOptions) string {
+	switch v := value.(type) {
+	case nil:
+		return opts.Null
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(opts.TimeFormat)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// flushCSV flushes buffer of out and then w
+func flushCSV(out *csv.Writer, w io.Writer) error {
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return err
+	}
+	return flush(w)
+}
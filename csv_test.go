@@ -0,0 +1,144 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type csvNode struct {
+	ID        int
+	Name      string `csv:"Full name"`
+	Note      *string
+	CreatedAt time.Time `csv:"Created at"`
+}
+
+func TestStreamCSV(t *testing.T) {
+	m := newTestModel(t, nil, &csvNode{})
+	created := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	note := `said "hi", left`
+	nodes := []csvNode{
+		{Name: "Smith, John", Note: &note, CreatedAt: created},
+		{Name: "line\nbreak", CreatedAt: created},
+	}
+	if err := m.Create(&nodes); err != nil {
+		t.Fatalf("can't create nodes: %v", err)
+	}
+
+	var buf bytes.Buffer
+	n, err := m.Model(&csvNode{}).Order("id").StreamCSV(&buf, CSVOptions{Model: &csvNode{}, Null: "NULL", TimeFormat: time.DateOnly})
+	if err != nil {
+		t.Fatalf("StreamCSV failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 rows, got %d", n)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("output isn't valid csv: %v", err)
+	}
+	expected := [][]string{
+		{"id", "Full name", "note", "Created at"},
+		{"1", "Smith, John", `said "hi", left`, "2024-03-01"},
+		{"2", "line\nbreak", "NULL", "2024-03-01"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got %q", len(expected), records)
+	}
+	for i := range expected {
+		if strings.Join(records[i], "|") != strings.Join(expected[i], "|") {
+			t.Errorf("record %d: expected %q, got %q", i, expected[i], records[i])
+		}
+	}
+}
+
+func TestStreamCSVOptions(t *testing.T) {
+	m := newTestModel(t, nil, &csvNode{})
+	if err := m.Create(&csvNode{Name: "a;b"}); err != nil {
+		t.Fatalf("can't create node: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := m.Model(&csvNode{}).Select("id", "name", "note").StreamCSV(&buf, CSVOptions{Comma: ';', NoHeader: true}); err != nil {
+		t.Fatalf("StreamCSV failed: %v", err)
+	}
+	if got := buf.String(); got != "1;\"a;b\";\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
+
+// failingWriter fails all writes
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk is full")
+}
+
+func TestStreamCSVLogsRowNumber(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &csvNode{})
+	if err := m.Create(&csvNode{Name: "a"}); err != nil {
+		t.Fatalf("can't create node: %v", err)
+	}
+	hook.Reset()
+	if _, err := m.Model(&csvNode{}).StreamCSV(failingWriter{}, CSVOptions{}); err == nil {
+		t.Fatal("expected error of writer")
+	}
+	entries := entriesAt(hook, logrus.ErrorLevel)
+	if len(entries) != 1 || entries[0].Data["csvRowNumber"] == nil {
+		t.Errorf("row number isn't logged: %v", hook.AllEntries())
+	}
+}
+
+// peakHeapWriter counts written bytes and tracks peak of heap while rows are written
+type peakHeapWriter struct {
+	written int
+	peak    uint64
+}
+
+func (w *peakHeapWriter) Write(p []byte) (int, error) {
+	w.written += len(p)
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc > w.peak {
+		w.peak = stats.HeapAlloc
+	}
+	return len(p), nil
+}
+
+func TestStreamCSVMemoryIsFlat(t *testing.T) {
+	if testing.Short() {
+		t.Skip("streams 100k rows")
+	}
+	m := newTestModel(t, nil, &csvNode{})
+	err := m.exec(`WITH RECURSIVE seq(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM seq WHERE i < 100000)
+		INSERT INTO csv_nodes (name, note, created_at) SELECT 'node number ' || i, 'note of node ' || i, '2024-03-01 12:30:00' FROM seq`)
+	if err != nil {
+		t.Fatalf("can't create nodes: %v", err)
+	}
+
+	// frequent collections keep garbage out of measured heap
+	defer debug.SetGCPercent(debug.SetGCPercent(10))
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	w := &peakHeapWriter{}
+	n, err := m.Model(&csvNode{}).StreamCSV(w, CSVOptions{})
+	if err != nil {
+		t.Fatalf("StreamCSV failed: %v", err)
+	}
+	if n != 100000 {
+		t.Errorf("expected 100000 rows, got %d", n)
+	}
+	growth := int64(w.peak) - int64(before.HeapAlloc)
+	// loading rows into memory would take more than written output
+	if growth > int64(w.written)/2 {
+		t.Errorf("heap grows by %d bytes while streaming %d bytes", growth, w.written)
+	}
+}
@@ -0,0 +1,100 @@
+package builder
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// debugDumpRows is count of result rows printed by DebugDump
+const debugDumpRows = 5
+
+// DebugDump prints sql of chain, its vars, trace and the first rows of result into w, os.Stderr by default,
+// and returns chain as is, so finisher can be called after it. Query is run once more for dump.
+// Works only with WithDebugDump option, otherwise it just logs warning
+func (m *Model) DebugDump(w io.Writer) *Model {
+	if !m.cfg.debugDump {
+		m.logWarn("DebugDump is called, but it is disabled by WithDebugDump option", nil, logrus.Fields{
+			"trace": m.frames(),
+		})
+		return m
+	}
+	m.logWarn("DebugDump is called, remove it after troubleshooting", nil, logrus.Fields{"trace": m.frames()})
+	if w == nil {
+		w = os.Stderr
+	}
+
+	// sql of raw chains is built already, other chains are built in dry run mode
+	db := m.db
+	if db.Statement.SQL.Len() == 0 {
+		db = m.db.Session(&gorm.Session{DryRun: true}).Find(&[]map[string]interface{}{})
+	}
+	sql, vars := db.Statement.SQL.String(), db.Statement.Vars
+
+	var b strings.Builder
+	b.WriteString("-- sql --\n" + sql + "\n")
+	b.WriteString("-- vars --\n")
+	for i, v := range vars {
+		fmt.Fprintf(&b, "$%d = %s\n", i+1, m.printCapped(v, maxLoggedSQLLen))
+	}
+	b.WriteString("-- explained --\n" + db.Dialector.Explain(sql, vars...) + "\n")
+	b.WriteString("-- trace --\n")
+	for _, e := range m.logTrace {
+		fmt.Fprintf(&b, "%s = %v\n", e.Key, m.traceValue(e.Value))
+	}
+	b.WriteString("-- rows --\n")
+	if db.Error != nil {
+		b.WriteString("can't build query: " + db.Error.Error() + "\n")
+	} else {
+		m.dumpRows(&b, db, sql, vars)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		m.logWarn("can't write debug dump", err)
+	}
+	return m
+}
+
+// dumpRows writes the first rows of query as table
+func (m *Model) dumpRows(b *strings.Builder, db *gorm.DB, sql string, vars []interface{}) {
+	dumpSQL := fmt.Sprintf("SELECT * FROM (%s) AS gorm_logged_dump LIMIT %d", sql, debugDumpRows)
+	rows, err := db.Statement.ConnPool.QueryContext(db.Statement.Context, dumpSQL, vars...)
+	if err != nil {
+		b.WriteString("can't run query: " + err.Error() + "\n")
+		return
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		b.WriteString("can't get columns: " + err.Error() + "\n")
+		return
+	}
+
+	table := tabwriter.NewWriter(b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, strings.Join(columns, "\t"))
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	cells := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			b.WriteString("can't scan row: " + err.Error() + "\n")
+			return
+		}
+		for i, value := range values {
+			cells[i] = csvValue(value, CSVOptions{Null: "NULL", TimeFormat: time.RFC3339})
+		}
+		fmt.Fprintln(table, strings.Join(cells, "\t"))
+	}
+	_ = table.Flush()
+	if err := rows.Err(); err != nil {
+		b.WriteString("can't read rows: " + err.Error() + "\n")
+	}
+}
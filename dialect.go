@@ -0,0 +1,36 @@
+package builder
+
+import (
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+// names of dialects reported by gorm dialectors
+const (
+	dialectPostgres = "postgres"
+	dialectMySQL    = "mysql"
+	dialectSQLite   = "sqlite"
+)
+
+// dialect returns name of database dialect model works with
+func (m *Model) dialect() string {
+	return m.db.Dialector.Name()
+}
+
+// requireDialect checks that feature is supported by dialect of model.
+// Logs explanation and returns common.ErrUnsupportedDialect otherwise, instead of sending invalid sql to database
+func (m *Model) requireDialect(feature string, dialects ...string) error {
+	for _, dialect := range dialects {
+		if dialect == m.dialect() {
+			return nil
+		}
+	}
+	m.logError("feature is not supported by database dialect", nil, logrus.Fields{
+		"feature":           feature,
+		"dialect":           m.dialect(),
+		"supportedDialects": dialects,
+		"trace":             m.frames(),
+	})
+	return common.ErrUnsupportedDialect
+}
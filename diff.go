@@ -0,0 +1,173 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/schema"
+)
+
+// diffTimePrecision is precision of compared time values, databases keep microseconds at most
+const diffTimePrecision = time.Microsecond
+
+// Diff is changes made by UpdatesDiff by column names
+type Diff map[string]FieldChange
+
+// FieldChange is old and new value of changed field
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// UpdatesDiff is gorm extension. Works as Updates of current, which is pointer to struct like &User{} loaded by caller,
+// and returns fields of attrs which values differ from current. attrs is struct, which non zero fields are updated,
+// or map by names of fields or columns. Time values are compared with microsecond precision.
+// Diff is logged at debug level and recorded by audit instead of updated values
+func (m *Model) UpdatesDiff(current interface{}, attrs interface{}) (Diff, error) {
+	logFields := logrus.Fields{
+		"updateCurrent": m.summarize(current),
+		"updateAttrs":   m.summarize(attrs),
+	}
+	cv := reflect.ValueOf(current)
+	if cv.Kind() != reflect.Ptr || cv.IsNil() || cv.Elem().Kind() != reflect.Struct {
+		m.logError("queryBuilder.UpdatesDiff called with current object which isn't pointer to struct", nil, logFields,
+			logrus.Fields{"trace": m.frames()})
+		return nil, common.ErrInternal
+	}
+	s, err := m.parseSchema(current)
+	if err != nil {
+		return nil, m.fail("updatesDiff", "can't parse updated struct", err, logFields, logrus.Fields{"trace": m.frames()})
+	}
+	values, unknown := diffValues(s, attrs)
+	if len(unknown) > 0 {
+		m.logError("queryBuilder.UpdatesDiff called with fields which don't exist on struct", nil, logFields,
+			logrus.Fields{"unknownUpdateFields": unknown, "trace": m.frames()})
+		return nil, common.ErrInternal
+	}
+
+	diff := Diff{}
+	for column, value := range values {
+		field := s.LookUpField(column)
+		old, _ := field.ValueOf(context.Background(), cv.Elem())
+		if !sameValue(field, old, value) {
+			diff[column] = FieldChange{Old: old, New: value}
+		}
+	}
+
+	c := m.chain(m.db, m.logTrace)
+	c.updateDiff = diff
+	q := c.startQuery("updatesDiff")
+	res := q.done(c.applyPreloads().db.Model(current).Updates(attrs))
+	if err := res.Error; err != nil {
+		m.tx.remember(err)
+		return nil, m.fail("updatesDiff", "can't update object in database", err, m.sqlFields(res), logFields,
+			logrus.Fields{"updateDiff": m.diffSummary(s, diff), "trace": m.frames()})
+	}
+	m.logDebug("object is updated", nil, logrus.Fields{"updateDiff": m.diffSummary(s, diff)})
+	return diff, nil
+}
+
+// diffValues returns updated values of attrs by column names, struct attrs are updated by non zero fields.
+// Returns names of map keys which aren't fields of schema
+func diffValues(s *schema.Schema, attrs interface{}) (map[string]interface{}, []string) {
+	v := reflect.Indirect(reflect.ValueOf(attrs))
+	if v.Kind() == reflect.Struct {
+		return updatedColumns(s, v), nil
+	}
+	values := map[string]interface{}{}
+	var unknown []string
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return values, nil
+	}
+	iter := v.MapRange()
+	for iter.Next() {
+		field := s.LookUpField(iter.Key().String())
+		if field == nil || field.DBName == "" {
+			unknown = append(unknown, iter.Key().String())
+			continue
+		}
+		values[field.DBName] = iter.Value().Interface()
+	}
+	sort.Strings(unknown)
+	return values, unknown
+}
+
+// sameValue reports whether old value of field equals to new one, pointers are dereferenced,
+// numbers are converted to type of field and time values are truncated to precision of database
+func sameValue(field *schema.Field, old, new interface{}) bool {
+	a, b := diffComparable(field, old), diffComparable(field, new)
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Truncate(diffTimePrecision).Equal(bt.Truncate(diffTimePrecision))
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// diffComparable dereferences value and converts numbers and strings to type of field
+func diffComparable(field *schema.Field, value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	t := field.IndirectFieldType
+	convertible := isIntKind(v.Kind()) && isIntKind(t.Kind()) ||
+		v.Kind() == reflect.String && t.Kind() == reflect.String ||
+		(v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64) && (t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64)
+	if convertible && v.Type() != t {
+		v = v.Convert(t)
+	}
+	return v.Interface()
+}
+
+// diffSummary prints diff compactly for logs, as example "name: 'a' -> 'b', age: 1 -> 2", sensitive fields are hidden
+func (m *Model) diffSummary(s *schema.Schema, diff Diff) string {
+	columns := make([]string, 0, len(diff))
+	for column := range diff {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	parts := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if field := s.LookUpField(column); field != nil && isRedacted(field.StructField, m.cfg.redactedFields) {
+			parts = append(parts, column+": "+redactedValue)
+			continue
+		}
+		change := diff[column]
+		parts = append(parts, fmt.Sprintf("%s: %s -> %s", column, diffPrint(change.Old), diffPrint(change.New)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// diffPrint prints single value of diff, strings are quoted and long values are cut
+func diffPrint(value interface{}) string {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	var res string
+	switch {
+	case !v.IsValid() || v.Kind() == reflect.Ptr:
+		res = "NULL"
+	case v.Kind() == reflect.String:
+		res = "'" + v.String() + "'"
+	default:
+		res = fmt.Sprint(v.Interface())
+	}
+	if len(res) > defaultLoggedMaxStringLen {
+		res = res[:defaultLoggedMaxStringLen] + "..."
+	}
+	return res
+}
@@ -0,0 +1,221 @@
+package builder
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
+)
+
+// errDryRunConn is returned by connection of dry run model, which must never be reached
+var errDryRunConn = errors.New("dry run model has no database connection")
+
+// dryRunState stores the last statement built by dry run model
+type dryRunState struct {
+	mu   sync.Mutex
+	sql  string
+	vars []interface{}
+}
+
+// NewDryRun builds model which never executes queries, finishers only build sql,
+// which is available by LastSQL. Supported dialects are "postgres", "mysql" and "sqlite".
+// Designed for unit tests of query shapes without database
+func NewDryRun(dialect string, opts ...Option) Model {
+	var dialector gorm.Dialector
+	switch dialect {
+	case dialectPostgres:
+		dialector = postgres.New(postgres.Config{Conn: dryRunConn{}})
+	case dialectMySQL:
+		dialector = mysql.New(mysql.Config{Conn: dryRunConn{}, SkipInitializeWithVersion: true})
+	case dialectSQLite:
+		// sqlite dialector queries version on initialization and its driver requires cgo
+		dialector = sqliteDryRunDialector{}
+	default:
+		panic(fmt.Sprintf("builder.NewDryRun called with unsupported dialect %q", dialect))
+	}
+
+	cfg := newConfig(opts)
+	gormConfig := cfg.gormConfig()
+	gormConfig.DryRun = true
+	gormConfig.DisableAutomaticPing = true
+	db, err := gorm.Open(dialector, gormConfig)
+	if err != nil {
+		panic(fmt.Sprintf("builder.NewDryRun can't initialize %s dialect: %v", dialect, err))
+	}
+
+	// callbacks of the package shape queries too, as example qualify tables by Schema
+	if err := registerCallbacks(db); err != nil {
+		panic(fmt.Sprintf("builder.NewDryRun can't register callbacks: %v", err))
+	}
+	cfg.dryRun = &dryRunState{}
+	record := func(db *gorm.DB) {
+		cfg.dryRun.mu.Lock()
+		defer cfg.dryRun.mu.Unlock()
+		cfg.dryRun.sql = db.Statement.SQL.String()
+		cfg.dryRun.vars = db.Statement.Vars
+	}
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().After("*").Register("gorm-logged:dry_run", record),
+		callbacks.Query().After("*").Register("gorm-logged:dry_run", record),
+		callbacks.Update().After("*").Register("gorm-logged:dry_run", record),
+		callbacks.Delete().After("*").Register("gorm-logged:dry_run", record),
+		callbacks.Row().After("*").Register("gorm-logged:dry_run", record),
+		callbacks.Raw().After("*").Register("gorm-logged:dry_run", record),
+	} {
+		if err != nil {
+			panic(fmt.Sprintf("builder.NewDryRun can't register callback: %v", err))
+		}
+	}
+	return Model{db: db, cfg: cfg}
+}
+
+// LastSQL returns sql and vars of the last statement built by dry run model, empty values for other models
+func (m *Model) LastSQL() (string, []interface{}) {
+	if m.cfg.dryRun == nil {
+		return "", nil
+	}
+	m.cfg.dryRun.mu.Lock()
+	defer m.cfg.dryRun.mu.Unlock()
+	return m.cfg.dryRun.sql, m.cfg.dryRun.vars
+}
+
+// dryRunConn is connection pool of dry run model, gorm doesn't reach it in dry run mode
+type dryRunConn struct{}
+
+func (dryRunConn) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, errDryRunConn
+}
+
+func (dryRunConn) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, errDryRunConn
+}
+
+func (dryRunConn) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, errDryRunConn
+}
+
+func (dryRunConn) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+// sqliteDryRunDialector builds sql of sqlite as gorm.io/driver/sqlite does for sqlite 3.35 and later,
+// but without connection
+type sqliteDryRunDialector struct{}
+
+func (sqliteDryRunDialector) Name() string {
+	return dialectSQLite
+}
+
+func (d sqliteDryRunDialector) Initialize(db *gorm.DB) error {
+	db.ConnPool = dryRunConn{}
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{
+		CreateClauses:        []string{"INSERT", "VALUES", "ON CONFLICT", "RETURNING"},
+		UpdateClauses:        []string{"UPDATE", "SET", "WHERE", "RETURNING"},
+		DeleteClauses:        []string{"DELETE", "FROM", "WHERE", "RETURNING"},
+		LastInsertIDReversed: true,
+	})
+	db.ClauseBuilders["INSERT"] = func(c clause.Clause, builder clause.Builder) {
+		insert, ok := c.Expression.(clause.Insert)
+		stmt, isStmt := builder.(*gorm.Statement)
+		if !ok || !isStmt {
+			c.Build(builder)
+			return
+		}
+		stmt.WriteString("INSERT ")
+		if insert.Modifier != "" {
+			stmt.WriteString(insert.Modifier + " ")
+		}
+		stmt.WriteString("INTO ")
+		if insert.Table.Name == "" {
+			stmt.WriteQuoted(stmt.Table)
+		} else {
+			stmt.WriteQuoted(insert.Table)
+		}
+	}
+	db.ClauseBuilders["LIMIT"] = func(c clause.Clause, builder clause.Builder) {
+		limit, ok := c.Expression.(clause.Limit)
+		if !ok {
+			return
+		}
+		// sqlite requires LIMIT before OFFSET, -1 is no limit
+		lmt := -1
+		if limit.Limit != nil && *limit.Limit >= 0 {
+			lmt = *limit.Limit
+		}
+		if lmt >= 0 || limit.Offset > 0 {
+			builder.WriteString("LIMIT " + strconv.Itoa(lmt))
+		}
+		if limit.Offset > 0 {
+			builder.WriteString(" OFFSET " + strconv.Itoa(limit.Offset))
+		}
+	}
+	db.ClauseBuilders["FOR"] = func(c clause.Clause, builder clause.Builder) {
+		// sqlite has no row level locks
+		if _, ok := c.Expression.(clause.Locking); !ok {
+			c.Build(builder)
+		}
+	}
+	return nil
+}
+
+func (d sqliteDryRunDialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return migrator.Migrator{Config: migrator.Config{DB: db, Dialector: d, CreateIndexAfterCreateTable: true}}
+}
+
+func (sqliteDryRunDialector) DataTypeOf(field *schema.Field) string {
+	switch field.DataType {
+	case schema.Bool:
+		return "numeric"
+	case schema.Int, schema.Uint:
+		if field.AutoIncrement && !field.PrimaryKey {
+			return "integer PRIMARY KEY AUTOINCREMENT"
+		}
+		return "integer"
+	case schema.Float:
+		return "real"
+	case schema.String:
+		return "text"
+	case schema.Time:
+		return "datetime"
+	case schema.Bytes:
+		return "blob"
+	}
+	return string(field.DataType)
+}
+
+func (sqliteDryRunDialector) DefaultValueOf(field *schema.Field) clause.Expression {
+	if field.AutoIncrement {
+		return clause.Expr{SQL: "NULL"}
+	}
+	return clause.Expr{SQL: "DEFAULT"}
+}
+
+func (sqliteDryRunDialector) BindVarTo(writer clause.Writer, _ *gorm.Statement, _ interface{}) {
+	writer.WriteByte('?')
+}
+
+func (sqliteDryRunDialector) QuoteTo(writer clause.Writer, str string) {
+	for i, part := range strings.Split(str, ".") {
+		if i > 0 {
+			writer.WriteByte('.')
+		}
+		writer.WriteString("`" + part + "`")
+	}
+}
+
+func (sqliteDryRunDialector) Explain(sql string, vars ...interface{}) string {
+	return logger.ExplainSQL(sql, nil, `"`, vars...)
+}
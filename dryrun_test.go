@@ -0,0 +1,55 @@
+package builder
+
+import (
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+type dryRunNode struct {
+	ID   int
+	Name string
+}
+
+func TestSQLiteDryRunMatchesDriver(t *testing.T) {
+	driverDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{DryRun: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("can't open sqlite database: %v", err)
+	}
+	if sqlDB, err := driverDB.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	m := NewDryRun(dialectSQLite)
+
+	queries := map[string]func(db *gorm.DB) *gorm.DB{
+		"offset only": func(db *gorm.DB) *gorm.DB {
+			var nodes []dryRunNode
+			return db.Offset(5).Find(&nodes)
+		},
+		"limit and locking": func(db *gorm.DB) *gorm.DB {
+			var nodes []dryRunNode
+			return db.Table("main.dry_run_nodes").Clauses(clause.Locking{Strength: "UPDATE"}).Limit(2).Find(&nodes)
+		},
+		"upsert": func(db *gorm.DB) *gorm.DB {
+			return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&dryRunNode{Name: "a"})
+		},
+		"insert or ignore": func(db *gorm.DB) *gorm.DB {
+			return db.Clauses(clause.Insert{Modifier: "OR IGNORE"}).Create(&dryRunNode{Name: "a"})
+		},
+		"delete returning": func(db *gorm.DB) *gorm.DB {
+			return db.Clauses(clause.Returning{}).Where("name = ?", "a").Delete(&dryRunNode{})
+		},
+	}
+	for name, query := range queries {
+		t.Run(name, func(t *testing.T) {
+			expected := query(driverDB.Session(&gorm.Session{})).Statement.SQL.String()
+			got := query(m.db.Session(&gorm.Session{})).Statement.SQL.String()
+			if expected == "" || got != expected {
+				t.Errorf("expected %s, got %s", expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package builder
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gorm-logged/common"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// mysqlDuplicateKey extracts key name from message of mysql duplicate entry error
+	mysqlDuplicateKey = regexp.MustCompile(`for key '([^']+)'`)
+	// mysqlForeignKey extracts constraint name from message of mysql foreign key error
+	mysqlForeignKey = regexp.MustCompile("CONSTRAINT `([^`]+)`")
+	// mysqlColumn extracts column name from message of mysql not null error
+	mysqlColumn = regexp.MustCompile(`Column '([^']+)'`)
+	// mysqlCheck extracts constraint name from message of mysql check error
+	mysqlCheck = regexp.MustCompile(`Check constraint '([^']+)'`)
+	// pgKeyColumn extracts column from detail of postgres violation, as example "Key (email)=(a@b.c) already exists."
+	pgKeyColumn = regexp.MustCompile(`^Key \(([^,)]+)\)=`)
+)
+
+// sqliteConstraints maps messages of sqlite constraint violations to common errors. Messages are matched instead
+// of error codes, so the sqlite driver, which needs cgo, isn't imported by the builder
+var sqliteConstraints = []struct {
+	msg    string
+	common error
+}{
+	{"UNIQUE constraint failed", common.ErrDuplicate},
+	{"FOREIGN KEY constraint failed", common.ErrForeignKey},
+	{"NOT NULL constraint failed", common.ErrNotNull},
+	{"CHECK constraint failed", common.ErrCheckViolation},
+}
+
+// classifiedError is database error mapped to common error
+type classifiedError struct {
+	// common is common error returned by finisher, common.ErrInternal for unexpected errors
+	common error
+	// constraint and column are names of violated constraint and column, as precise as driver reports them
+	constraint string
+	column     string
+	// table is name of table of violated constraint, reported by postgres only
+	table string
+	// hint explains known cause of unexpected error, as example missing extension
+	hint string
+}
+
+// expected reports whether error is caused by data rather than by outage or developer mistake
+func (c classifiedError) expected() bool {
+	return c.common != common.ErrInternal
+}
+
+// detail returns name of violated constraint or column
+func (c classifiedError) detail() string {
+	if c.constraint != "" {
+		return c.constraint
+	}
+	return c.column
+}
+
+// logFields returns names of violated constraint and column and hint for logs
+func (c classifiedError) logFields() logrus.Fields {
+	fields := logrus.Fields{}
+	if c.constraint != "" {
+		fields["constraint"] = c.constraint
+	}
+	if c.column != "" {
+		fields["column"] = c.column
+	}
+	if c.hint != "" {
+		fields["hint"] = c.hint
+	}
+	return fields
+}
+
+// classifyError maps database error to common error by error codes of drivers
+func classifyError(err error) classifiedError {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return classifiedError{common: common.ErrCanceled}
+	case errors.Is(err, context.DeadlineExceeded):
+		return classifiedError{common: common.ErrTimeout}
+	case errors.Is(err, common.ErrUnavailable):
+		return classifiedError{common: common.ErrUnavailable}
+	case errors.Is(err, common.ErrBadSort):
+		return classifiedError{common: common.ErrBadSort}
+	case errors.Is(err, common.ErrBadField):
+		return classifiedError{common: common.ErrBadField}
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		c := classifiedError{constraint: pgErr.ConstraintName, column: pgErr.ColumnName, table: pgErr.TableName}
+		if c.column == "" {
+			c.column = submatch(pgKeyColumn, pgErr.Detail)
+		}
+		switch pgErr.Code {
+		case "23505":
+			c.common = common.ErrDuplicate
+		case "23503":
+			c.common = common.ErrForeignKey
+		case "23502":
+			c.common = common.ErrNotNull
+		case "23514":
+			c.common = common.ErrCheckViolation
+		case "57014":
+			// statement timeout, query is canceled by server
+			return classifiedError{common: common.ErrTimeout}
+		case "42883":
+			// undefined function
+			if strings.Contains(pgErr.Message, "similarity(") {
+				return classifiedError{common: common.ErrInternal, hint: "pg_trgm extension is missing, install it by CREATE EXTENSION pg_trgm"}
+			}
+			return classifiedError{common: common.ErrInternal}
+		default:
+			return classifiedError{common: common.ErrInternal}
+		}
+		return c
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1062:
+			return classifiedError{common: common.ErrDuplicate, constraint: submatch(mysqlDuplicateKey, mysqlErr.Message)}
+		case 1451, 1452:
+			return classifiedError{common: common.ErrForeignKey, constraint: submatch(mysqlForeignKey, mysqlErr.Message)}
+		case 1048:
+			return classifiedError{common: common.ErrNotNull, column: submatch(mysqlColumn, mysqlErr.Message)}
+		case 3819:
+			return classifiedError{common: common.ErrCheckViolation, constraint: submatch(mysqlCheck, mysqlErr.Message)}
+		}
+	}
+	if err == nil {
+		return classifiedError{common: common.ErrInternal}
+	}
+	for _, c := range sqliteConstraints {
+		// sqlite reports detail after colon, as example "UNIQUE constraint failed: users.email"
+		_, detail, ok := strings.Cut(err.Error(), c.msg)
+		if !ok {
+			continue
+		}
+		detail = strings.TrimPrefix(detail, ": ")
+		switch c.common {
+		case common.ErrNotNull:
+			return classifiedError{common: c.common, column: detail}
+		case common.ErrForeignKey:
+			return classifiedError{common: c.common}
+		default:
+			return classifiedError{common: c.common, constraint: detail}
+		}
+	}
+	return classifiedError{common: common.ErrInternal}
+}
+
+// submatch returns the first group of re matched in s, empty string if s doesn't match
+func submatch(re *regexp.Regexp, s string) string {
+	if match := re.FindStringSubmatch(s); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// dbError maps database error to common error returned by finishers, original error stays reachable by errors.As.
+// Violated constraint or column is appended to message, so handlers can report which value is wrong.
+// Violations of constraints registered by WithConstraintMessages are returned as *common.ConstraintError
+func (m *Model) dbError(err error) error {
+	c := classifyError(err)
+	if !c.expected() {
+		return &common.InternalError{Ref: errorRef(), Err: err}
+	}
+	var mapped error = common.Wrap(c.common, err)
+	if c.detail() != "" {
+		mapped = fmt.Errorf("%w: %s", mapped, c.detail())
+	}
+	if constraint, msg := m.constraintMessage(c); msg != "" {
+		return &common.ConstraintError{Constraint: constraint, Msg: msg, Err: mapped}
+	}
+	return mapped
+}
+
+// constraintMessage looks up message registered by WithConstraintMessages, by constraint name first
+// and by "table.column" then. Returns key of found message and the message, empty strings if nothing is found
+func (m *Model) constraintMessage(c classifiedError) (string, string) {
+	if len(m.cfg.constraintMessages) == 0 {
+		return "", ""
+	}
+	keys := []string{c.constraint}
+	if c.table != "" && c.column != "" {
+		keys = append(keys, c.table+"."+c.column)
+	}
+	for _, key := range keys {
+		if msg := m.cfg.constraintMessages[key]; key != "" && msg != "" {
+			return key, msg
+		}
+	}
+	return "", ""
+}
+
+// notFound returns common.ErrNotFound with type name of dest and sql of the search
+func (m *Model) notFound(dest interface{}, res *gorm.DB) error {
+	if m.rawErrorsEnabled() {
+		return res.Error
+	}
+	t := reflect.TypeOf(dest)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice) {
+		t = t.Elem()
+	}
+	e := &common.NotFoundError{}
+	if t != nil {
+		e.Entity = t.Name()
+	}
+	if q, ok := res.Statement.Context.Value(queryKey{}).(*tracedQuery); ok {
+		e.Query = q.sql
+	}
+	return e
+}
+
+// errorRef generates short random reference of error log
+func errorRef() string {
+	b := make([]byte, 3)
+	_, _ = rand.Read(b)
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+// fail logs failure of finisher op, passes it to OnError hooks and returns error for the caller.
+// Error translator configured by WithErrorTranslator takes precedence over common errors
+func (m *Model) fail(op, msg string, err error, fields ...logrus.Fields) error {
+	mapped := m.dbError(err)
+	table := m.failedTable(fields)
+	fingerprint := m.fingerprint(err, table)
+	fields = append(fields, logrus.Fields{"fingerprint": fingerprint})
+	m.alertFailure(err, table, fingerprint)
+	var internal *common.InternalError
+	if errors.As(mapped, &internal) {
+		fields = append(fields, logrus.Fields{"errorRef": internal.Ref})
+	}
+	var constraint *common.ConstraintError
+	if errors.As(mapped, &constraint) {
+		fields = append(fields, logrus.Fields{"constraintMessage": constraint.Msg})
+	}
+	if m.cfg.errorTranslator != nil {
+		if translated := m.cfg.errorTranslator(m.operation(op), err); translated != nil {
+			fields = append(fields, logrus.Fields{"translatedError": fmt.Sprintf("%T", translated)})
+			m.logFailure(op, msg, err, fields...)
+			return translated
+		}
+	}
+	m.logFailure(op, msg, err, fields...)
+	if err != nil && m.rawErrorsEnabled() {
+		return err
+	}
+	return &common.FingerprintedError{Err: mapped, Print: fingerprint}
+}
+
+// RawErrors makes finishers of chain return errors of gorm and drivers as is instead of common errors,
+// failures are still logged. Transactions begun from the chain inherit it
+func (m *Model) RawErrors() *Model {
+	c := m.chain(m.db, m.logTrace)
+	c.rawErrors = true
+	return c
+}
+
+// rawErrorsEnabled reports whether finishers return errors as is, see RawErrors and WithRawErrors
+func (m *Model) rawErrorsEnabled() bool {
+	return m.rawErrors || m.cfg.rawErrors
+}
@@ -0,0 +1,217 @@
+package builder
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm-logged/common"
+
+	"github.com/jackc/pgconn"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type errorNode struct {
+	ID    int
+	Email string
+}
+
+// pgErrorConn fails every query with given postgres error
+type pgErrorConn struct {
+	err *pgconn.PgError
+}
+
+func (c pgErrorConn) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, c.err
+}
+
+func (c pgErrorConn) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, c.err
+}
+
+func (c pgErrorConn) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, c.err
+}
+
+func (c pgErrorConn) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return &sql.Row{}
+}
+
+// newPGErrorModel builds postgres model which queries fail with err
+func newPGErrorModel(t *testing.T, err *pgconn.PgError, opts ...Option) *Model {
+	t.Helper()
+	db, openErr := gorm.Open(postgres.New(postgres.Config{Conn: pgErrorConn{err: err}}), &gorm.Config{
+		Logger:               logger.Discard,
+		DisableAutomaticPing: true,
+	})
+	if openErr != nil {
+		t.Fatalf("can't open postgres model: %v", openErr)
+	}
+	l, _ := test.NewNullLogger()
+	m := NewFromDB(db, append([]Option{WithLogger(l)}, opts...)...)
+	return &m
+}
+
+func TestOriginalErrorIsReachable(t *testing.T) {
+	tests := []struct {
+		name   string
+		pgErr  *pgconn.PgError
+		common error
+	}{
+		{"internal", &pgconn.PgError{Code: "XX000", Message: "internal error"}, common.ErrInternal},
+		{"duplicate", &pgconn.PgError{Code: "23505", ConstraintName: "error_nodes_email_key"}, common.ErrDuplicate},
+		{"foreign key", &pgconn.PgError{Code: "23503", ConstraintName: "error_nodes_owner_fkey"}, common.ErrForeignKey},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := newPGErrorModel(t, test.pgErr)
+			err := m.Create(&errorNode{Email: "a@b.c"})
+			if !errors.Is(err, test.common) {
+				t.Fatalf("expected %v, got %v", test.common, err)
+			}
+			var pgErr *pgconn.PgError
+			if !errors.As(err, &pgErr) || pgErr != test.pgErr {
+				t.Errorf("postgres error isn't reachable by errors.As from %v", err)
+			}
+			if common.Unwrap(err) != error(test.pgErr) {
+				t.Errorf("common.Unwrap returns %v", common.Unwrap(err))
+			}
+		})
+	}
+}
+
+func TestNotFoundHasNoCause(t *testing.T) {
+	m := newTestModel(t, nil, &errorNode{})
+	var node errorNode
+	err := m.First(&node, 1)
+	if !errors.Is(err, common.ErrNotFound) || errors.Is(err, common.ErrInternal) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) || common.Unwrap(err) != err {
+		t.Errorf("not found error has cause: %#v", err)
+	}
+}
+
+// errEmailTaken is domain error of translator tests
+var errEmailTaken = errors.New("email is taken")
+
+func TestErrorTranslator(t *testing.T) {
+	var ops []string
+	translate := func(op string, err error) error {
+		ops = append(ops, op)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == "error_nodes_email_key" {
+			return errEmailTaken
+		}
+		return nil
+	}
+	l, hook := test.NewNullLogger()
+
+	m := newPGErrorModel(t, &pgconn.PgError{Code: "23505", ConstraintName: "error_nodes_email_key"},
+		WithErrorTranslator(translate), WithLogger(l))
+	if err := m.Create(&errorNode{Email: "a@b.c"}); err != errEmailTaken {
+		t.Errorf("expected translated error, got %v", err)
+	}
+	if entries := hook.AllEntries(); len(entries) != 1 || entries[0].Data["translatedError"] != "*errors.errorString" {
+		t.Errorf("type of translated error isn't logged: %v", entries)
+	}
+
+	// translator returns nil for other constraints, so default mapping applies
+	m = newPGErrorModel(t, &pgconn.PgError{Code: "23505", ConstraintName: "error_nodes_slug_key"},
+		WithErrorTranslator(translate), WithLogger(l))
+	err := m.Named("createNode").Create(&errorNode{Email: "a@b.c"})
+	if !errors.Is(err, common.ErrDuplicate) {
+		t.Errorf("expected duplicate error, got %v", err)
+	}
+	if len(ops) != 2 || ops[0] != "create" || ops[1] != "createNode" {
+		t.Errorf("unexpected operations passed to translator: %v", ops)
+	}
+}
+
+func TestRawErrors(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &errorNode{})
+	var node errorNode
+	if err := m.RawErrors().First(&node, 1); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected untranslated not found error, got %v", err)
+	}
+	if err := m.First(&node, 1); !errors.Is(err, common.ErrNotFound) {
+		t.Errorf("expected not found error without RawErrors, got %v", err)
+	}
+
+	hook.Reset()
+	err := m.RawErrors().Table("missing_table").First(&node)
+	if err == nil || errors.Is(err, common.ErrInternal) {
+		t.Errorf("expected raw error of missing table, got %v", err)
+	}
+	if entries := entriesAt(hook, logrus.ErrorLevel); len(entries) != 1 {
+		t.Errorf("raw error isn't logged, got %d error logs", len(entries))
+	}
+}
+
+func TestRawErrorsSurviveBegin(t *testing.T) {
+	m := newTestModel(t, nil, &errorNode{})
+	tx := m.RawErrors().Begin()
+	defer tx.EnsureRollback()
+	var node errorNode
+	if err := tx.Where("id = ?", 1).First(&node); err != gorm.ErrRecordNotFound {
+		t.Errorf("transaction doesn't inherit RawErrors, got %v", err)
+	}
+}
+
+func TestWithRawErrors(t *testing.T) {
+	m := newTestModel(t, []Option{WithRawErrors(true)}, &errorNode{})
+	var node errorNode
+	if err := m.First(&node, 1); err != gorm.ErrRecordNotFound {
+		t.Errorf("expected untranslated not found error, got %v", err)
+	}
+}
+
+type duplicateNode struct {
+	ID    int
+	Email string `gorm:"unique"`
+}
+
+func TestDuplicateOfMutations(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(m *Model) error
+	}{
+		{"create", func(m *Model) error {
+			return m.Create(&duplicateNode{Email: "taken@b.c"})
+		}},
+		{"create in batches", func(m *Model) error {
+			nodes := []duplicateNode{{Email: "free@b.c"}, {Email: "taken@b.c"}}
+			return m.CreateInBatches(&nodes, 1)
+		}},
+		{"updates", func(m *Model) error {
+			return m.Model(&duplicateNode{}).Where("email = ?", "other@b.c").Updates(map[string]interface{}{"email": "taken@b.c"})
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, hook := newLoggedModel(t, nil, &duplicateNode{})
+			nodes := []duplicateNode{{Email: "taken@b.c"}, {Email: "other@b.c"}}
+			if err := m.Create(&nodes); err != nil {
+				t.Fatalf("can't create nodes: %v", err)
+			}
+			hook.Reset()
+
+			err := test.mutate(m)
+			if !errors.Is(err, common.ErrDuplicate) {
+				t.Fatalf("expected duplicate error, got %v", err)
+			}
+			if !strings.HasSuffix(err.Error(), ": duplicate_nodes.email") {
+				t.Errorf("violated constraint isn't reported: %v", err)
+			}
+			if len(entriesAt(hook, logrus.ErrorLevel)) != 0 || len(entriesAt(hook, logrus.WarnLevel)) != 1 {
+				t.Errorf("duplicate isn't logged as single warning: %v", hook.AllEntries())
+			}
+		})
+	}
+}
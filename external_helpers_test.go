@@ -0,0 +1,31 @@
+package builder_test
+
+import (
+	"testing"
+
+	builder "gorm-logged"
+	"gorm-logged/common"
+	"gorm-logged/sqlitedb"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/gorm/logger"
+)
+
+// newLoggedModel works as newLoggedModel of package builder for tests declared outside of the package,
+// traces keep frames of the tests
+func newLoggedModel(t *testing.T, opts []builder.Option, models ...interface{}) (*builder.Model, *test.Hook) {
+	t.Helper()
+	// package of external tests doesn't belong to main module
+	common.SetProjectName("gorm-logged_test.")
+	t.Cleanup(func() { common.SetFrameFilter(nil) })
+	l, hook := test.NewNullLogger()
+	m, err := sqlitedb.New(":memory:", append([]builder.Option{builder.WithLogger(l), builder.WithGormLogLevel(logger.Silent)}, opts...)...)
+	if err != nil {
+		t.Fatalf("can't open database: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	if err := m.Migrate(models...); err != nil {
+		t.Fatalf("can't migrate database: %v", err)
+	}
+	return &m, hook
+}
@@ -0,0 +1,175 @@
+package builder
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// filterTag is struct tag read by ApplyFilter, as example `filter:"created_at,gte"`
+const filterTag = "filter"
+
+// filterOperators builds conditions of ApplyFilter by operator of tag
+var filterOperators = map[string]func(column clause.Column, value interface{}, dialect string) clause.Expression{
+	"eq": func(c clause.Column, v interface{}, _ string) clause.Expression {
+		return clause.Eq{Column: c, Value: v}
+	},
+	"ne": func(c clause.Column, v interface{}, _ string) clause.Expression {
+		return clause.Neq{Column: c, Value: v}
+	},
+	"gt": func(c clause.Column, v interface{}, _ string) clause.Expression {
+		return clause.Gt{Column: c, Value: v}
+	},
+	"gte": func(c clause.Column, v interface{}, _ string) clause.Expression {
+		return clause.Gte{Column: c, Value: v}
+	},
+	"lt": func(c clause.Column, v interface{}, _ string) clause.Expression {
+		return clause.Lt{Column: c, Value: v}
+	},
+	"lte": func(c clause.Column, v interface{}, _ string) clause.Expression {
+		return clause.Lte{Column: c, Value: v}
+	},
+	"like": func(c clause.Column, v interface{}, _ string) clause.Expression {
+		return clause.Like{Column: c, Value: v}
+	},
+	"ilike": func(c clause.Column, v interface{}, dialect string) clause.Expression {
+		if dialect == dialectPostgres {
+			return clause.Expr{SQL: "? ILIKE ?", Vars: []interface{}{c, v}}
+		}
+		return clause.Expr{SQL: "LOWER(?) LIKE LOWER(?)", Vars: []interface{}{c, v}}
+	},
+	"in": func(c clause.Column, v interface{}, _ string) clause.Expression {
+		return clause.IN{Column: c, Values: sliceValues(v)}
+	},
+}
+
+// appliedFilter is condition built by ApplyFilter from single field
+type appliedFilter struct {
+	column string
+	op     string
+	value  interface{}
+}
+
+// ApplyFilter is gorm extension. Adds condition for every field of filter struct tagged like `filter:"status,eq"`,
+// nil pointers and zero values are skipped, so pointers allow to filter by zero value. Operators are
+// eq (default), ne, gt, gte, lt, lte, like, ilike and in. Slices are matched by IN for eq and by NOT IN for ne.
+// Unknown operator fails finishers of chain
+func (m *Model) ApplyFilter(filter interface{}) *Model {
+	i := m.logTrace.freeIndex("filters")
+	v := reflect.Indirect(reflect.ValueOf(filter))
+	if v.Kind() != reflect.Struct {
+		trace := m.logTrace.with("typeOfFilter"+i, fmt.Sprintf("%T", filter))
+		return m.chain(m.db, trace).failed(fmt.Errorf("filter %T is not a struct", filter))
+	}
+
+	filters, invalid := collectFilters(v, nil, nil)
+	if len(invalid) > 0 {
+		trace := m.logTrace.with("typeOfFilter"+i, fmt.Sprintf("%T", filter)).with("invalidFilters"+i, invalid)
+		return m.chain(m.db, trace).failed(fmt.Errorf("filter %T has unknown operators in fields %v", filter, invalid))
+	}
+
+	summary := make([]string, 0, len(filters))
+	exprs := make([]clause.Expression, 0, len(filters))
+	for _, f := range filters {
+		column := clause.Column{Table: clause.CurrentTable, Name: f.column}
+		op := f.op
+		if isSlice(f.value) {
+			switch op {
+			case "eq":
+				op = "in"
+			case "ne":
+				exprs = append(exprs, clause.Not(filterOperators["in"](column, f.value, m.dialect())))
+				summary = append(summary, f.column+" not in")
+				continue
+			}
+		}
+		exprs = append(exprs, filterOperators[op](column, f.value, m.dialect()))
+		summary = append(summary, f.column+" "+op)
+	}
+	if len(exprs) == 0 {
+		return m
+	}
+	trace := m.logTrace.with("filters"+i, strings.Join(summary, ", "))
+	return m.chain(m.db.Clauses(clause.Where{Exprs: exprs}), trace)
+}
+
+// collectFilters reads tagged fields of struct, fields of exported embedded structs are read too.
+// Returns filters to apply and names of fields with unknown operators
+func collectFilters(v reflect.Value, filters []appliedFilter, invalid []string) ([]appliedFilter, []string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// fields of unexported embedded structs can't be read
+		if !v.Field(i).CanInterface() {
+			continue
+		}
+		tag, tagged := field.Tag.Lookup(filterTag)
+		if field.Anonymous && !tagged && reflect.Indirect(v.Field(i)).Kind() == reflect.Struct {
+			filters, invalid = collectFilters(reflect.Indirect(v.Field(i)), filters, invalid)
+			continue
+		}
+		if !tagged || tag == "-" || !field.IsExported() {
+			continue
+		}
+		column, op, _ := strings.Cut(tag, ",")
+		if op == "" {
+			op = "eq"
+		}
+		if _, ok := filterOperators[op]; !ok {
+			invalid = append(invalid, field.Name+" ("+op+")")
+			continue
+		}
+		value, ok := filterValue(v.Field(i))
+		if !ok {
+			continue
+		}
+		filters = append(filters, appliedFilter{column: column, op: op, value: value})
+	}
+	return filters, invalid
+}
+
+// filterValue dereferences value of filter field, false for nil pointers, empty slices and zero values
+func filterValue(v reflect.Value) (interface{}, bool) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		return v.Elem().Interface(), true
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return nil, false
+		}
+	default:
+		if t, ok := v.Interface().(time.Time); ok {
+			return t, !t.IsZero()
+		}
+		if v.IsZero() {
+			return nil, false
+		}
+	}
+	return v.Interface(), true
+}
+
+// isSlice reports whether value is slice or array, byte slices are single values
+func isSlice(value interface{}) bool {
+	v := reflect.ValueOf(value)
+	return (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8
+}
+
+// sliceValues converts slice or array to values of IN, single value otherwise
+func sliceValues(value interface{}) []interface{} {
+	v := reflect.ValueOf(value)
+	if !isSlice(value) {
+		return []interface{}{value}
+	}
+	values := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		values = append(values, v.Index(i).Interface())
+	}
+	return values
+}
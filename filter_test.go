@@ -0,0 +1,134 @@
+package builder
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+type order struct {
+	ID        int
+	Status    string
+	Name      string
+	Total     int
+	CreatedAt time.Time
+}
+
+type orderFilter struct {
+	Status   *string   `filter:"status"`
+	Statuses []string  `filter:"status,eq"`
+	Excluded []string  `filter:"status,ne"`
+	From     time.Time `filter:"created_at,gte"`
+	To       time.Time `filter:"created_at,lt"`
+	Name     string    `filter:"name,ilike"`
+	MinTotal *int      `filter:"total,gte"`
+	Ignored  string
+}
+
+type pagedFilter struct {
+	orderPaging
+	StatusFilter
+	Limit int `filter:"-"`
+}
+
+type StatusFilter struct {
+	Status *string `filter:"status"`
+}
+
+type orderPaging struct {
+	Page int `filter:"page"`
+}
+
+func TestApplyFilter(t *testing.T) {
+	status := "paid"
+	zero := 0
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	tests := []struct {
+		name   string
+		filter interface{}
+		where  string
+		vars   []interface{}
+	}{{
+		name:   "zero values and nil pointers are skipped",
+		filter: orderFilter{Ignored: "x"},
+		where:  "",
+	}, {
+		name:   "pointer filters by zero value",
+		filter: &orderFilter{Status: &status, MinTotal: &zero},
+		where:  `WHERE "orders"."status" = $1 AND "orders"."total" >= $2`,
+		vars:   []interface{}{"paid", 0},
+	}, {
+		name:   "slices are matched by IN and NOT IN",
+		filter: orderFilter{Statuses: []string{"new", "paid"}, Excluded: []string{"failed", "lost"}},
+		where:  `WHERE "orders"."status" IN ($1,$2) AND "orders"."status" NOT IN ($3,$4)`,
+		vars:   []interface{}{"new", "paid", "failed", "lost"},
+	}, {
+		name:   "time bounds",
+		filter: orderFilter{From: from, To: to, Name: "%bob%"},
+		where:  `WHERE "orders"."created_at" >= $1 AND "orders"."created_at" < $2 AND "orders"."name" ILIKE $3`,
+		vars:   []interface{}{from, to, "%bob%"},
+	}, {
+		name:   "unexported embedded structs are skipped",
+		filter: pagedFilter{orderPaging: orderPaging{Page: 2}, StatusFilter: StatusFilter{Status: &status}, Limit: 10},
+		where:  `WHERE "orders"."status" = $1`,
+		vars:   []interface{}{"paid"},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewDryRun(dialectPostgres)
+			var dest []order
+			if err := m.ApplyFilter(tt.filter).Find(&dest); err != nil {
+				t.Fatalf("can't build query: %v", err)
+			}
+			sql, vars := m.LastSQL()
+			_, where, _ := strings.Cut(sql, `FROM "orders"`)
+			if strings.TrimSpace(where) != tt.where {
+				t.Fatalf("expected %q, got %q", tt.where, strings.TrimSpace(where))
+			}
+			if len(vars) != 0 || len(tt.vars) != 0 {
+				if !reflect.DeepEqual(vars, tt.vars) {
+					t.Fatalf("expected vars %v, got %v", tt.vars, vars)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyFilterUnknownOperator(t *testing.T) {
+	type badFilter struct {
+		Name  string `filter:"name,contains"`
+		Total int    `filter:"total,between"`
+	}
+	m, hook := newLoggedModel(t, nil, &order{})
+	var dest []order
+	err := m.Model(&order{}).ApplyFilter(badFilter{}).Find(&dest)
+	if !errors.Is(err, common.ErrInternal) {
+		t.Fatalf("expected internal error, got %v", err)
+	}
+	entries := entriesAt(hook, logrus.ErrorLevel)
+	if len(entries) != 1 {
+		t.Fatalf("expected single error log, got %d", len(entries))
+	}
+	invalid := entries[0].Data["invalidFilters0"]
+	if !reflect.DeepEqual(invalid, []string{"Name (contains)", "Total (between)"}) {
+		t.Fatalf("expected offending fields logged, got %v", invalid)
+	}
+}
+
+func TestApplyFilterNotStruct(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &order{})
+	var dest []order
+	if err := m.Model(&order{}).ApplyFilter("status = 1").Find(&dest); !errors.Is(err, common.ErrInternal) {
+		t.Fatalf("expected internal error, got %v", err)
+	}
+	if entries := entriesAt(hook, logrus.ErrorLevel); len(entries) != 1 {
+		t.Fatalf("expected single error log, got %d", len(entries))
+	}
+}
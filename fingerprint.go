@@ -0,0 +1,68 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+// builderPackage is import path of the package, its frames are skipped while looking for call site
+var builderPackage = reflect.TypeOf(Model{}).PkgPath()
+
+// fingerprint returns stable hash of failure for grouping of logs by alerting:
+// kind of classified error, table of failed query and the first calling frame outside of the package and gorm
+func (m *Model) fingerprint(err error, table string) string {
+	var kind error = common.ErrInternal
+	if err != nil {
+		kind = classifyError(err).common
+	}
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s", kind, table, callSite())))
+	return hex.EncodeToString(h[:8])
+}
+
+// failedTable returns table of chain or, if chain gets model only by finisher, table of failed query
+// logged by sqlFields. Empty string if neither is known
+func (m *Model) failedTable(fields []logrus.Fields) string {
+	stmt := m.db.Statement
+	switch {
+	case stmt.Table != "":
+		return stmt.Table
+	case stmt.Schema != nil:
+		return stmt.Schema.Table
+	case stmt.Model != nil:
+		table, _ := m.tableName(stmt.Model)
+		return table
+	}
+	for _, f := range fields {
+		if table, ok := f["sqlTable"].(string); ok {
+			return table
+		}
+	}
+	return ""
+}
+
+// callSite returns function and line of the first frame outside of the package, its subpackages and gorm
+func callSite() string {
+	// skip callSite
+	frame, ok := common.CaptureFrames(1, 0).SkipLeading(isLibraryFrame).First()
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", frame.Function, frame.Line)
+}
+
+// isLibraryFrame reports whether function belongs to the package, its subpackages, gorm or runtime
+func isLibraryFrame(function string) bool {
+	for _, prefix := range []string{builderPackage + ".", builderPackage + "/", "gorm.io/", "runtime."} {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+// Tests are declared outside of the package, since frames of the package are skipped while looking for call site
+package builder_test
+
+import (
+	"testing"
+
+	builder "gorm-logged"
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+type printNode struct {
+	ID   int
+	Name string
+}
+
+type otherPrintNode struct {
+	ID int
+}
+
+// findBroken fails finder of nodes from the same call site
+func findBroken(m *builder.Model, name string) error {
+	var nodes []printNode
+	return m.Where("no_such_column = ?", name).Find(&nodes)
+}
+
+func TestFingerprintOfSameCallSite(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &printNode{}, &otherPrintNode{})
+	var prints []string
+	for _, name := range []string{"a", "b"} {
+		err := findBroken(m, name)
+		if err == nil {
+			t.Fatal("expected error of unknown column")
+		}
+		prints = append(prints, common.Fingerprint(err))
+	}
+	if prints[0] == "" || prints[0] != prints[1] {
+		t.Errorf("failures of the same call site have different fingerprints %q", prints)
+	}
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.ErrorLevel && entry.Data["fingerprint"] != prints[0] {
+			t.Errorf("fingerprint isn't logged by %q: %v", entry.Message, entry.Data)
+		}
+	}
+}
+
+func TestFingerprintOfDifferentCallSites(t *testing.T) {
+	m, _ := newLoggedModel(t, nil, &printNode{}, &otherPrintNode{})
+	var nodes []printNode
+	first := m.Where("no_such_column = ?", 1).Find(&nodes)
+	second := m.Where("no_such_column = ?", 1).Find(&nodes)
+	if first == nil || second == nil {
+		t.Fatal("expected errors of unknown column")
+	}
+	if common.Fingerprint(first) == common.Fingerprint(second) {
+		t.Errorf("failures of different call sites have the same fingerprint %q", common.Fingerprint(first))
+	}
+}
+
+func TestFingerprintOfDifferentTables(t *testing.T) {
+	m, _ := newLoggedModel(t, nil, &printNode{}, &otherPrintNode{})
+	var prints []string
+	for _, dest := range []interface{}{&[]printNode{}, &[]otherPrintNode{}} {
+		err := m.Where("no_such_column = ?", 1).Find(dest)
+		if err == nil {
+			t.Fatal("expected error of unknown column")
+		}
+		prints = append(prints, common.Fingerprint(err))
+	}
+	if prints[0] == prints[1] {
+		t.Errorf("failures of different tables have the same fingerprint %q", prints[0])
+	}
+}
+
+func TestFingerprintMethod(t *testing.T) {
+	m, _ := newLoggedModel(t, nil, &printNode{}, &otherPrintNode{})
+	err := findBroken(m, "a")
+	fingerprinted, ok := err.(interface{ Fingerprint() string })
+	if !ok {
+		t.Fatalf("error %T has no fingerprint", err)
+	}
+	if fingerprinted.Fingerprint() != common.Fingerprint(err) || len(fingerprinted.Fingerprint()) != 16 {
+		t.Errorf("unexpected fingerprint %q", fingerprinted.Fingerprint())
+	}
+}
@@ -0,0 +1,221 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm/clause"
+)
+
+// fixtureRefPrefix marks value which must be replaced by id of previously inserted row,
+// as example "$ref:users.0" is id of the first row from users fixture
+const fixtureRefPrefix = "$ref:"
+
+// fixtureOrderPrefix allows to order fixture files, as example "01_users.yml" is loaded before "02_posts.yml"
+var fixtureOrderPrefix = regexp.MustCompile(`^\d+_`)
+
+// FixtureOption configures LoadFixtures
+type FixtureOption func(*fixtureConfig)
+
+type fixtureConfig struct {
+	truncate bool
+}
+
+// WithTruncate clears tables of fixtures before loading, requires WithAllowDestructive option of the model
+func WithTruncate() FixtureOption {
+	return func(cfg *fixtureConfig) {
+		cfg.truncate = true
+	}
+}
+
+// fixture is content of single fixture file
+type fixture struct {
+	file  string
+	table string
+	rows  []map[string]interface{}
+}
+
+// LoadFixtures inserts rows from yaml and json files of dir into tables named after files.
+// Files are loaded in lexical order, rows are inserted in file order. All rows are inserted in one transaction,
+// so any failure rollbacks the whole loading. Values like "$ref:users.0" are replaced by id of referenced row
+func (m *Model) LoadFixtures(fsys fs.FS, dir string, opts ...FixtureOption) error {
+	// loading relies on INSERT ... RETURNING
+	if err := m.requireDialect("LoadFixtures", dialectPostgres, dialectSQLite); err != nil {
+		return err
+	}
+	var cfg fixtureConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.truncate && !m.cfg.allowDestructive {
+		m.logError("queryBuilder.LoadFixtures called WithTruncate without WithAllowDestructive option", nil,
+			logrus.Fields{"trace": m.frames()})
+		return common.ErrDestructiveNotAllowed
+	}
+
+	fixtures, err := readFixtures(fsys, dir)
+	if err != nil {
+		return m.fail("loadFixtures", "can't read fixtures", err, logrus.Fields{
+			"fixturesDir": dir,
+			"trace":       m.frames(),
+		})
+	}
+
+	return m.Transaction(func(tx *Model) error {
+		if cfg.truncate {
+			if err := tx.truncateFixtureTables(fixtures); err != nil {
+				return err
+			}
+		}
+
+		ids := make(map[string][]interface{}, len(fixtures))
+		for _, f := range fixtures {
+			for i, row := range f.rows {
+				id, err := tx.insertFixtureRow(f.table, row, ids)
+				if err != nil {
+					return m.fail("loadFixtures", "can't load fixture row", err, logrus.Fields{
+						"fixtureFile":     f.file,
+						"fixtureRowIndex": i,
+						"trace":           m.frames(),
+					})
+				}
+				ids[f.table] = append(ids[f.table], id)
+			}
+		}
+		return nil
+	})
+}
+
+// truncateFixtureTables clears tables of fixtures, sqlite has no TRUNCATE so rows are deleted there
+func (m *Model) truncateFixtureTables(fixtures []fixture) error {
+	if len(fixtures) == 0 {
+		return nil
+	}
+	tables := make([]string, 0, len(fixtures))
+	for _, f := range fixtures {
+		tables = append(tables, m.db.Statement.Quote(clause.Table{Name: f.table}))
+	}
+	if m.dialect() != dialectSQLite {
+		return m.exec("TRUNCATE " + strings.Join(tables, ", ") + " RESTART IDENTITY")
+	}
+	for _, table := range tables {
+		if err := m.exec("DELETE FROM " + table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertFixtureRow resolves references of row, inserts it into table and returns its id
+func (m *Model) insertFixtureRow(table string, row map[string]interface{}, ids map[string][]interface{}) (interface{}, error) {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	quoted := make([]string, 0, len(columns))
+	values := make([]interface{}, 0, len(columns))
+	for _, column := range columns {
+		value, err := resolveFixtureRef(row[column], ids)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", column, err)
+		}
+		quoted = append(quoted, m.db.Statement.Quote(column))
+		values = append(values, value)
+	}
+
+	sql := "INSERT INTO " + m.db.Statement.Quote(clause.Table{Name: table}) +
+		" (" + strings.Join(quoted, ", ") + ") VALUES (" + strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ") + ") RETURNING *"
+	inserted := make(map[string]interface{})
+	if err := m.db.Raw(sql, values...).Scan(&inserted).Error; err != nil {
+		return nil, err
+	}
+	return inserted["id"], nil
+}
+
+// resolveFixtureRef replaces "$ref:table.index" value by id of referenced row
+func resolveFixtureRef(value interface{}, ids map[string][]interface{}) (interface{}, error) {
+	ref, ok := value.(string)
+	if !ok || !strings.HasPrefix(ref, fixtureRefPrefix) {
+		return value, nil
+	}
+	dot := strings.LastIndex(ref, ".")
+	if dot < 0 {
+		return nil, fmt.Errorf("malformed reference %q, expected %stable.index", ref, fixtureRefPrefix)
+	}
+	table := ref[len(fixtureRefPrefix):dot]
+	index, err := strconv.Atoi(ref[dot+1:])
+	if err != nil || index < 0 || index >= len(ids[table]) {
+		return nil, fmt.Errorf("reference %q points to row which is not inserted yet", ref)
+	}
+	return ids[table][index], nil
+}
+
+// readFixtures reads all yaml and json files of dir in lexical order
+func readFixtures(fsys fs.FS, dir string) ([]fixture, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var fixtures []fixture
+	for _, entry := range entries {
+		ext := path.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yml" && ext != ".yaml" && ext != ".json") {
+			continue
+		}
+		file := path.Join(dir, entry.Name())
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var rows []map[string]interface{}
+		if ext == ".json" {
+			decoder := json.NewDecoder(bytes.NewReader(content))
+			decoder.UseNumber()
+			err = decoder.Decode(&rows)
+			for _, row := range rows {
+				for column, value := range row {
+					row[column] = normalizeJSONNumber(value)
+				}
+			}
+		} else {
+			err = yaml.Unmarshal(content, &rows)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		fixtures = append(fixtures, fixture{
+			file:  file,
+			table: fixtureOrderPrefix.ReplaceAllString(strings.TrimSuffix(entry.Name(), ext), ""),
+			rows:  rows,
+		})
+	}
+	return fixtures, nil
+}
+
+// normalizeJSONNumber converts json.Number to int64 or float64, so driver gets native types
+func normalizeJSONNumber(value interface{}) interface{} {
+	number, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if i, err := number.Int64(); err == nil {
+		return i
+	}
+	if f, err := number.Float64(); err == nil {
+		return f
+	}
+	return number.String()
+}
@@ -0,0 +1,65 @@
+package builder
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+)
+
+// defaultTextSearchConfig is text search configuration of WhereFullText and OrderByRank by default
+const defaultTextSearchConfig = "english"
+
+// WhereFullText is gorm extension. Matches tsvector column against plain text query by plainto_tsquery,
+// so quotes and operators of query are searched as words. config overrides "english" text search configuration.
+// Empty query adds no condition
+func (m *Model) WhereFullText(column string, query string, config ...string) *Model {
+	cfg, ok := m.textSearch("WhereFullText", column, query, config)
+	if !ok {
+		return m
+	}
+	trace := m.logTrace
+	i := trace.freeIndex("fullTextColumn")
+	trace = trace.with("fullTextColumn"+i, column).with("fullTextQuery"+i, query).with("fullTextConfig"+i, cfg)
+	if err := m.requireDialect("WhereFullText", dialectPostgres); err != nil {
+		return m.chain(m.db, trace).failed(err)
+	}
+	return m.chain(m.db.Where(clause.Expr{
+		SQL:  "? @@ plainto_tsquery(?::regconfig, ?)",
+		Vars: []interface{}{clause.Column{Name: column}, cfg, query},
+	}), trace)
+}
+
+// OrderByRank is gorm extension. Orders chain by ts_rank of tsvector column against plain text query,
+// the most relevant rows first. Empty query adds no ordering
+func (m *Model) OrderByRank(column string, query string, config ...string) *Model {
+	cfg, ok := m.textSearch("OrderByRank", column, query, config)
+	if !ok {
+		return m
+	}
+	trace := m.logTrace
+	i := trace.freeIndex("rankColumn")
+	trace = trace.with("rankColumn"+i, column).with("rankQuery"+i, query).with("rankConfig"+i, cfg)
+	if err := m.requireDialect("OrderByRank", dialectPostgres); err != nil {
+		return m.chain(m.db, trace).failed(err)
+	}
+	return m.chain(addOrder(m.db, clause.OrderBy{Expression: clause.Expr{
+		SQL:  "ts_rank(?, plainto_tsquery(?::regconfig, ?)) DESC",
+		Vars: []interface{}{clause.Column{Name: column}, cfg, query},
+	}}), trace)
+}
+
+// textSearch returns text search configuration, false with debug log for empty query
+func (m *Model) textSearch(feature, column, query string, config []string) (string, bool) {
+	if strings.TrimSpace(query) == "" {
+		m.logDebug("queryBuilder."+feature+" called with empty query, no condition is added", nil, logrus.Fields{
+			"textSearchColumn": column,
+			"trace":            m.frames(),
+		})
+		return "", false
+	}
+	if len(config) > 0 && config[0] != "" {
+		return config[0], true
+	}
+	return defaultTextSearchConfig, true
+}
@@ -0,0 +1,87 @@
+package builder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm/clause"
+)
+
+type article struct {
+	ID       int
+	Title    string
+	Document string
+}
+
+func TestWhereFullTextBindsQuery(t *testing.T) {
+	m := NewDryRun(dialectPostgres)
+	for _, query := range []string{`it's "quoted"`, "cats & !dogs | (birds)", `back\slash`} {
+		var dest []article
+		if err := m.WhereFullText("document", query).Find(&dest); err != nil {
+			t.Fatalf("can't build query %q: %v", query, err)
+		}
+		sql, vars := m.LastSQL()
+		if !strings.Contains(sql, `"document" @@ plainto_tsquery($1::regconfig, $2)`) {
+			t.Fatalf("unexpected sql of query %q: %s", query, sql)
+		}
+		if !reflect.DeepEqual(vars, []interface{}{"english", query}) {
+			t.Fatalf("expected query bound as is, got %v", vars)
+		}
+	}
+}
+
+func TestWhereFullTextSkipsEmptyQuery(t *testing.T) {
+	m := NewDryRun(dialectPostgres)
+	var dest []article
+	if err := m.WhereFullText("document", " \t").Find(&dest); err != nil {
+		t.Fatalf("can't build query: %v", err)
+	}
+	if sql, _ := m.LastSQL(); strings.Contains(sql, "WHERE") {
+		t.Fatalf("expected no condition for empty query, got %s", sql)
+	}
+}
+
+func TestOrderByRankBindsQuery(t *testing.T) {
+	m := NewDryRun(dialectPostgres)
+	query := `o'reilly & "go"`
+	var dest []article
+	if err := m.Order("id").OrderByRank("document", query, "simple").Order("title").Find(&dest); err != nil {
+		t.Fatalf("can't build query: %v", err)
+	}
+	sql, vars := m.LastSQL()
+	want := `ORDER BY id,ts_rank("document", plainto_tsquery($1::regconfig, $2)) DESC,title`
+	if !strings.HasSuffix(sql, want) {
+		t.Fatalf("expected ordering %s, got %s", want, sql)
+	}
+	if !reflect.DeepEqual(vars, []interface{}{"simple", query}) {
+		t.Fatalf("expected query bound as is, got %v", vars)
+	}
+}
+
+func TestOrderByRankAfterWhere(t *testing.T) {
+	m := NewDryRun(dialectPostgres)
+	var dest []article
+	if err := m.WhereFullText("document", "go").OrderByRank("document", "go").Where("id > ?", 10).Find(&dest); err != nil {
+		t.Fatalf("can't build query: %v", err)
+	}
+	sql, vars := m.LastSQL()
+	if !strings.HasSuffix(sql, `ORDER BY ts_rank("document", plainto_tsquery($4::regconfig, $5)) DESC`) {
+		t.Fatalf("expected ordering vars numbered after conditions, got %s", sql)
+	}
+	if !reflect.DeepEqual(vars, []interface{}{"english", "go", 10, "english", "go"}) {
+		t.Fatalf("unexpected vars %v", vars)
+	}
+}
+
+func TestReorderReplacesRank(t *testing.T) {
+	m := NewDryRun(dialectPostgres)
+	var dest []article
+	reorder := clause.OrderByColumn{Column: clause.Column{Name: "title"}, Reorder: true}
+	if err := m.OrderByRank("document", "go").Order(reorder).Find(&dest); err != nil {
+		t.Fatalf("can't build query: %v", err)
+	}
+	if sql, _ := m.LastSQL(); !strings.HasSuffix(sql, `ORDER BY "title"`) {
+		t.Fatalf("expected ordering replaced by reorder, got %s", sql)
+	}
+}
@@ -0,0 +1,79 @@
+package builder
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/logger"
+)
+
+// SlowThreshold overrides threshold of slow queries for chain, see WithSlowThreshold
+func (m *Model) SlowThreshold(d time.Duration) *Model {
+	c := m.chain(m.db, m.logTrace)
+	c.slowThreshold = d
+	return c
+}
+
+// gormLogger logs slow queries by logger of the package with trace of chain,
+// everything else is delegated to default gorm logger
+type gormLogger struct {
+	logger.Interface
+	cfg   *config
+	level logger.LogLevel
+}
+
+// LogMode is logger.Interface func
+func (l gormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	l.Interface = l.Interface.LogMode(level)
+	l.level = level
+	return l
+}
+
+// Trace is logger.Interface func
+func (l gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	var m *Model
+	q, ok := ctx.Value(queryKey{}).(*tracedQuery)
+	if ok {
+		m = q.m
+		if err != nil {
+			q.elapsed = elapsed
+		}
+	}
+	threshold := l.cfg.slowThreshold
+	if m != nil && m.slowThreshold > 0 {
+		threshold = m.slowThreshold
+	}
+	if err != nil || threshold == 0 || elapsed <= threshold || l.level < logger.Warn {
+		l.Interface.Trace(ctx, begin, fc, err)
+		return
+	}
+
+	// sql of fc has values inlined, so it's never logged
+	sql, rows := fc()
+	fields := logrus.Fields{
+		"duration":      elapsed.String(),
+		"slowThreshold": threshold.String(),
+		"rows":          rows,
+	}
+	if m == nil || q.stmt == nil {
+		// values of query run outside of chain can't be redacted, so its sql isn't logged
+		fields["trace"] = l.cfg.captureFrames(1)
+		l.cfg.logger.Warn("slow query", fields)
+		return
+	}
+	fields["sql"] = cutSQL(q.stmt.SQL.String())
+	if vars := redactVars(q.stmt, l.cfg.redactedFields); len(vars) > 0 {
+		fields["sqlVars"] = m.printCapped(vars, maxLoggedSQLLen)
+	}
+	fields["trace"] = m.frames()
+	if e := l.cfg.autoExplain; e != nil && elapsed > e.threshold && e.allow(sql, time.Now()) {
+		if plan, err := m.explain(ctx, sql); err != nil {
+			fields["planError"] = err.Error()
+		} else {
+			fields["plan"] = plan
+		}
+	}
+	m.logWarn("slow query", nil, fields)
+}
@@ -0,0 +1,61 @@
+package builder
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/gorm/logger"
+)
+
+// newSlowLoggedModel opens model, which logs queries of chains with SlowThreshold(time.Nanosecond) as slow
+func newSlowLoggedModel(t *testing.T, opts ...Option) (*Model, *test.Hook) {
+	t.Helper()
+	// slow queries are logged from warning level of gorm
+	opts = append([]Option{WithSlowThreshold(time.Hour), WithGormLogLevel(logger.Warn), WithLogWriter(io.Discard)}, opts...)
+	return newLoggedModel(t, opts, &redactedUser{})
+}
+
+func TestSlowQueryIsLogged(t *testing.T) {
+	m, hook := newSlowLoggedModel(t)
+	var users []redactedUser
+	if err := m.SlowThreshold(time.Nanosecond).Where("name = ?", "a").Find(&users); err != nil {
+		t.Fatalf("can't find users: %v", err)
+	}
+	entries := entriesAt(hook, logrus.WarnLevel)
+	if len(entries) != 1 || entries[0].Message != "slow query" {
+		t.Fatalf("slow query isn't logged: %v", hook.AllEntries())
+	}
+	sql, _ := entries[0].Data["sql"].(string)
+	if !strings.Contains(sql, "name = ?") {
+		t.Errorf("sql is logged with values: %q", sql)
+	}
+	if vars, _ := entries[0].Data["sqlVars"].(string); !strings.Contains(vars, "a") {
+		t.Errorf("vars aren't logged: %v", entries[0].Data)
+	}
+}
+
+func TestSlowQueryIsRedacted(t *testing.T) {
+	m, hook := newSlowLoggedModel(t, WithRedactedFields("password"))
+	user := &redactedUser{Name: "a", Password: "password-value", Token: "token-value"}
+	if err := m.SlowThreshold(time.Nanosecond).Create(user); err != nil {
+		t.Fatalf("can't create user: %v", err)
+	}
+	entries := entriesAt(hook, logrus.WarnLevel)
+	if len(entries) != 1 {
+		t.Fatalf("slow query isn't logged: %v", hook.AllEntries())
+	}
+	for key, value := range entries[0].Data {
+		printed := fmt.Sprint(value)
+		if strings.Contains(printed, "password-value") || strings.Contains(printed, "token-value") {
+			t.Errorf("secret is logged in %s: %s", key, printed)
+		}
+	}
+	if _, ok := entries[0].Data["sql"]; !ok {
+		t.Errorf("sql isn't logged: %v", entries[0].Data)
+	}
+}
@@ -0,0 +1,52 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm/logger"
+)
+
+// newTestModel opens in-memory sqlite database with migrated models, as sqlitedb.NewTestModel does
+// with given options, which can't be imported by tests of the package
+func newTestModel(t testing.TB, opts []Option, models ...interface{}) *Model {
+	t.Helper()
+	opts = append([]Option{WithAllowDestructive(true)}, opts...)
+	m, err := NewWithDialector(sqlite.Open(":memory:"), append(opts, WithMaxOpenConns(1))...)
+	if err != nil {
+		t.Fatalf("can't open test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := m.Close(); err != nil {
+			t.Errorf("can't close test database: %v", err)
+		}
+	})
+	if err := m.Migrate(models...); err != nil {
+		t.Fatalf("can't migrate test database: %v", err)
+	}
+	return &m
+}
+
+// newLoggedModel opens in-memory sqlite database with migrated models, logs of the package are captured by hook
+func newLoggedModel(t testing.TB, opts []Option, models ...interface{}) (*Model, *test.Hook) {
+	t.Helper()
+	l, hook := test.NewNullLogger()
+	l.SetLevel(logrus.DebugLevel)
+	m := newTestModel(t, append([]Option{WithLogger(l), WithGormLogLevel(logger.Silent)}, opts...), models...)
+	// logs of migration aren't interesting for tests
+	hook.Reset()
+	return m, hook
+}
+
+// entriesAt returns entries captured by hook at given level
+func entriesAt(hook *test.Hook, level logrus.Level) []logrus.Entry {
+	var res []logrus.Entry
+	for _, e := range hook.AllEntries() {
+		if e.Level == level {
+			res = append(res, *e)
+		}
+	}
+	return res
+}
@@ -0,0 +1,78 @@
+package builder
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrorHook receives failed finisher, see OnError
+type ErrorHook func(op string, err error, fields logrus.Fields)
+
+// LogSuppressedField is set in fields passed to ErrorHook when error log is suppressed by sampling or Silent,
+// so hooks reporting errors elsewhere can follow the same decision
+const LogSuppressedField = "logSuppressed"
+
+// OnError calls fc for every failed finisher after the failure is logged.
+// Fields are the same as logged ones, including trace of chain and calling frames.
+// If error log was suppressed by sampling or Silent, fields have "logSuppressed": true.
+// fc is called synchronously, its panic is recovered and logged
+func OnError(fc ErrorHook) Option {
+	return func(cfg *config) {
+		cfg.onError = append(cfg.onError, fc)
+	}
+}
+
+// OnQuery calls fc for every finished query with its duration and affected rows.
+// fc is called synchronously, its panic is recovered and logged
+func OnQuery(fc func(op string, d time.Duration, rows int64)) Option {
+	return func(cfg *config) {
+		cfg.onQuery = append(cfg.onQuery, fc)
+	}
+}
+
+// logFailure logs failure of finisher op and passes it to OnError hooks, op is overridden by Named.
+// Failures caused by data, like constraint violations, are logged as warnings, Silent skips them as well
+func (m *Model) logFailure(op, msg string, err error, fields ...logrus.Fields) {
+	c := classifyError(err)
+	fields = append(fields, c.logFields())
+	var logged bool
+	switch {
+	case !c.expected():
+		logged = m.logError(msg, err, fields...)
+	case !m.silent:
+		m.logWarn(msg, err, fields...)
+		logged = true
+	}
+	if len(m.cfg.onError) == 0 {
+		return
+	}
+	if !logged {
+		fields = append(fields, logrus.Fields{LogSuppressedField: true})
+	}
+	op = m.operation(op)
+	assembled := logrus.Fields(m.logFields(err, fields))
+	for _, fc := range m.cfg.onError {
+		m.runHook(op, func() { fc(op, err, assembled) })
+	}
+}
+
+// runQueryHooks passes finished query to OnQuery hooks
+func (m *Model) runQueryHooks(op string, d time.Duration, rows int64) {
+	for _, fc := range m.cfg.onQuery {
+		m.runHook(op, func() { fc(op, d, rows) })
+	}
+}
+
+// runHook calls hook, recovers and logs its panic
+func (m *Model) runHook(op string, hook func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			m.cfg.logger.Error("hook panicked", logrus.Fields{
+				"operation": op,
+				"panic":     r,
+			})
+		}
+	}()
+	hook()
+}
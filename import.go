@@ -0,0 +1,296 @@
+package builder
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/schema"
+)
+
+// importBatchSize is count of rows inserted by single query of ImportCSV by default
+const importBatchSize = 1000
+
+// importLoggedLineLen limits length of logged line of ImportCSV
+const importLoggedLineLen = 512
+
+// ImportOptions configures ImportCSV
+type ImportOptions struct {
+	// Comma is field delimiter, ',' by default, '\t' for tsv
+	Comma rune
+	// Columns maps header names to struct fields or columns, headers are matched to fields
+	// by name, column and csv tag by default
+	Columns map[string]string
+	// BatchSize is count of rows inserted by single query, 1000 by default
+	BatchSize int
+	// Validate is called for every parsed row with pointer to model, error rejects the row
+	Validate func(line int, record interface{}) error
+	// SkipMalformed skips rows which can't be parsed or are rejected by Validate, import fails on them by default
+	SkipMalformed bool
+	// Autocommit commits every batch separately, the whole import runs in single transaction by default
+	Autocommit bool
+	// Report receives rejected rows, can be nil
+	Report *ImportReport
+}
+
+// ImportReport lists rows rejected by ImportCSV
+type ImportReport struct {
+	Rejected []RejectedRow
+}
+
+// RejectedRow is row of file rejected by ImportCSV
+type RejectedRow struct {
+	// Line is number of line in file, header is line 1
+	Line   int
+	Reason string
+}
+
+// importColumn is column of file mapped to field of model
+type importColumn struct {
+	index int
+	field *schema.Field
+}
+
+// ImportCSV is gorm extension. Loads delimited file with header into table of model, which is struct like &User{}.
+// Rows are inserted by batches using COPY on postgres and batched inserts otherwise. Returns count of imported rows
+func (m *Model) ImportCSV(r io.Reader, model interface{}, opts ImportOptions) (int64, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = importBatchSize
+	}
+	s, err := m.parseSchema(model)
+	if err != nil {
+		return 0, m.fail("importCSV", "can't parse schema of imported model", err, logrus.Fields{"trace": m.frames()})
+	}
+	reader := csv.NewReader(r)
+	if opts.Comma != 0 {
+		reader.Comma = opts.Comma
+	}
+	header, err := reader.Read()
+	if err != nil {
+		return 0, m.fail("importCSV", "can't read header of imported file", err, logrus.Fields{"trace": m.frames()})
+	}
+	columns, unknown := importColumns(s, header, opts.Columns)
+	if len(unknown) > 0 {
+		m.logError("queryBuilder.ImportCSV called with file which has columns without fields", nil, logrus.Fields{
+			"importModel":          s.Name,
+			"unknownImportColumns": unknown,
+			"trace":                m.frames(),
+		})
+		return 0, common.ErrInternal
+	}
+
+	if opts.Autocommit {
+		return m.importRows(reader, s, columns, opts)
+	}
+	var imported int64
+	err = m.Transaction(func(tx *Model) error {
+		imported, err = tx.importRows(reader, s, columns, opts)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return imported, nil
+}
+
+// importColumns maps header of file to fields of model, returns headers without fields
+func importColumns(s *schema.Schema, header []string, mapping map[string]string) ([]importColumn, []string) {
+	var (
+		columns []importColumn
+		unknown []string
+	)
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if mapped, ok := mapping[name]; ok {
+			name = mapped
+		}
+		field := s.LookUpField(name)
+		if field == nil {
+			for _, f := range s.Fields {
+				if tag, _, _ := strings.Cut(f.StructField.Tag.Get(csvTag), ","); tag == name {
+					field = f
+					break
+				}
+			}
+		}
+		if field == nil || field.DBName == "" {
+			unknown = append(unknown, name)
+			continue
+		}
+		columns = append(columns, importColumn{index: i, field: field})
+	}
+	return columns, unknown
+}
+
+// importRows reads rows of reader and inserts them by batches, returns count of inserted rows
+func (m *Model) importRows(reader *csv.Reader, s *schema.Schema, columns []importColumn, opts ImportOptions) (int64, error) {
+	var imported int64
+	batch := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(s.ModelType)), 0, opts.BatchSize)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var (
+			line     int
+			parseErr *csv.ParseError
+		)
+		if errors.As(err, &parseErr) {
+			line = parseErr.StartLine
+		} else {
+			line, _ = reader.FieldPos(0)
+		}
+		var row reflect.Value
+		if err == nil {
+			row, err = parseImportRow(s, columns, record)
+		}
+		if err == nil && opts.Validate != nil {
+			err = opts.Validate(line, row.Interface())
+		}
+		if err != nil {
+			if opts.Report != nil {
+				opts.Report.Rejected = append(opts.Report.Rejected, RejectedRow{Line: line, Reason: err.Error()})
+			}
+			rawLine := strings.Join(record, string(reader.Comma))
+			if len(rawLine) > importLoggedLineLen {
+				rawLine = rawLine[:importLoggedLineLen] + "..."
+			}
+			if opts.SkipMalformed {
+				m.logDebug("malformed row of imported file is skipped", err, logrus.Fields{
+					"importLine":    line,
+					"importRawLine": rawLine,
+				})
+				continue
+			}
+			return imported, m.fail("importCSV", "can't import malformed row", err, logrus.Fields{
+				"importLine":    line,
+				"importRawLine": rawLine,
+				"trace":         m.frames(),
+			})
+		}
+
+		batch = reflect.Append(batch, row)
+		if batch.Len() == opts.BatchSize {
+			if err := m.importBatch(s, columns, batch); err != nil {
+				return imported, err
+			}
+			imported += int64(batch.Len())
+			batch = batch.Slice(0, 0)
+		}
+	}
+	if batch.Len() > 0 {
+		if err := m.importBatch(s, columns, batch); err != nil {
+			return imported, err
+		}
+		imported += int64(batch.Len())
+	}
+	return imported, nil
+}
+
+// parseImportRow converts record into pointer to new model, empty values are left zero
+func parseImportRow(s *schema.Schema, columns []importColumn, record []string) (reflect.Value, error) {
+	row := reflect.New(s.ModelType)
+	for _, column := range columns {
+		if column.index >= len(record) || record[column.index] == "" {
+			continue
+		}
+		value, err := parseImportValue(column.field.FieldType, record[column.index])
+		if err != nil {
+			return row, fmt.Errorf("invalid value of %s: %w", column.field.Name, err)
+		}
+		column.field.ReflectValueOf(context.Background(), row.Elem()).Set(value)
+	}
+	return row, nil
+}
+
+// importTimeLayouts are accepted layouts of time values of ImportCSV
+var importTimeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"}
+
+// parseImportValue converts text into value of type t, pointers are allocated
+func parseImportValue(t reflect.Type, text string) (reflect.Value, error) {
+	if t.Kind() == reflect.Ptr {
+		elem, err := parseImportValue(t.Elem(), text)
+		if err != nil {
+			return elem, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(elem)
+		return ptr, nil
+	}
+	v := reflect.New(t).Elem()
+	if t == reflect.TypeOf(time.Time{}) {
+		for _, layout := range importTimeLayouts {
+			if parsed, err := time.Parse(layout, text); err == nil {
+				v.Set(reflect.ValueOf(parsed))
+				return v, nil
+			}
+		}
+		return v, fmt.Errorf("%q is not a time", text)
+	}
+	if scanner, ok := v.Addr().Interface().(sql.Scanner); ok {
+		return v, scanner.Scan(text)
+	}
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(text, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetFloat(f)
+	default:
+		return v, fmt.Errorf("type %s isn't supported by import", t)
+	}
+	return v, nil
+}
+
+// importBatch inserts batch of rows, by COPY of imported columns on postgres and by batched insert otherwise
+func (m *Model) importBatch(s *schema.Schema, columns []importColumn, batch reflect.Value) error {
+	if m.dialect() != dialectPostgres {
+		return m.CreateInBatches(batch.Interface(), batch.Len())
+	}
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.field.DBName)
+	}
+	rows := make([][]interface{}, 0, batch.Len())
+	for i := 0; i < batch.Len(); i++ {
+		values := make([]interface{}, 0, len(columns))
+		for _, column := range columns {
+			value, _ := column.field.ValueOf(context.Background(), batch.Index(i).Elem())
+			values = append(values, value)
+		}
+		rows = append(rows, values)
+	}
+	_, err := m.CopyFrom(s.Table, names, rows)
+	return err
+}
@@ -0,0 +1,42 @@
+package builder
+
+import (
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+)
+
+// Unlimited makes Find, FindMaps and Scan of chain bypass WithDefaultLimit and Limit bypass WithMaxLimit,
+// as example for exports. Must be called before Limit
+func (m *Model) Unlimited() *Model {
+	trace := m.logTrace.with("unlimited", true)
+	c := m.chain(m.db, trace)
+	c.unlimited = true
+	return c
+}
+
+// clampLimit cuts limit to WithMaxLimit option, logs warning about cut limit.
+// Negative limit, which removes LIMIT in gorm, is clamped too, so only Unlimited bypasses maximum
+func (m *Model) clampLimit(limit int) int {
+	if m.unlimited || m.cfg.maxLimit <= 0 || limit >= 0 && limit <= m.cfg.maxLimit {
+		return limit
+	}
+	m.logWarn("limit exceeds maximum and is clamped", nil, logrus.Fields{
+		"requestedLimit": limit,
+		"maxLimit":       m.cfg.maxLimit,
+		"trace":          m.frames(),
+	})
+	return m.cfg.maxLimit
+}
+
+// defaultLimit applies WithDefaultLimit option to chain without Limit.
+// Chains with Offset only or negative Limit aren't limited, so they get default limit too
+func (m *Model) defaultLimit() *Model {
+	if m.unlimited || m.cfg.defaultLimit <= 0 {
+		return m
+	}
+	if limit, ok := m.db.Statement.Clauses["LIMIT"].Expression.(clause.Limit); ok && limit.Limit != nil && *limit.Limit >= 0 {
+		return m
+	}
+	trace := m.logTrace.with("limitDefaulted", m.cfg.defaultLimit)
+	return m.chain(m.db.Limit(m.cfg.defaultLimit), trace)
+}
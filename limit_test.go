@@ -0,0 +1,58 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+type limitNode struct {
+	ID int
+}
+
+// findSQL builds Find of chain by dry run model and returns its sql
+func findSQL(t *testing.T, c *Model) string {
+	t.Helper()
+	var nodes []limitNode
+	if err := c.Find(&nodes); err != nil {
+		t.Fatalf("can't build query: %v", err)
+	}
+	sql, _ := c.LastSQL()
+	return sql
+}
+
+func TestLimit(t *testing.T) {
+	m := NewDryRun(dialectPostgres, WithMaxLimit(100), WithDefaultLimit(10))
+	tests := []struct {
+		name  string
+		chain *Model
+		limit string
+	}{
+		{"default", &m, "LIMIT 10"},
+		{"below maximum", m.Limit(50), "LIMIT 50"},
+		{"above maximum", m.Limit(500), "LIMIT 100"},
+		{"negative", m.Limit(-1), "LIMIT 100"},
+		{"offset only", m.Offset(20), "LIMIT 10 OFFSET 20"},
+		{"unlimited", m.Unlimited().Limit(500), "LIMIT 500"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if sql := findSQL(t, test.chain); !strings.HasSuffix(sql, test.limit) {
+				t.Errorf("expected %s, got %s", test.limit, sql)
+			}
+		})
+	}
+}
+
+func TestNegativeLimitGetsDefaultLimit(t *testing.T) {
+	m := NewDryRun(dialectPostgres, WithDefaultLimit(10))
+	if sql := findSQL(t, m.Limit(-1)); !strings.HasSuffix(sql, "LIMIT 10") {
+		t.Errorf("negative limit bypasses default limit: %s", sql)
+	}
+}
+
+func TestUnlimitedRemovesLimit(t *testing.T) {
+	m := NewDryRun(dialectPostgres, WithMaxLimit(100), WithDefaultLimit(10))
+	if sql := findSQL(t, m.Unlimited().Limit(-1)); strings.Contains(sql, "LIMIT") {
+		t.Errorf("unlimited chain is limited: %s", sql)
+	}
+}
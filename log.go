@@ -0,0 +1,275 @@
+package builder
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Logger is backend of all logs of the package, can be plugged by WithCustomLogger.
+// Fields contain accumulated trace of chain and logged payloads as is, calling frames arrive
+// as common.LazyFrames under "trace" key, so backend decides how to render them, and resolves them
+// by Frames only if it writes the log.
+// Logger which returns from all methods without side effects silences the package completely,
+// own logger of gorm writes to WithLogWriter and is silenced by WithGormLogLevel(logger.Silent)
+type Logger interface {
+	Error(msg string, fields map[string]interface{})
+	Warn(msg string, fields map[string]interface{})
+	Debug(msg string, fields map[string]interface{})
+}
+
+// Silent skips failure logs of chain, including warnings of failures caused by data like duplicates,
+// finishers still return errors. Useful for queries which are expected to fail, like probing whether slug is taken
+func (m *Model) Silent() *Model {
+	c := m.chain(m.db, m.logTrace)
+	c.silent = true
+	return c
+}
+
+// LogLevel demotes error logs of chain to given level, levels above warning are logged as debug
+func (m *Model) LogLevel(level logrus.Level) *Model {
+	c := m.chain(m.db, m.logTrace)
+	c.errorLevel = &level
+	return c
+}
+
+// logError logs failure with accumulated trace of chain.
+// Repeated failures are sampled according to WithErrorLogSampling and WithErrorLogBurst options,
+// returns false if full log is suppressed by sampling or Silent
+func (m *Model) logError(msg string, err error, fields ...logrus.Fields) bool {
+	if m.silent {
+		return false
+	}
+	if m.errorLevel != nil && *m.errorLevel == logrus.WarnLevel {
+		m.logWarn(msg, err, fields...)
+		return true
+	}
+	if m.errorLevel != nil && *m.errorLevel > logrus.WarnLevel {
+		m.logDebug(msg, err, fields...)
+		return true
+	}
+	if m.cfg.sampler == nil || m.unsampled {
+		m.cfg.logger.Error(msg, m.logFields(err, fields))
+		return true
+	}
+
+	key := msg
+	if err != nil {
+		key += "\x00" + err.Error()
+	}
+	d := m.cfg.sampler.sample(key, time.Now())
+	switch {
+	case d.compact:
+		compact := map[string]interface{}{"suppressedCount": d.suppressed}
+		if err != nil {
+			compact[logrus.ErrorKey] = err
+		}
+		m.cfg.logger.Error(msg+" (repeated)", compact)
+	case d.full:
+		if d.suppressed > 0 {
+			fields = append(fields, logrus.Fields{"suppressedCount": d.suppressed})
+		}
+		m.cfg.logger.Error(msg, m.logFields(err, fields))
+	}
+	return d.full
+}
+
+// logWarn logs expected failure with accumulated trace of chain
+func (m *Model) logWarn(msg string, err error, fields ...logrus.Fields) {
+	m.cfg.logger.Warn(msg, m.logFields(err, fields))
+}
+
+// logDebug logs details with accumulated trace of chain
+func (m *Model) logDebug(msg string, err error, fields ...logrus.Fields) {
+	m.cfg.logger.Debug(msg, m.logFields(err, fields))
+}
+
+// sqlFields returns sql generated by gorm for failed query, its vars with redacted sensitive values, table and duration.
+// Returns no fields if sql wasn't generated, so original error is logged anyway
+func (m *Model) sqlFields(db *gorm.DB) (fields logrus.Fields) {
+	defer func() {
+		if r := recover(); r != nil {
+			fields = nil
+		}
+	}()
+	if db == nil || db.Statement == nil || db.Statement.Context == nil {
+		return nil
+	}
+	q, ok := db.Statement.Context.Value(queryKey{}).(*tracedQuery)
+	if !ok || q.sql == "" {
+		return nil
+	}
+	fields = logrus.Fields{"sql": cutSQL(q.sql)}
+	if q.table != "" {
+		fields["sqlTable"] = q.table
+	}
+	if q.elapsed > 0 {
+		fields["elapsed"] = q.elapsed.String()
+	}
+	if len(q.vars) > 0 {
+		fields["sqlVars"] = m.printCapped(q.vars, maxLoggedSQLLen)
+	}
+	return fields
+}
+
+// cutSQL cuts sql to maxLoggedSQLLen for logs
+func cutSQL(sql string) string {
+	if len(sql) > maxLoggedSQLLen {
+		return sql[:maxLoggedSQLLen] + "... (" + strconv.Itoa(len(sql)) + " bytes total)"
+	}
+	return sql
+}
+
+// logFields merges trace of chain, given fields and error into single set of fields
+func (m *Model) logFields(err error, fields []logrus.Fields) map[string]interface{} {
+	res := make(map[string]interface{}, len(m.logTrace)+1)
+	if ctx := m.db.Statement.Context; ctx != nil {
+		for _, key := range m.cfg.contextKeys {
+			if value := ctx.Value(key); value != nil {
+				res[key] = value
+			}
+		}
+		for _, extract := range m.cfg.contextExtractors {
+			for key, value := range extract(ctx) {
+				res[key] = value
+			}
+		}
+	}
+	if m.cfg.orderedTrace {
+		if len(m.logTrace) > 0 {
+			entries := make([]TraceEntry, 0, len(m.logTrace))
+			for _, e := range m.logTrace {
+				e.Value = m.traceValue(e.Value)
+				entries = append(entries, e)
+			}
+			res["queryTrace"] = entries
+		}
+	} else {
+		// later entries overwrite earlier ones with the same key
+		for _, e := range m.logTrace {
+			res[e.Key] = m.traceValue(e.Value)
+		}
+	}
+	if settings := m.tx.activeSettings(); settings != nil {
+		res["txSettings"] = settings
+	}
+	for _, f := range fields {
+		for key, value := range f {
+			res[key] = value
+		}
+	}
+	if exec, ok := res["trace"].(common.LazyFrames); ok && m.buildTrace != nil && !sameFrames(*m.buildTrace, exec) {
+		delete(res, "trace")
+		res["buildTrace"] = *m.buildTrace
+		res["execTrace"] = exec
+	}
+	if err != nil {
+		res[logrus.ErrorKey] = err
+	}
+	return res
+}
+
+// sameFrames reports whether traces have the same frames
+func sameFrames(a, b common.LazyFrames) bool {
+	return slices.Equal(a.Frames(), b.Frames())
+}
+
+// logrusLogger is default backend which logs by logrus
+type logrusLogger struct {
+	l logrus.FieldLogger
+}
+
+func (l logrusLogger) Error(msg string, fields map[string]interface{}) {
+	l.l.WithFields(fields).Error(msg)
+}
+
+func (l logrusLogger) Warn(msg string, fields map[string]interface{}) {
+	l.l.WithFields(fields).Warn(msg)
+}
+
+func (l logrusLogger) Debug(msg string, fields map[string]interface{}) {
+	l.l.WithFields(fields).Debug(msg)
+}
+
+// slogLogger logs by slog, fields are passed as structured attributes
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (l slogLogger) Error(msg string, fields map[string]interface{}) {
+	l.l.LogAttrs(context.Background(), slog.LevelError, msg, slogAttrs(fields)...)
+}
+
+func (l slogLogger) Warn(msg string, fields map[string]interface{}) {
+	l.l.LogAttrs(context.Background(), slog.LevelWarn, msg, slogAttrs(fields)...)
+}
+
+func (l slogLogger) Debug(msg string, fields map[string]interface{}) {
+	l.l.LogAttrs(context.Background(), slog.LevelDebug, msg, slogAttrs(fields)...)
+}
+
+// slogAttrs converts fields to attributes sorted by key, calling frames are rendered as group
+func slogAttrs(fields map[string]interface{}) []slog.Attr {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, key := range keys {
+		lazy, ok := fields[key].(common.LazyFrames)
+		if !ok {
+			attrs = append(attrs, slog.Any(key, fields[key]))
+			continue
+		}
+		frames := lazy.Frames()
+		group := make([]interface{}, 0, len(frames))
+		for i, frame := range frames {
+			group = append(group, slog.Group(strconv.Itoa(i),
+				slog.String("function", frame.Function),
+				slog.String("file", frame.File),
+				slog.Int("line", frame.Line),
+			))
+		}
+		attrs = append(attrs, slog.Group(key, group...))
+	}
+	return attrs
+}
+
+// traceValue prints value deferred by chainer
+func (m *Model) traceValue(value interface{}) interface{} {
+	if d, ok := value.(deferredPrint); ok {
+		return m.summarize(d.value)
+	}
+	return value
+}
+
+// frames captures calling frames for logs, starting from the caller of finisher, so frames of the package
+// aren't logged. Up to WithTraceDepth frames are captured, they are resolved only if log is written
+func (m *Model) frames() common.LazyFrames {
+	return m.cfg.captureFrames(1).SkipLeading(isPackageFunction)
+}
+
+// captureFrames captures calling frames for logs skipping first skip frames, where 0 is the caller of captureFrames
+func (cfg *config) captureFrames(skip int) common.LazyFrames {
+	frames := common.CaptureFrames(skip+1, cfg.traceDepth)
+	if cfg.verboseFrames {
+		return frames.Verbose()
+	}
+	return frames
+}
+
+// isPackageFunction reports whether function is declared in the package
+func isPackageFunction(function string) bool {
+	return strings.HasPrefix(function, builderPackage+".")
+}
@@ -0,0 +1,219 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/gorm/logger"
+)
+
+type silentNode struct {
+	ID   int
+	Name string `gorm:"unique"`
+}
+
+func TestSilentSkipsDuplicateWarning(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &silentNode{})
+	if err := m.Create(&silentNode{Name: "taken"}); err != nil {
+		t.Fatalf("can't create node: %v", err)
+	}
+	hook.Reset()
+
+	err := m.Silent().Create(&silentNode{Name: "taken"})
+	if !errors.Is(err, common.ErrDuplicate) {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+	if entries := hook.AllEntries(); len(entries) != 0 {
+		t.Fatalf("expected no logs of silent chain, got %d, the first is %q", len(entries), entries[0].Message)
+	}
+
+	// the same failure is logged without Silent
+	if err := m.Create(&silentNode{Name: "taken"}); !errors.Is(err, common.ErrDuplicate) {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+	if entries := entriesAt(hook, logrus.WarnLevel); len(entries) != 1 {
+		t.Fatalf("expected single warning, got %d", len(entries))
+	}
+}
+
+func TestSilentSkipsErrorLog(t *testing.T) {
+	m, hook := newLoggedModel(t, nil)
+	var dest []silentNode
+	err := m.Silent().Table("missing_table").Where("name = ?", "a").Find(&dest)
+	if !errors.Is(err, common.ErrInternal) {
+		t.Fatalf("expected internal error, got %v", err)
+	}
+	if entries := hook.AllEntries(); len(entries) != 0 {
+		t.Fatalf("expected no logs of silent chain, got %d, the first is %q", len(entries), entries[0].Message)
+	}
+}
+
+func TestSilentIsNotTraced(t *testing.T) {
+	m, _ := newLoggedModel(t, nil)
+	c := m.Where("name = ?", "a").Silent().Where("id = ?", 1)
+	if !c.silent {
+		t.Fatal("silent flag is lost by chainer")
+	}
+	for _, e := range c.logTrace {
+		if e.Key == "silent" {
+			t.Fatal("silent flag is recorded in trace")
+		}
+	}
+}
+
+func TestLogLevelDemotesErrorLog(t *testing.T) {
+	m, hook := newLoggedModel(t, nil)
+	var dest []silentNode
+	if err := m.LogLevel(logrus.WarnLevel).Table("missing_table").Find(&dest); err == nil {
+		t.Fatal("expected error of missing table")
+	}
+	if len(entriesAt(hook, logrus.ErrorLevel)) != 0 || len(entriesAt(hook, logrus.WarnLevel)) != 1 {
+		t.Fatalf("expected failure logged as single warning, got %d entries", len(hook.AllEntries()))
+	}
+
+	hook.Reset()
+	if err := m.LogLevel(logrus.DebugLevel).Table("missing_table").Find(&dest); err == nil {
+		t.Fatal("expected error of missing table")
+	}
+	if len(entriesAt(hook, logrus.ErrorLevel)) != 0 || len(entriesAt(hook, logrus.DebugLevel)) != 1 {
+		t.Fatalf("expected failure logged as single debug entry, got %d entries", len(hook.AllEntries()))
+	}
+}
+
+func TestWithLoggerDoesNotLeakToGlobal(t *testing.T) {
+	global := test.NewLocal(logrus.StandardLogger())
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	m, hook := newLoggedModel(t, nil)
+	var dest []silentNode
+	if err := m.Table("missing_table").Find(&dest); err == nil {
+		t.Fatal("expected error of missing table")
+	}
+	tx := m.Begin()
+	tx.RollBack()
+	if err := tx.Commit(); err == nil {
+		t.Fatal("expected error of finished transaction")
+	}
+	if len(entriesAt(hook, logrus.ErrorLevel)) < 2 {
+		t.Errorf("errors aren't logged by injected logger, got %d entries", len(hook.AllEntries()))
+	}
+	if entries := global.AllEntries(); len(entries) != 0 {
+		t.Errorf("%d entries leak to global logger, the first is %q", len(entries), entries[0].Message)
+	}
+}
+
+func TestStandardLoggerByDefault(t *testing.T) {
+	global := test.NewLocal(logrus.StandardLogger())
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+	logrus.SetOutput(io.Discard)
+	defer logrus.SetOutput(os.Stderr)
+
+	m := newTestModel(t, []Option{WithGormLogLevel(logger.Silent)})
+	var dest []silentNode
+	if err := m.Table("missing_table").Find(&dest); err == nil {
+		t.Fatal("expected error of missing table")
+	}
+	if entries := entriesAt(global, logrus.ErrorLevel); len(entries) != 1 {
+		t.Errorf("expected error logged by global logger, got %d", len(entries))
+	}
+}
+
+// recordingLogger stores fields of error logs
+type recordingLogger struct {
+	errors []map[string]interface{}
+}
+
+func (l *recordingLogger) Error(_ string, fields map[string]interface{}) {
+	l.errors = append(l.errors, fields)
+}
+func (l *recordingLogger) Warn(string, map[string]interface{})  {}
+func (l *recordingLogger) Debug(string, map[string]interface{}) {}
+
+// noopLogger silences the package
+type noopLogger struct{}
+
+func (noopLogger) Error(string, map[string]interface{}) {}
+func (noopLogger) Warn(string, map[string]interface{})  {}
+func (noopLogger) Debug(string, map[string]interface{}) {}
+
+func TestCustomLoggerGetsTypedFrames(t *testing.T) {
+	l := &recordingLogger{}
+	m := newTestModel(t, []Option{WithCustomLogger(l), WithGormLogLevel(logger.Silent)})
+	var dest []silentNode
+	if err := m.Table("missing_table").Find(&dest); err == nil {
+		t.Fatal("expected error of missing table")
+	}
+	if len(l.errors) != 1 {
+		t.Fatalf("expected single error log, got %d", len(l.errors))
+	}
+	if _, ok := l.errors[0]["trace"].(common.LazyFrames); !ok {
+		t.Errorf("frames arrive as %T", l.errors[0]["trace"])
+	}
+}
+
+func TestNoopLoggerSilencesPackage(t *testing.T) {
+	global := test.NewLocal(logrus.StandardLogger())
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+	var gormOut bytes.Buffer
+
+	m := newTestModel(t, []Option{WithCustomLogger(noopLogger{}), WithLogWriter(&gormOut), WithGormLogLevel(logger.Silent)}, &silentNode{})
+	if err := m.Create(&silentNode{Name: "taken"}); err != nil {
+		t.Fatalf("can't create node: %v", err)
+	}
+	if err := m.Create(&silentNode{Name: "taken"}); !errors.Is(err, common.ErrDuplicate) {
+		t.Fatalf("expected duplicate error, got %v", err)
+	}
+	var dest []silentNode
+	if err := m.Table("missing_table").Find(&dest); err == nil {
+		t.Fatal("expected error of missing table")
+	}
+	if entries := global.AllEntries(); len(entries) != 0 {
+		t.Errorf("%d entries are logged by global logger", len(entries))
+	}
+	if gormOut.Len() != 0 {
+		t.Errorf("gorm logger isn't silenced: %q", gormOut.String())
+	}
+}
+
+type userIDKey struct{}
+
+func TestContextFieldsAreLogged(t *testing.T) {
+	m, hook := newLoggedModel(t, []Option{
+		WithTraceContextKeys("request_id"),
+		WithContextFieldExtractor(func(ctx context.Context) logrus.Fields {
+			if id, ok := ctx.Value(userIDKey{}).(int); ok {
+				return logrus.Fields{"user_id": id}
+			}
+			return nil
+		}),
+	})
+	// middlewares often store request id by plain string key, which WithTraceContextKeys looks up
+	ctx := context.WithValue(context.Background(), "request_id", "req-1")
+	ctx = context.WithValue(ctx, userIDKey{}, 7)
+
+	var dest []silentNode
+	if err := m.WithContext(ctx).Table("missing_table").Find(&dest); err == nil {
+		t.Fatal("expected error of missing table")
+	}
+	if err := m.Table("missing_table").Find(&dest); err == nil {
+		t.Fatal("expected error of missing table")
+	}
+	entries := entriesAt(hook, logrus.ErrorLevel)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 error logs, got %d", len(entries))
+	}
+	if entries[0].Data["request_id"] != "req-1" || entries[0].Data["user_id"] != 7 {
+		t.Errorf("context fields aren't logged: %v", entries[0].Data)
+	}
+	if _, ok := entries[1].Data["request_id"]; ok {
+		t.Errorf("chain without context has request id: %v", entries[1].Data)
+	}
+}
@@ -0,0 +1,30 @@
+package builder
+
+import (
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// logFieldPrefix prefixes keys of fields set by WithLogFields in trace, so they never collide with keys of chainers
+const logFieldPrefix = "field-"
+
+// WithLogFields adds domain fields like tenant id to error logs of chain, chains and transactions derived
+// from it log them too. Keys are prefixed by "field-" in logs
+func (m *Model) WithLogFields(fields logrus.Fields) *Model {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	trace := m.logTrace
+	for _, key := range keys {
+		trace = trace.with(logFieldPrefix+key, fields[key])
+	}
+	return m.chain(m.db, trace)
+}
+
+// WithLogField adds single domain field to error logs of chain, see WithLogFields
+func (m *Model) WithLogField(key string, value interface{}) *Model {
+	return m.chain(m.db, m.logTrace.with(logFieldPrefix+key, value))
+}
@@ -0,0 +1,88 @@
+package builder
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+type fieldNode struct {
+	ID   int
+	Name string
+}
+
+// requireLogged fails test unless every entry contains given fields
+func requireLogged(t *testing.T, entries []logrus.Entry, fields logrus.Fields) {
+	t.Helper()
+	if len(entries) == 0 {
+		t.Fatal("failure isn't logged")
+	}
+	for _, entry := range entries {
+		for key, value := range fields {
+			if entry.Data[key] != value {
+				t.Errorf("%q logs %s=%v instead of %v", entry.Message, key, entry.Data[key], value)
+			}
+		}
+	}
+}
+
+func TestLogFieldsInTransaction(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &fieldNode{})
+	tx := m.WithLogFields(logrus.Fields{"tenantID": 7, "entity": "invoice"}).Begin()
+	defer tx.EnsureRollback()
+
+	var nodes []fieldNode
+	if err := tx.Where("no_such_column = ?", 1).Find(&nodes); err == nil {
+		t.Fatal("expected error of unknown column")
+	}
+	requireLogged(t, entriesAt(hook, logrus.ErrorLevel), logrus.Fields{"field-tenantID": 7, "field-entity": "invoice"})
+}
+
+func TestLogFieldsInTransactionFunc(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &fieldNode{})
+	_ = m.WithLogField("tenantID", 7).Transaction(func(tx *Model) error {
+		var nodes []fieldNode
+		return tx.Where("no_such_column = ?", 1).Find(&nodes)
+	})
+	requireLogged(t, entriesAt(hook, logrus.ErrorLevel), logrus.Fields{"field-tenantID": 7})
+}
+
+func TestLogFieldsSurviveChainers(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &fieldNode{})
+	var nodes []fieldNode
+	err := m.WithLogField("tenantID", 7).Where("name = ?", "a").Preload("NoSuchAssociation").Order("id").Find(&nodes)
+	if err == nil {
+		t.Fatal("expected error of unknown association")
+	}
+	requireLogged(t, entriesAt(hook, logrus.ErrorLevel), logrus.Fields{"field-tenantID": 7})
+	if _, ok := entriesAt(hook, logrus.ErrorLevel)[0].Data["whereQuery0"]; !ok {
+		t.Error("trace of chainers is lost")
+	}
+}
+
+func TestLogFieldsDontCollideWithChainers(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &fieldNode{})
+	var nodes []fieldNode
+	err := m.WithLogField("whereQuery0", "domain").Where("no_such_column = ?", 1).Find(&nodes)
+	if err == nil {
+		t.Fatal("expected error of unknown column")
+	}
+	requireLogged(t, entriesAt(hook, logrus.ErrorLevel), logrus.Fields{"field-whereQuery0": "domain"})
+	if _, ok := entriesAt(hook, logrus.ErrorLevel)[0].Data["whereQuery0"]; !ok {
+		t.Error("trace of chainer is overwritten by field")
+	}
+}
+
+func TestLogFieldsDontLeakToParent(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &fieldNode{})
+	_ = m.WithLogField("tenantID", 7)
+	var nodes []fieldNode
+	if err := m.Where("no_such_column = ?", 1).Find(&nodes); err == nil {
+		t.Fatal("expected error of unknown column")
+	}
+	for _, entry := range entriesAt(hook, logrus.ErrorLevel) {
+		if _, ok := entry.Data["field-tenantID"]; ok {
+			t.Errorf("field of derived chain is logged by parent: %v", entry.Data)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package builder
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xolodniy/pretty"
+)
+
+// LogSummarizer is implemented by types which are too large or too noisy to be pretty printed in logs,
+// as example structs with decoded images. LogSummary is logged instead of value, nested fields included.
+// Struct fields tagged `log:"summary"` are logged as type and length only
+type LogSummarizer interface {
+	LogSummary() string
+}
+
+var logSummarizerType = reflect.TypeOf((*LogSummarizer)(nil)).Elem()
+
+// summarizedTypes caches whether types have summarized values, see hasSummaries
+var summarizedTypes sync.Map
+
+// isSummarizer reports whether values of type implement LogSummarizer
+func isSummarizer(t reflect.Type) bool {
+	return t.Implements(logSummarizerType)
+}
+
+// isSummaryField reports whether struct field is tagged `log:"summary"`
+func isSummaryField(field reflect.StructField) bool {
+	return field.Tag.Get("log") == "summary"
+}
+
+// hasSummaries reports whether values of type are or contain LogSummarizer or fields tagged `log:"summary"`.
+// Values stored in interfaces are checked by their static type, so they are never summarized
+func hasSummaries(t reflect.Type) bool {
+	if res, ok := summarizedTypes.Load(t); ok {
+		return res.(bool)
+	}
+	res := findSummaries(t, map[reflect.Type]bool{})
+	summarizedTypes.Store(t, res)
+	return res
+}
+
+func findSummaries(t reflect.Type, visited map[reflect.Type]bool) bool {
+	if isSummarizer(t) {
+		return true
+	}
+	// recursive types are checked once
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return findSummaries(t.Elem(), visited)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if isSummaryField(field) || findSummaries(field.Type, visited) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// printSummarized prints value like pretty does, but LogSummarizer values are printed by their LogSummary
+// and fields tagged `log:"summary"` as type and length. Summarized fields are printed after the other fields
+func (m *Model) printSummarized(v reflect.Value) string {
+	if !v.IsValid() {
+		return "nil"
+	}
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return v.Type().String() + "{nil}"
+	}
+	if v.CanInterface() && isSummarizer(v.Type()) {
+		return v.Interface().(LogSummarizer).LogSummary()
+	}
+	if !hasSummaries(v.Type()) {
+		if !v.CanInterface() {
+			return v.Type().String()
+		}
+		return pretty.Print(redact(v.Interface(), m.cfg.redactedFields))
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		return "*" + m.printSummarized(v.Elem())
+	case reflect.Slice, reflect.Array:
+		elems := make([]string, v.Len())
+		for i := range elems {
+			elems[i] = m.printSummarized(v.Index(i))
+		}
+		return fmt.Sprintf("%s: [%s]", v.Type(), strings.Join(elems, ", "))
+	case reflect.Map:
+		elems := make([]string, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			elems = append(elems, fmt.Sprintf("%v: %s", iter.Key(), m.printSummarized(iter.Value())))
+		}
+		sort.Strings(elems)
+		return fmt.Sprintf("%s{%s}", v.Type(), strings.Join(elems, ", "))
+	case reflect.Struct:
+		return m.printSummarizedStruct(v)
+	default:
+		return v.Type().String()
+	}
+}
+
+// printSummarizedStruct pretty prints struct with summarized fields zeroed, then appends summaries of these fields
+func (m *Model) printSummarizedStruct(v reflect.Value) string {
+	// shallow copy, large summarized fields are never copied
+	cp := reflect.New(v.Type()).Elem()
+	cp.Set(v)
+	var summaries []string
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() || isRedacted(field, m.cfg.redactedFields) {
+			continue
+		}
+		switch {
+		case isSummaryField(field):
+			summaries = append(summaries, field.Name+": "+typeAndLen(v.Field(i)))
+		case hasSummaries(field.Type):
+			if !v.Field(i).IsZero() {
+				summaries = append(summaries, field.Name+": "+m.printSummarized(v.Field(i)))
+			}
+		default:
+			continue
+		}
+		cp.Field(i).Set(reflect.Zero(field.Type))
+	}
+
+	res := pretty.Print(redact(cp.Interface(), m.cfg.redactedFields))
+	if len(summaries) == 0 || !strings.HasSuffix(res, "}") {
+		return res
+	}
+	sep := ", "
+	if strings.HasSuffix(res, "{}") {
+		sep = ""
+	}
+	return res[:len(res)-1] + sep + strings.Join(summaries, ", ") + "}"
+}
+
+// typeAndLen prints type of value and length of strings and collections
+func typeAndLen(v reflect.Value) string {
+	t := v.Type()
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return t.String() + "{nil}"
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map, reflect.Chan:
+		return fmt.Sprintf("%s(len %d)", t, v.Len())
+	default:
+		return t.String()
+	}
+}
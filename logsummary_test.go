@@ -0,0 +1,92 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+type image struct {
+	Pixels []byte
+}
+
+func (i image) LogSummary() string {
+	return "image of " + string(rune('0'+len(i.Pixels)%10)) + " pixels"
+}
+
+type upload struct {
+	Name    string
+	Blob    []byte `log:"summary"`
+	Preview image
+	Pages   []image
+}
+
+type attachment struct {
+	ID   int
+	Name string
+	Blob []byte `log:"summary"`
+}
+
+// plainUpload has the same blob as upload, but it's printed by pretty
+type plainUpload struct {
+	Name string
+	Blob []byte
+}
+
+func TestPrintSummarized(t *testing.T) {
+	m, _ := newLoggedModel(t, []Option{WithRedactedFields("name")})
+	u := &upload{
+		Name:    "secret",
+		Blob:    []byte("raw bytes"),
+		Preview: image{Pixels: []byte{1, 2, 3}},
+		Pages:   []image{{Pixels: []byte{1}}},
+	}
+	printed := m.print(u)
+	for _, want := range []string{"Blob: []uint8(len 9)", "Preview: image of 3 pixels", "Pages: []builder.image: [image of 1 pixels]", "[REDACTED]"} {
+		if !strings.Contains(printed, want) {
+			t.Errorf("%q is not printed in %s", want, printed)
+		}
+	}
+	for _, unwanted := range []string{"secret", "uint8{1}", "raw bytes"} {
+		if strings.Contains(printed, unwanted) {
+			t.Errorf("%q is printed in %s", unwanted, printed)
+		}
+	}
+}
+
+func TestFinisherLogsSummary(t *testing.T) {
+	m, hook := newLoggedModel(t, nil)
+	a := &attachment{Name: "a", Blob: make([]byte, 1<<20)}
+	if err := m.Table("missing_table").Create(a); err == nil {
+		t.Fatal("expected error of missing table")
+	}
+	entries := hook.AllEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected single log, got %d", len(entries))
+	}
+	if printed, _ := entries[0].Data["createValue"].(string); !strings.Contains(printed, "Blob: []uint8(len 1048576)") {
+		t.Errorf("blob isn't summarized: %.200s", printed)
+	}
+}
+
+// BenchmarkPrintSummarized compares printing of struct with 5MB blob summarized by tag and printed by pretty
+func BenchmarkPrintSummarized(b *testing.B) {
+	m, _ := newLoggedModel(b, nil)
+	blob := make([]byte, 5<<20)
+	for i := range blob {
+		blob[i] = byte(i)
+	}
+	for _, bench := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"summarized", &upload{Name: "a", Blob: blob}},
+		{"pretty", &plainUpload{Name: "a", Blob: blob}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m.print(bench.value)
+			}
+		})
+	}
+}
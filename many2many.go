@@ -0,0 +1,151 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// AllowClear allows SyncMany2Many of chain to remove all related records, when related slice is empty
+func (m *Model) AllowClear() *Model {
+	trace := m.logTrace.with("allowClear", true)
+	c := m.chain(m.db, trace)
+	c.allowClear = true
+	return c
+}
+
+// AddToMany2Many is gorm extension. Links related records to model by join table of many to many association,
+// related records are created when they don't exist
+func (m *Model) AddToMany2Many(model interface{}, association string, related ...interface{}) error {
+	logFields := logrus.Fields{"many2manyAssociation": association, "many2manyAdded": len(related)}
+	assoc, err := m.many2many(m.traced(), model, association)
+	if err != nil {
+		return m.fail("addToMany2Many", "can't get many to many association", err, logFields,
+			logrus.Fields{"trace": m.frames()})
+	}
+	q := m.startQuery("addToMany2Many")
+	err = assoc.Append(related...)
+	q.done(assoc.DB)
+	if err != nil {
+		m.tx.remember(err)
+		return m.fail("addToMany2Many", "can't add records to many to many association", err, m.sqlFields(assoc.DB),
+			logFields, logrus.Fields{"trace": m.frames()})
+	}
+	m.logDebug("records are added to many to many association", nil, logFields)
+	return nil
+}
+
+// RemoveFromMany2Many is gorm extension. Unlinks related records from model by deleting rows of join table,
+// related records themselves are kept
+func (m *Model) RemoveFromMany2Many(model interface{}, association string, related ...interface{}) error {
+	logFields := logrus.Fields{"many2manyAssociation": association, "many2manyRemoved": len(related)}
+	assoc, err := m.many2many(m.traced(), model, association)
+	if err != nil {
+		return m.fail("removeFromMany2Many", "can't get many to many association", err, logFields,
+			logrus.Fields{"trace": m.frames()})
+	}
+	q := m.startQuery("removeFromMany2Many")
+	err = assoc.Delete(related...)
+	q.done(assoc.DB)
+	if err != nil {
+		m.tx.remember(err)
+		return m.fail("removeFromMany2Many", "can't remove records from many to many association", err,
+			m.sqlFields(assoc.DB), logFields, logrus.Fields{"trace": m.frames()})
+	}
+	m.logDebug("records are removed from many to many association", nil, logFields)
+	return nil
+}
+
+// SyncMany2Many is gorm extension. Makes related the only records linked to model by many to many association:
+// missing ones are added and others are removed in one transaction. Records are matched by primary key.
+// Empty related removes all links, so it requires AllowClear
+func (m *Model) SyncMany2Many(model interface{}, association string, related []interface{}) error {
+	logFields := logrus.Fields{"many2manyAssociation": association, "many2manyRelated": len(related)}
+	if len(related) == 0 && !m.allowClear {
+		m.logError("queryBuilder.SyncMany2Many called with empty related records without AllowClear", nil, logFields,
+			logrus.Fields{"trace": m.frames()})
+		return common.ErrInternal
+	}
+	return m.Transaction(func(tx *Model) error {
+		assoc, err := tx.many2many(tx.traced(), model, association)
+		if err != nil {
+			return tx.fail("syncMany2Many", "can't get many to many association", err, logFields,
+				logrus.Fields{"trace": m.frames()})
+		}
+		rel := assoc.Relationship
+		current := reflect.New(reflect.SliceOf(reflect.PtrTo(rel.FieldSchema.ModelType)))
+		if err := assoc.Find(current.Interface()); err != nil {
+			tx.tx.remember(err)
+			return tx.fail("syncMany2Many", "can't find records of many to many association", err,
+				tx.sqlFields(assoc.DB), logFields, logrus.Fields{"trace": m.frames()})
+		}
+
+		linked := make(map[string]interface{}, current.Elem().Len())
+		for i := 0; i < current.Elem().Len(); i++ {
+			record := current.Elem().Index(i)
+			linked[relatedKey(rel.FieldSchema, record)] = record.Interface()
+		}
+		var added, removed []interface{}
+		wanted := make(map[string]bool, len(related))
+		for _, record := range related {
+			key := relatedKey(rel.FieldSchema, reflect.ValueOf(record))
+			if key != "" {
+				wanted[key] = true
+			}
+			if _, ok := linked[key]; !ok || key == "" {
+				added = append(added, record)
+			}
+		}
+		for key, record := range linked {
+			if !wanted[key] {
+				removed = append(removed, record)
+			}
+		}
+		logFields["many2manyAdded"] = len(added)
+		logFields["many2manyRemoved"] = len(removed)
+
+		if len(removed) > 0 {
+			if err := tx.RemoveFromMany2Many(model, association, removed...); err != nil {
+				return err
+			}
+		}
+		if len(added) > 0 {
+			if err := tx.AddToMany2Many(model, association, added...); err != nil {
+				return err
+			}
+		}
+		tx.logDebug("many to many association is synced", nil, logFields)
+		return nil
+	})
+}
+
+// many2many returns gorm association of model, which must be many to many
+func (m *Model) many2many(db *gorm.DB, model interface{}, association string) (*gorm.Association, error) {
+	assoc := db.Model(model).Association(association)
+	if assoc.Error != nil {
+		return nil, assoc.Error
+	}
+	if assoc.Relationship.Type != schema.Many2Many {
+		return nil, fmt.Errorf("%s is %s association, not many to many", association, assoc.Relationship.Type)
+	}
+	return assoc, nil
+}
+
+// relatedKey returns primary key of record as string, empty for records without primary key
+func relatedKey(s *schema.Schema, record reflect.Value) string {
+	record = reflect.Indirect(record)
+	if s.PrioritizedPrimaryField == nil || record.Kind() != reflect.Struct {
+		return ""
+	}
+	key, zero := s.PrioritizedPrimaryField.ValueOf(context.Background(), record)
+	if zero {
+		return ""
+	}
+	return fmt.Sprint(key)
+}
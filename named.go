@@ -0,0 +1,52 @@
+package builder
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+)
+
+// namedParam matches named parameter of sql like "@from", email like "a@b.c" and "@@" operators are skipped
+var namedParam = regexp.MustCompile(`(?:^|[^\w@])@(\w+)`)
+
+// namedArgs returns named arguments passed as single map or as sql.NamedArg values, false for positional arguments
+func namedArgs(args []interface{}) (map[string]interface{}, bool) {
+	if len(args) == 0 {
+		return nil, false
+	}
+	if len(args) == 1 {
+		switch named := args[0].(type) {
+		case map[string]interface{}:
+			return named, true
+		case sql.NamedArg:
+			return map[string]interface{}{named.Name: named.Value}, true
+		}
+	}
+	named := make(map[string]interface{}, len(args))
+	for _, arg := range args {
+		namedArg, ok := arg.(sql.NamedArg)
+		if !ok {
+			return nil, false
+		}
+		named[namedArg.Name] = namedArg.Value
+	}
+	return named, true
+}
+
+// checkNamedArgs reports named parameters of query which are missing in named arguments,
+// so caller gets clear error instead of syntax error of database
+func checkNamedArgs(query string, named map[string]interface{}) error {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, match := range namedParam.FindAllStringSubmatch(query, -1) {
+		name := match[1]
+		if _, ok := named[name]; !ok && !seen[name] {
+			missing = append(missing, "@"+name)
+		}
+		seen[name] = true
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("named parameters %v are missing in arguments of query %q", missing, query)
+}
@@ -0,0 +1,97 @@
+package builder
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+type namedNode struct {
+	ID        int
+	CreatedAt time.Time
+}
+
+func TestWhereNamedArgs(t *testing.T) {
+	m := newTestModel(t, nil, &namedNode{})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		if err := m.Create(&namedNode{CreatedAt: start.AddDate(0, 0, i)}); err != nil {
+			t.Fatalf("can't create node: %v", err)
+		}
+	}
+	from, to := start, start.AddDate(0, 0, 3)
+
+	tests := []struct {
+		name string
+		args []interface{}
+	}{
+		{"map", []interface{}{map[string]interface{}{"from": from, "to": to}}},
+		{"sql.Named", []interface{}{sql.Named("from", from), sql.Named("to", to)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var nodes []namedNode
+			if err := m.Where("created_at > @from AND created_at < @to", test.args...).Find(&nodes); err != nil {
+				t.Fatalf("can't find nodes: %v", err)
+			}
+			if len(nodes) != 2 {
+				t.Errorf("expected 2 nodes between bounds, got %d", len(nodes))
+			}
+		})
+	}
+}
+
+func TestNamedArgsAreTracedAsMap(t *testing.T) {
+	m, _ := newLoggedModel(t, nil)
+	c := m.Where("id = @id", map[string]interface{}{"id": 1})
+	if !c.logTrace.has("whereNamedArgs0") || c.logTrace.has("whereArgs0") {
+		t.Errorf("named arguments aren't traced as map: %v", c.logTrace)
+	}
+}
+
+func TestMissingNamedArgs(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &namedNode{})
+	var nodes []namedNode
+	err := m.Where("created_at > @from AND created_at < @to", map[string]interface{}{"from": time.Now()}).Find(&nodes)
+	if err == nil {
+		t.Fatal("expected error of missing named parameter")
+	}
+	entries := hook.AllEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected single log, got %d", len(entries))
+	}
+	if logged, _ := entries[0].Data["error"].(error); logged == nil || !strings.Contains(logged.Error(), "[@to]") {
+		t.Errorf("missing parameter isn't named in error: %v", entries[0].Data["error"])
+	}
+	if _, ok := entries[0].Data["sql"]; ok {
+		t.Error("query with missing parameter reaches database")
+	}
+
+	if err := m.raw("SELECT * FROM named_nodes WHERE id = @id", sql.Named("other", 1)).Find(&nodes); err == nil {
+		t.Error("expected error of raw sql with missing named parameter")
+	}
+	if err := m.exec("DELETE FROM named_nodes WHERE id = @id", map[string]interface{}{}); err == nil {
+		t.Error("expected error of exec with missing named parameter")
+	}
+}
+
+func TestCheckNamedArgs(t *testing.T) {
+	tests := []struct {
+		query   string
+		missing string
+	}{
+		{"email = 'a@b.c' AND id = @id", ""},
+		{"tags @@ to_tsquery(@query)", "[@query]"},
+		{"@id = 1 OR parent_id = @id OR owner_id = @owner", "[@owner]"},
+	}
+	for _, test := range tests {
+		err := checkNamedArgs(test.query, map[string]interface{}{"id": 1})
+		switch {
+		case test.missing == "" && err != nil:
+			t.Errorf("unexpected error for %q: %v", test.query, err)
+		case test.missing != "" && (err == nil || !strings.Contains(err.Error(), test.missing)):
+			t.Errorf("expected %s missing in %q, got %v", test.missing, test.query, err)
+		}
+	}
+}
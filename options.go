@@ -0,0 +1,583 @@
+package builder
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// Option configures Model on construction
+type Option func(*config)
+
+// config is set of construction options
+type config struct {
+	// allowDestructive allows operations which drop data, like DropTable
+	allowDestructive bool
+
+	// settings of gorm logger
+	slowThreshold time.Duration
+	gormLogLevel  logger.LogLevel
+	logWriter     io.Writer
+	colorful      bool
+
+	// replicas are dsns of read only replicas, reads are routed to them
+	replicas []string
+
+	// connectAttempts is count of attempts to connect on construction, connectBackoff is delay before the first retry
+	connectAttempts int
+	connectBackoff  time.Duration
+
+	// prepareStmt enables caching of prepared statements
+	prepareStmt bool
+	// simpleProtocol disables implicit prepared statements of postgres driver
+	simpleProtocol bool
+
+	// naming strategy of tables and columns, namer overrides tablePrefix and singularTables
+	tablePrefix    string
+	singularTables bool
+	namer          schema.Namer
+
+	// plugins are registered right after connecting, before the first query
+	plugins []gorm.Plugin
+
+	// pool are settings of connection pool, applied after connecting
+	pool []func(sqlDB *sql.DB)
+
+	// dryRun is set for models built by NewDryRun
+	dryRun *dryRunState
+
+	// logger is used for all logs of the package
+	logger Logger
+
+	// queryLogLevel enables logging of every finished query, nil logs failures only
+	queryLogLevel *logrus.Level
+
+	// tracer starts span for every finisher, nil disables tracing. sqlInSpans attaches sql to spans
+	tracer     trace.Tracer
+	sqlInSpans bool
+
+	// metrics observes every finisher, nil disables metrics
+	metrics Metrics
+
+	// hooks called by finishers, see OnError and OnQuery
+	onError []ErrorHook
+	onQuery []func(op string, d time.Duration, rows int64)
+
+	// errorTranslator maps database errors to domain errors before common errors
+	errorTranslator func(op string, err error) error
+
+	// rawErrors makes finishers return errors of gorm and drivers as is
+	rawErrors bool
+
+	// audit records mutations into audit table, nil disables it
+	audit *auditConfig
+
+	// defaultLimit is applied to list finishers of chains without Limit, maxLimit clamps Limit, zero disables them
+	defaultLimit int
+	maxLimit     int
+
+	// saveAssociations makes Save of all chains save associations as before
+	saveAssociations bool
+
+	// autoExplain attaches plans to logs of very slow queries, nil disables it
+	autoExplain *autoExplainer
+
+	// debugDump enables DebugDump, which is disabled in production
+	debugDump bool
+
+	// strict fails finishers of all chains on columns without fields in destination
+	strict bool
+
+	// cache stores results of Cached chains, nil disables caching
+	cache Cache
+
+	// poolWaitWarnRate is rate of waits for connection per second, above which pool monitor warns, zero disables it
+	poolWaitWarnRate float64
+
+	// userSetting is postgres setting of acting user set by AsUser
+	userSetting string
+
+	// requireSchema fails finishers of chains without Schema
+	requireSchema bool
+
+	// breaker fails finishers fast after consecutive connection failures, nil disables it
+	breaker *circuitBreaker
+
+	// constraintMessages are friendly messages of constraint violations by constraint name or "table.column"
+	constraintMessages map[string]string
+
+	// failureAlert notifies about bursts of failures, nil disables it
+	failureAlert *failureDetector
+
+	// sampler suppresses repeated error logs, nil logs every error
+	sampler *errorSampler
+
+	// contextKeys and contextExtractors take fields for error logs from context of chain
+	contextKeys       []string
+	contextExtractors []func(ctx context.Context) logrus.Fields
+
+	// limits of summarized values in logs
+	loggedMaxElements  int
+	loggedHeadElements int
+	loggedMaxStringLen int
+
+	// traceDepth is count of calling frames scanned for logs, verboseFrames logs them as structs
+	traceDepth    int
+	verboseFrames bool
+
+	// captureBuildTrace captures frames of the first chainer of every chain, see CaptureBuildTrace
+	captureBuildTrace bool
+
+	// orderedTrace logs trace of chain as single ordered "queryTrace" field
+	orderedTrace bool
+
+	// redactedFields are lowercased names of fields and map keys hidden in logged payloads
+	redactedFields map[string]struct{}
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		slowThreshold: 200 * time.Millisecond,
+		gormLogLevel:  logger.Warn,
+		logWriter:     os.Stdout,
+		colorful:      true,
+
+		connectAttempts: 1,
+
+		loggedMaxElements:  defaultLoggedMaxElements,
+		loggedHeadElements: defaultLoggedHeadElements,
+		loggedMaxStringLen: defaultLoggedMaxStringLen,
+
+		logger: logrusLogger{logrus.StandardLogger()},
+
+		userSetting: "app.user_id",
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithAllowDestructive allows operations which drop data, like DropTable.
+// Disabled by default, so production code can't drop anything by mistake
+func WithAllowDestructive(allow bool) Option {
+	return func(cfg *config) {
+		cfg.allowDestructive = allow
+	}
+}
+
+// WithSlowThreshold sets duration after which query is logged as slow together with trace of chain, 200ms by default.
+// SlowThreshold overrides it for single chain
+func WithSlowThreshold(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.slowThreshold = d
+	}
+}
+
+// WithGormLogLevel sets level of gorm own logger, logger.Warn by default
+func WithGormLogLevel(l logger.LogLevel) Option {
+	return func(cfg *config) {
+		cfg.gormLogLevel = l
+	}
+}
+
+// WithLogWriter sets output of gorm own logger, os.Stdout by default
+func WithLogWriter(w io.Writer) Option {
+	return func(cfg *config) {
+		cfg.logWriter = w
+	}
+}
+
+// WithColor enables colorful output of gorm own logger, enabled by default
+func WithColor(colorful bool) Option {
+	return func(cfg *config) {
+		cfg.colorful = colorful
+	}
+}
+
+// WithReplicas routes reads outside of transactions to replicas with given dsns,
+// writes and transactions keep working with the primary. See Model.UsePrimary for read after write flows
+func WithReplicas(dsns ...string) Option {
+	return func(cfg *config) {
+		cfg.replicas = append(cfg.replicas, dsns...)
+	}
+}
+
+// WithConnectRetry makes constructor retry connecting up to attempts times.
+// Delay before the first retry is backoff, it is doubled for every next retry and slightly randomized
+func WithConnectRetry(attempts int, backoff time.Duration) Option {
+	return func(cfg *config) {
+		cfg.connectAttempts = attempts
+		cfg.connectBackoff = backoff
+	}
+}
+
+// WithMaxOpenConns sets maximum number of open connections to the database
+func WithMaxOpenConns(n int) Option {
+	return func(cfg *config) {
+		cfg.pool = append(cfg.pool, func(sqlDB *sql.DB) { sqlDB.SetMaxOpenConns(n) })
+	}
+}
+
+// WithMaxIdleConns sets maximum number of connections in the idle connection pool
+func WithMaxIdleConns(n int) Option {
+	return func(cfg *config) {
+		cfg.pool = append(cfg.pool, func(sqlDB *sql.DB) { sqlDB.SetMaxIdleConns(n) })
+	}
+}
+
+// WithConnMaxLifetime sets maximum amount of time a connection may be reused
+func WithConnMaxLifetime(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.pool = append(cfg.pool, func(sqlDB *sql.DB) { sqlDB.SetConnMaxLifetime(d) })
+	}
+}
+
+// WithConnMaxIdleTime sets maximum amount of time a connection may be idle
+func WithConnMaxIdleTime(d time.Duration) Option {
+	return func(cfg *config) {
+		cfg.pool = append(cfg.pool, func(sqlDB *sql.DB) { sqlDB.SetConnMaxIdleTime(d) })
+	}
+}
+
+// WithPrepareStmt enables caching of prepared statements for all queries, see Model.Prepared to enable it per chain
+func WithPrepareStmt(prepare bool) Option {
+	return func(cfg *config) {
+		cfg.prepareStmt = prepare
+	}
+}
+
+// WithSimpleProtocol disables implicit prepared statements of postgres driver.
+// Required when database is behind pgbouncer in transaction mode
+func WithSimpleProtocol(simple bool) Option {
+	return func(cfg *config) {
+		cfg.simpleProtocol = simple
+	}
+}
+
+// WithPlugins registers gorm plugins on construction, before the first query
+func WithPlugins(plugins ...gorm.Plugin) Option {
+	return func(cfg *config) {
+		cfg.plugins = append(cfg.plugins, plugins...)
+	}
+}
+
+// WithTablePrefix adds prefix to table names of all models
+func WithTablePrefix(prefix string) Option {
+	return func(cfg *config) {
+		cfg.tablePrefix = prefix
+	}
+}
+
+// WithSingularTables makes table names of models singular, like "user" instead of "users"
+func WithSingularTables(singular bool) Option {
+	return func(cfg *config) {
+		cfg.singularTables = singular
+	}
+}
+
+// WithNamingStrategy sets custom naming strategy, overrides WithTablePrefix and WithSingularTables
+func WithNamingStrategy(namer schema.Namer) Option {
+	return func(cfg *config) {
+		cfg.namer = namer
+	}
+}
+
+// WithLogger sets logger for all logs of the package, logrus.StandardLogger() by default
+func WithLogger(l logrus.FieldLogger) Option {
+	return func(cfg *config) {
+		cfg.logger = logrusLogger{l}
+	}
+}
+
+// WithCustomLogger sets any backend for all logs of the package, as example zap adapter from zaplog package
+func WithCustomLogger(l Logger) Option {
+	return func(cfg *config) {
+		cfg.logger = l
+	}
+}
+
+// WithSlogLogger sets slog logger for all logs of the package instead of logrus
+func WithSlogLogger(l *slog.Logger) Option {
+	return func(cfg *config) {
+		cfg.logger = slogLogger{l}
+	}
+}
+
+// WithRedactedFields hides values of fields and map keys with given names in logged payloads,
+// names are case insensitive and are matched against both go and json names of fields.
+// Fields tagged `log:"-"` are hidden regardless of this option
+func WithRedactedFields(names ...string) Option {
+	return func(cfg *config) {
+		if cfg.redactedFields == nil {
+			cfg.redactedFields = make(map[string]struct{}, len(names))
+		}
+		for _, name := range names {
+			cfg.redactedFields[strings.ToLower(name)] = struct{}{}
+		}
+	}
+}
+
+// WithErrorLogSampling logs only the first occurrence of repeated error in full,
+// further occurrences of the same message and error are suppressed and reported by compact counter log every n times.
+// Error is still returned to the caller, Unsampled disables sampling for chain
+func WithErrorLogSampling(every int) Option {
+	return func(cfg *config) {
+		if cfg.sampler == nil {
+			cfg.sampler = &errorSampler{}
+		}
+		cfg.sampler.every = every
+	}
+}
+
+// WithFailureAlert calls notify when n failures happen within window, at most once per window.
+// Failures caused by data, like constraint violations, aren't counted. The next burst after window
+// without failures is notified right away. notify is called in background, its panic is recovered and logged
+func WithFailureAlert(n int, window time.Duration, notify func(summary FailureSummary)) Option {
+	return func(cfg *config) {
+		if n <= 0 || notify == nil {
+			cfg.failureAlert = nil
+			return
+		}
+		cfg.failureAlert = &failureDetector{n: n, window: window, notify: notify}
+	}
+}
+
+// WithErrorLogBurst allows up to n full logs of the same message and error per interval,
+// count of suppressed ones is reported by the next full log. Can be combined with WithErrorLogSampling
+func WithErrorLogBurst(n int, per time.Duration) Option {
+	return func(cfg *config) {
+		if cfg.sampler == nil {
+			cfg.sampler = &errorSampler{}
+		}
+		cfg.sampler.burst = n
+		cfg.sampler.interval = per
+	}
+}
+
+// WithTraceContextKeys adds values stored in context of chain by given keys to error logs,
+// as example request id put into context by http middleware. Context is set by Model.WithContext
+func WithTraceContextKeys(keys ...string) Option {
+	return func(cfg *config) {
+		cfg.contextKeys = append(cfg.contextKeys, keys...)
+	}
+}
+
+// WithContextFieldExtractor adds fields returned by extract from context of chain to error logs,
+// useful when context values are stored by typed keys
+func WithContextFieldExtractor(extract func(ctx context.Context) logrus.Fields) Option {
+	return func(cfg *config) {
+		cfg.contextExtractors = append(cfg.contextExtractors, extract)
+	}
+}
+
+// WithQueryLogging logs every finished query with its duration, affected rows and trace of chain at given level.
+// Disabled by default, Verbose enables it for single chain
+func WithQueryLogging(level logrus.Level) Option {
+	return func(cfg *config) {
+		cfg.queryLogLevel = &level
+	}
+}
+
+// WithTracerProvider starts OpenTelemetry span for every finisher, as child of context set by Model.WithContext
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(cfg *config) {
+		cfg.tracer = tp.Tracer("gorm-logged")
+	}
+}
+
+// WithSQLInSpans attaches executed sql to spans, disabled by default since sql can contain sensitive literals
+func WithSQLInSpans(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.sqlInSpans = enabled
+	}
+}
+
+// WithMetrics observes duration and error of every finisher, as example by prometheus implementation from prommetrics package
+func WithMetrics(metrics Metrics) Option {
+	return func(cfg *config) {
+		cfg.metrics = metrics
+	}
+}
+
+// WithLoggedCollectionLimit summarizes logged slices and maps longer than maxElements
+// as their type, length and the first headElements elements. 100 and 5 by default
+func WithLoggedCollectionLimit(maxElements, headElements int) Option {
+	return func(cfg *config) {
+		cfg.loggedMaxElements = maxElements
+		cfg.loggedHeadElements = headElements
+	}
+}
+
+// WithLoggedStringLimit summarizes logged strings and byte slices longer than maxLen as their length and prefix.
+// 1024 by default
+func WithLoggedStringLimit(maxLen int) Option {
+	return func(cfg *config) {
+		cfg.loggedMaxStringLen = maxLen
+	}
+}
+
+// WithOrderedTrace logs trace of chain as single "queryTrace" field holding entries in order of chainer calls,
+// instead of separate field per entry
+func WithOrderedTrace(ordered bool) Option {
+	return func(cfg *config) {
+		cfg.orderedTrace = ordered
+	}
+}
+
+// WithTraceDepth sets count of calling frames scanned for "trace" field of logs, 99 by default.
+// Deep stacks of workers may need more
+func WithTraceDepth(n int) Option {
+	return func(cfg *config) {
+		cfg.traceDepth = n
+	}
+}
+
+// WithVerboseFrames logs "trace" field as frames with full function names and paths instead of
+// compact strings like "orders.(*Service).Get orders/service.go:123"
+func WithVerboseFrames(verbose bool) Option {
+	return func(cfg *config) {
+		cfg.verboseFrames = verbose
+	}
+}
+
+// CaptureBuildTrace captures calling frames of the first chainer of every chain, they are logged
+// as "buildTrace" together with frames of failed finisher as "execTrace" when they differ, as example
+// when chain is built by request and executed by background worker. Disabled by default, since it costs
+// runtime.Callers per chain
+func CaptureBuildTrace(capture bool) Option {
+	return func(cfg *config) {
+		cfg.captureBuildTrace = capture
+	}
+}
+
+// WithErrorTranslator lets domain map database errors of finishers to its own errors, as example by constraint name.
+// translate gets original database error, its non nil result is returned by finisher instead of common error
+func WithErrorTranslator(translate func(op string, err error) error) Option {
+	return func(cfg *config) {
+		cfg.errorTranslator = translate
+	}
+}
+
+// WithRawErrors makes finishers return errors of gorm and drivers as is instead of common errors by default,
+// useful for internal tooling. Failures are still logged
+func WithRawErrors(raw bool) Option {
+	return func(cfg *config) {
+		cfg.rawErrors = raw
+	}
+}
+
+// WithConstraintMessages registers friendly messages of constraint violations by constraint name
+// or by table and column as "table.column". Violations of registered constraints are returned as
+// *common.ConstraintError, unknown constraints fall back to common errors
+func WithConstraintMessages(messages map[string]string) Option {
+	return func(cfg *config) {
+		cfg.constraintMessages = messages
+	}
+}
+
+// WithCircuitBreaker fails finishers fast with common.ErrUnavailable for cooldown after threshold consecutive
+// connection failures, instead of waiting for connect timeout on every query while database is down.
+// After cooldown single query probes database and closes breaker on success. Constraint violations,
+// not found records and other errors of queries themselves don't trip it, see BreakerState
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(cfg *config) {
+		cfg.breaker = &circuitBreaker{threshold: threshold, cooldown: cooldown, state: breakerClosed}
+	}
+}
+
+// WithRequiredSchema fails finishers of chains without Schema with internal error,
+// so query which forgot about tenant can't leak data of another one
+func WithRequiredSchema(required bool) Option {
+	return func(cfg *config) {
+		cfg.requireSchema = required
+	}
+}
+
+// WithAudit records every Create, Updates, Delete and UpsertBatch into table inside transaction of the mutation,
+// failure to record fails the mutation. actor takes author of mutation from context of chain, may be nil.
+// Deleted rows aren't loaded, value passed to Delete is recorded, see AuditRecord.
+// Table can be created by MigrateAudit
+func WithAudit(table string, actor func(ctx context.Context) string) Option {
+	return func(cfg *config) {
+		cfg.audit = &auditConfig{table: table, actor: actor}
+	}
+}
+
+// WithDefaultLimit applies limit n to Find, FindMaps and Scan of chains without Limit,
+// so forgotten Limit doesn't stream the whole table. Count, Pluck and Unlimited chains are not limited
+func WithDefaultLimit(n int) Option {
+	return func(cfg *config) {
+		cfg.defaultLimit = n
+	}
+}
+
+// WithMaxLimit clamps Limit above n with warning log, Unlimited chains are not clamped
+func WithMaxLimit(n int) Option {
+	return func(cfg *config) {
+		cfg.maxLimit = n
+	}
+}
+
+// WithSaveAssociations makes Save of all chains save associations of value as it did before, see Save.
+// Transitional option, chains which need associations to be saved should call WithAssociations instead
+func WithSaveAssociations(save bool) Option {
+	return func(cfg *config) {
+		cfg.saveAssociations = save
+	}
+}
+
+// WithUserSetting sets name of postgres setting, which AsUser sets to id of acting user, app.user_id by default
+func WithUserSetting(name string) Option {
+	return func(cfg *config) {
+		cfg.userSetting = name
+	}
+}
+
+// WithPoolWaitWarnRate makes StartPoolMonitor warn when waits for connection grow faster than perSecond,
+// which is early sign of exhausted connection pool
+func WithPoolWaitWarnRate(perSecond float64) Option {
+	return func(cfg *config) {
+		cfg.poolWaitWarnRate = perSecond
+	}
+}
+
+// WithCache sets cache of Cached chains, as example NewLRUCache. Without it Cached chains always query database
+func WithCache(c Cache) Option {
+	return func(cfg *config) {
+		cfg.cache = c
+	}
+}
+
+// WithStrict enables Strict for all chains, as example in development. Disabled by default
+func WithStrict(strict bool) Option {
+	return func(cfg *config) {
+		cfg.strict = strict
+	}
+}
+
+// WithDebugDump enables DebugDump for local troubleshooting, it only logs warning by default
+func WithDebugDump(enabled bool) Option {
+	return func(cfg *config) {
+		cfg.debugDump = enabled
+	}
+}
+
+// WithAutoExplain attaches plan of query to slow query log, when query is slower than threshold.
+// Plan is got by EXPLAIN without ANALYZE, so query isn't run again. Statements differing by values only
+// are explained at most once per interval
+func WithAutoExplain(threshold, interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.autoExplain = &autoExplainer{threshold: threshold, interval: interval}
+	}
+}
@@ -0,0 +1,93 @@
+package builder
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+type optionNode struct {
+	ID   int
+	Name string
+}
+
+func TestGormLoggerOptions(t *testing.T) {
+	var out bytes.Buffer
+	m := NewDryRun(dialectSQLite,
+		WithLogWriter(&out),
+		WithGormLogLevel(logger.Info),
+		WithColor(false),
+		WithSlowThreshold(time.Minute),
+	)
+	l, ok := m.db.Config.Logger.(gormLogger)
+	if !ok {
+		t.Fatalf("unexpected gorm logger %T", m.db.Config.Logger)
+	}
+	if l.level != logger.Info || l.cfg.slowThreshold != time.Minute {
+		t.Errorf("options don't reach gorm logger, level %v, slow threshold %v", l.level, l.cfg.slowThreshold)
+	}
+
+	var nodes []optionNode
+	if err := m.Where("name = ?", "a").Find(&nodes); err != nil {
+		t.Fatalf("can't build query: %v", err)
+	}
+	logged := out.String()
+	if !strings.Contains(logged, "SELECT * FROM `option_nodes` WHERE name = \"a\"") {
+		t.Errorf("query isn't logged to writer: %q", logged)
+	}
+	if strings.Contains(logged, "\x1b[") {
+		t.Errorf("colors aren't disabled: %q", logged)
+	}
+}
+
+func TestGormLoggerDefaults(t *testing.T) {
+	cfg := newConfig(nil)
+	if cfg.gormLogLevel != logger.Warn || !cfg.colorful || cfg.slowThreshold != 200*time.Millisecond {
+		t.Errorf("unexpected defaults, level %v, colorful %v, slow threshold %v", cfg.gormLogLevel, cfg.colorful, cfg.slowThreshold)
+	}
+}
+
+func TestNamingStrategyOptions(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		table string
+	}{
+		{"default", nil, `"option_nodes"`},
+		{"prefix", []Option{WithTablePrefix("svc_")}, `"svc_option_nodes"`},
+		{"singular", []Option{WithSingularTables(true)}, `"option_node"`},
+		{"prefix and singular", []Option{WithTablePrefix("svc_"), WithSingularTables(true)}, `"svc_option_node"`},
+		{"strategy", []Option{WithTablePrefix("ignored_"), WithNamingStrategy(schema.NamingStrategy{TablePrefix: "custom_"})}, `"custom_option_nodes"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewDryRun(dialectPostgres, append([]Option{WithGormLogLevel(logger.Silent)}, test.opts...)...)
+
+			var nodes []optionNode
+			if err := m.Find(&nodes); err != nil {
+				t.Fatalf("can't build query: %v", err)
+			}
+			if sql, _ := m.LastSQL(); !strings.Contains(sql, "FROM "+test.table) {
+				t.Errorf("find doesn't use table %s: %s", test.table, sql)
+			}
+
+			if err := m.UpdateByFilter(optionNode{Name: "a"}, map[string]interface{}{"name": "b"}); err != nil {
+				t.Fatalf("can't build update: %v", err)
+			}
+			if sql, _ := m.LastSQL(); !strings.HasPrefix(sql, "UPDATE "+test.table) {
+				t.Errorf("UpdateByFilter doesn't use table %s: %s", test.table, sql)
+			}
+
+			if err := m.Migrate(&optionNode{}); err != nil {
+				t.Fatalf("can't build migration: %v", err)
+			}
+			if sql, _ := m.LastSQL(); !strings.HasPrefix(sql, "CREATE TABLE "+test.table) {
+				t.Errorf("Migrate doesn't use table %s: %s", test.table, sql)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm-logged/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OrderFromString is gorm extension. Orders chain by client sort spec like "name,-created_at",
+// where leading "-" means descending order. Fields are mapped to column expressions by allowed,
+// so spec never reaches sql as is. Unknown fields fail finishers of chain with common.ErrBadSort
+func (m *Model) OrderFromString(spec string, allowed map[string]string) *Model {
+	var (
+		columns  []clause.OrderByColumn
+		applied  []string
+		rejected []string
+	)
+	for _, token := range strings.Split(spec, ",") {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		field := strings.TrimLeft(token, "+-")
+		desc := strings.HasPrefix(token, "-")
+		column, ok := allowed[field]
+		if !ok {
+			rejected = append(rejected, token)
+			continue
+		}
+		columns = append(columns, clause.OrderByColumn{Column: clause.Column{Name: column, Raw: true}, Desc: desc})
+		if desc {
+			applied = append(applied, column+" DESC")
+		} else {
+			applied = append(applied, column+" ASC")
+		}
+	}
+
+	i := m.logTrace.freeIndex("orderFromString")
+	trace := m.logTrace.with("orderFromString"+i, spec)
+	if len(rejected) > 0 {
+		trace = trace.with("rejectedSortFields"+i, rejected)
+		return m.chain(m.db, trace).failed(fmt.Errorf("%w: %s", common.ErrBadSort, strings.Join(rejected, ", ")))
+	}
+	if len(columns) == 0 {
+		return m.chain(m.db, trace)
+	}
+	trace = trace.with("appliedOrder"+i, strings.Join(applied, ", "))
+	return m.chain(addOrder(m.db, clause.OrderBy{Columns: columns}), trace)
+}
+
+// orderByValue converts value of Order into ordering the same way gorm does, false for empty and unsupported values
+func orderByValue(value interface{}) (clause.OrderBy, bool) {
+	switch v := value.(type) {
+	case clause.OrderByColumn:
+		return clause.OrderBy{Columns: []clause.OrderByColumn{v}}, true
+	case string:
+		if v != "" {
+			return clause.OrderBy{Columns: []clause.OrderByColumn{{Column: clause.Column{Name: v, Raw: true}}}}, true
+		}
+	}
+	return clause.OrderBy{}, false
+}
+
+// addOrder appends ordering to ordering of db. gorm keeps either columns or expression of ORDER BY when
+// orderings are merged, so orderings by expression with vars, like OrderByRank, are combined with the others
+// into single expression. Columns with Reorder replace ordering as usual
+func addOrder(db *gorm.DB, order clause.OrderBy) *gorm.DB {
+	existing, ok := db.Statement.Clauses["ORDER BY"].Expression.(clause.OrderBy)
+	if !ok || (existing.Expression == nil && order.Expression == nil) {
+		return db.Clauses(order)
+	}
+	for _, column := range order.Columns {
+		if column.Reorder {
+			return db.Clauses(order)
+		}
+	}
+	return db.Clauses(clause.OrderBy{Expression: clause.Expr{SQL: "?,?", Vars: []interface{}{orderItems(existing), orderItems(order)}}})
+}
+
+// orderItems builds items of ordering without ORDER BY keyword, which is written by gorm for clauses passed as vars
+type orderItems clause.OrderBy
+
+func (o orderItems) Build(builder clause.Builder) {
+	clause.OrderBy(o).Build(builder)
+}
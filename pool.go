@@ -0,0 +1,57 @@
+package builder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StartPoolMonitor samples statistics of connection pool every interval and passes them to report,
+// as example to ReportPoolStats of prommetrics. Warns when waits for connection grow faster
+// than WithPoolWaitWarnRate. Monitor stops when ctx is cancelled
+func (m *Model) StartPoolMonitor(ctx context.Context, interval time.Duration, report func(sql.DBStats)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		prev := m.Stats()
+		prevAt := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				stats := m.Stats()
+				if report != nil {
+					report(stats)
+				}
+				m.checkPoolWaits(prev, stats, now.Sub(prevAt))
+				prev, prevAt = stats, now
+			}
+		}
+	}()
+}
+
+// checkPoolWaits warns when waits for connection grew faster than WithPoolWaitWarnRate during elapsed
+func (m *Model) checkPoolWaits(prev, stats sql.DBStats, elapsed time.Duration) {
+	if m.cfg.poolWaitWarnRate <= 0 || elapsed <= 0 {
+		return
+	}
+	waits := stats.WaitCount - prev.WaitCount
+	rate := float64(waits) / elapsed.Seconds()
+	if rate <= m.cfg.poolWaitWarnRate {
+		return
+	}
+	m.logWarn(fmt.Sprintf("waits for connection grow fast, pool may be exhausted, max open connections is %d",
+		stats.MaxOpenConnections), nil, logrus.Fields{
+		"poolWaits":           waits,
+		"poolWaitRate":        rate,
+		"poolWaitWarnRate":    m.cfg.poolWaitWarnRate,
+		"poolWaitDuration":    (stats.WaitDuration - prev.WaitDuration).String(),
+		"poolInUse":           stats.InUse,
+		"poolOpenConnections": stats.OpenConnections,
+		"maxOpenConnections":  stats.MaxOpenConnections,
+	})
+}
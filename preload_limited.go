@@ -0,0 +1,167 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// limitedRowNumber is column of row number of preloaded record within its parent
+const limitedRowNumber = "gorm_logged_rn"
+
+// limitedPreload is association preloaded by PreloadLimited
+type limitedPreload struct {
+	column     string
+	limit      int
+	order      string
+	conditions []interface{}
+}
+
+// PreloadLimited is gorm extension. Preloads has many or has one association column with at most limit records
+// per parent in given order, as example 3 newest comments of every post. order is sql like "created_at DESC",
+// primary key order by default. Records are selected by ROW_NUMBER window on postgres after the main query
+// of First, Last, Take and Find, other dialects fall back to Preload of all records in order
+func (m *Model) PreloadLimited(column string, limit int, order string, conditions ...interface{}) *Model {
+	trace := m.logTrace.with("preloadLimitedColumn-"+column, column).
+		with("preloadLimitedLimit-"+column, limit).
+		with("preloadLimitedOrder-"+column, order)
+	if len(conditions) > 0 {
+		trace = trace.with("preloadLimitedConditions-"+column, deferPrint(conditions))
+	}
+	if m.dialect() != dialectPostgres {
+		m.logWarn("queryBuilder.PreloadLimited falls back to Preload of all records on "+m.dialect(), nil, logrus.Fields{
+			"preloadLimitedColumn": column,
+			"trace":                m.frames(),
+		})
+		if order != "" {
+			conditions = append(conditions, func(db *gorm.DB) *gorm.DB { return db.Order(order) })
+		}
+		c := m.Preload(column, conditions...)
+		c.logTrace = trace
+		return c
+	}
+	c := m.chain(m.db, trace)
+	c.limitedPreloads = append(m.limitedPreloads[:len(m.limitedPreloads):len(m.limitedPreloads)], limitedPreload{
+		column:     column,
+		limit:      limit,
+		order:      order,
+		conditions: conditions,
+	})
+	return c
+}
+
+// loadLimitedPreloads loads associations of PreloadLimited into found dest
+func (m *Model) loadLimitedPreloads(op string, dest interface{}) error {
+	if len(m.limitedPreloads) == 0 {
+		return nil
+	}
+	s, err := m.parseSchema(dest)
+	if err != nil {
+		return m.fail(op, "can't parse schema of preloading parent", err, logrus.Fields{"trace": m.frames()})
+	}
+	parents := reflect.Indirect(reflect.ValueOf(dest))
+	for _, p := range m.limitedPreloads {
+		if err := m.loadLimited(s, parents, p); err != nil {
+			return m.fail(op, "can't preload limited association", err, logrus.Fields{
+				"preloadLimitedColumn": p.column,
+				"trace":                m.frames(),
+			})
+		}
+	}
+	return nil
+}
+
+// loadLimited selects limited records of association p for parents and assigns them to parents
+func (m *Model) loadLimited(s *schema.Schema, parents reflect.Value, p limitedPreload) error {
+	rel := s.Relationships.Relations[p.column]
+	if rel == nil || (rel.Type != schema.HasMany && rel.Type != schema.HasOne) || len(rel.References) != 1 {
+		return fmt.Errorf("%s of %s is not has many or has one association with single foreign key", p.column, s.Name)
+	}
+	ref := rel.References[0]
+	ctx := context.Background()
+
+	elems := make([]reflect.Value, 0, 1)
+	if parents.Kind() == reflect.Slice || parents.Kind() == reflect.Array {
+		for i := 0; i < parents.Len(); i++ {
+			elems = append(elems, reflect.Indirect(parents.Index(i)))
+		}
+	} else {
+		elems = append(elems, parents)
+	}
+	keys := make([]interface{}, 0, len(elems))
+	for _, elem := range elems {
+		if key, zero := ref.PrimaryKey.ValueOf(ctx, elem); !zero {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	order := p.order
+	if order == "" && rel.FieldSchema.PrioritizedPrimaryField != nil {
+		order = m.db.Statement.Quote(rel.FieldSchema.PrioritizedPrimaryField.DBName)
+	}
+	fk := clause.Column{Name: ref.ForeignKey.DBName}
+	// model applies soft delete of children before they are numbered, so deleted ones don't count toward limit
+	inner := m.traced().Session(&gorm.Session{NewDB: true}).Model(reflect.New(rel.FieldSchema.ModelType).Interface()).
+		Select("*, ROW_NUMBER() OVER (PARTITION BY ? ORDER BY "+order+") AS "+limitedRowNumber, fk).
+		Where(clause.IN{Column: fk, Values: keys})
+	if len(p.conditions) > 0 {
+		inner = inner.Where(p.conditions[0], p.conditions[1:]...)
+	}
+	children := reflect.New(reflect.SliceOf(rel.FieldSchema.ModelType))
+	err := m.traced().Session(&gorm.Session{NewDB: true}).
+		Table("(?) AS ?", inner, clause.Table{Name: rel.FieldSchema.Table}).
+		Where(limitedRowNumber+" <= ?", p.limit).
+		Order(limitedRowNumber).
+		Find(children.Interface()).Error
+	if err != nil {
+		return err
+	}
+
+	grouped := make(map[string][]reflect.Value)
+	for i := 0; i < children.Elem().Len(); i++ {
+		child := children.Elem().Index(i)
+		key, _ := ref.ForeignKey.ValueOf(ctx, child)
+		grouped[fmt.Sprint(key)] = append(grouped[fmt.Sprint(key)], child)
+	}
+	for _, elem := range elems {
+		key, _ := ref.PrimaryKey.ValueOf(ctx, elem)
+		if err := assignLimited(ctx, rel.Field, elem, grouped[fmt.Sprint(key)]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assignLimited sets association field of parent to children, pointers and slices of pointers are supported
+func assignLimited(ctx context.Context, field *schema.Field, parent reflect.Value, children []reflect.Value) error {
+	fieldValue := field.ReflectValueOf(ctx, parent)
+	wrap := func(child reflect.Value, t reflect.Type) reflect.Value {
+		if t.Kind() == reflect.Ptr {
+			ptr := reflect.New(child.Type())
+			ptr.Elem().Set(child)
+			return ptr
+		}
+		return child
+	}
+	if fieldValue.Kind() != reflect.Slice {
+		if len(children) == 0 {
+			return nil
+		}
+		fieldValue.Set(wrap(children[0], fieldValue.Type()))
+		return nil
+	}
+	slice := reflect.MakeSlice(fieldValue.Type(), 0, len(children))
+	for _, child := range children {
+		slice = reflect.Append(slice, wrap(child, fieldValue.Type().Elem()))
+	}
+	fieldValue.Set(slice)
+	return nil
+}
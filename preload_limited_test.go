@@ -0,0 +1,40 @@
+package builder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type thread struct {
+	ID       int
+	Comments []comment
+}
+
+type comment struct {
+	ID        int
+	ThreadID  int
+	DeletedAt gorm.DeletedAt
+}
+
+func TestPreloadLimitedSkipsDeletedBeforeNumbering(t *testing.T) {
+	m := NewDryRun(dialectPostgres)
+	s, err := m.parseSchema(&thread{})
+	if err != nil {
+		t.Fatalf("can't parse schema: %v", err)
+	}
+	threads := []thread{{ID: 1}, {ID: 2}}
+	if err := m.loadLimited(s, reflect.ValueOf(threads), limitedPreload{column: "Comments", limit: 3}); err != nil {
+		t.Fatalf("can't build query: %v", err)
+	}
+	sql, _ := m.LastSQL()
+	inner, _, ok := strings.Cut(sql, ") AS \"comments\"")
+	if !ok {
+		t.Fatalf("unexpected sql %s", sql)
+	}
+	if !strings.Contains(inner, `ROW_NUMBER()`) || !strings.Contains(inner, `"comments"."deleted_at" IS NULL`) {
+		t.Fatalf("expected deleted comments skipped inside numbered query, got %s", sql)
+	}
+}
@@ -0,0 +1,107 @@
+// Package prommetrics implements builder.Metrics by prometheus, so importing prometheus stays optional
+package prommetrics
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "gorm_logged"
+
+// Metrics collects durations and errors of queries labeled by operation and table,
+// and statistics of connection pool if CollectPoolStats is called.
+// Metrics is prometheus.Collector, so it has to be registered in registry
+type Metrics struct {
+	durations *prometheus.HistogramVec
+	errors    *prometheus.CounterVec
+
+	stats func() sql.DBStats
+
+	// sampled are the last stats passed to ReportPoolStats
+	mu      sync.Mutex
+	sampled *sql.DBStats
+}
+
+var (
+	openConnectionsDesc = prometheus.NewDesc(namespace+"_pool_open_connections", "Count of established connections, both in use and idle", nil, nil)
+	inUseDesc           = prometheus.NewDesc(namespace+"_pool_in_use_connections", "Count of connections currently in use", nil, nil)
+	idleDesc            = prometheus.NewDesc(namespace+"_pool_idle_connections", "Count of idle connections", nil, nil)
+	waitCountDesc       = prometheus.NewDesc(namespace+"_pool_wait_total", "Total count of connections waited for", nil, nil)
+	waitDurationDesc    = prometheus.NewDesc(namespace+"_pool_wait_seconds_total", "Total time blocked waiting for new connection", nil, nil)
+)
+
+// New creates metrics, pass it to builder.WithMetrics and register in prometheus registry
+func New() *Metrics {
+	return &Metrics{
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_duration_seconds",
+			Help:      "Duration of queries by operation and table",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "table"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "query_errors_total",
+			Help:      "Count of failed queries by operation and table",
+		}, []string{"operation", "table"}),
+	}
+}
+
+// CollectPoolStats enables gauges of connection pool, stats are sampled on every scrape.
+// Usually stats is Stats method of builder.Model
+func (m *Metrics) CollectPoolStats(stats func() sql.DBStats) {
+	m.stats = stats
+}
+
+// ReportPoolStats updates gauges of connection pool by sampled stats, pass it to StartPoolMonitor of builder.Model.
+// Stats of CollectPoolStats take precedence
+func (m *Metrics) ReportPoolStats(stats sql.DBStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sampled = &stats
+}
+
+// ObserveQuery is builder.Metrics func
+func (m *Metrics) ObserveQuery(op, table string, d time.Duration, err error) {
+	m.durations.WithLabelValues(op, table).Observe(d.Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(op, table).Inc()
+	}
+}
+
+// Describe is prometheus.Collector func
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.durations.Describe(ch)
+	m.errors.Describe(ch)
+	ch <- openConnectionsDesc
+	ch <- inUseDesc
+	ch <- idleDesc
+	ch <- waitCountDesc
+	ch <- waitDurationDesc
+}
+
+// Collect is prometheus.Collector func
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.durations.Collect(ch)
+	m.errors.Collect(ch)
+	m.mu.Lock()
+	sampled := m.sampled
+	m.mu.Unlock()
+	if m.stats == nil && sampled == nil {
+		return
+	}
+	var stats sql.DBStats
+	if m.stats != nil {
+		stats = m.stats()
+	} else {
+		stats = *sampled
+	}
+	ch <- prometheus.MustNewConstMetric(openConnectionsDesc, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(inUseDesc, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(idleDesc, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(waitCountDesc, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(waitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
@@ -0,0 +1,131 @@
+package builder
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// Metrics observes every finisher query, see WithMetrics.
+// Operation is lowercased name of finisher, as example "first" or "updates", err is nil for not found records
+type Metrics interface {
+	ObserveQuery(op, table string, d time.Duration, err error)
+}
+
+// startedQuery measures finisher query for WithQueryLogging, Verbose, WithTracerProvider, WithMetrics and OnQuery
+type startedQuery struct {
+	m    *Model
+	name string
+	// op is name of operation set by Named, name of finisher by default
+	op      string
+	startAt time.Time
+	// level is nil when logging of finished queries is disabled
+	level *logrus.Level
+	// span is nil when tracing is disabled
+	span trace.Span
+}
+
+// startQuery starts measuring of finisher query, returns nil when query logging, tracing, metrics and hooks are disabled
+func (m *Model) startQuery(name string) *startedQuery {
+	level := m.queryLogLevel
+	if level == nil {
+		level = m.cfg.queryLogLevel
+	}
+	if level == nil && m.cfg.tracer == nil && m.cfg.metrics == nil && len(m.cfg.onQuery) == 0 {
+		return nil
+	}
+	q := &startedQuery{m: m, name: name, op: m.operation(name), startAt: time.Now(), level: level}
+	if m.cfg.tracer != nil {
+		_, q.span = m.cfg.tracer.Start(m.db.Statement.Context, "db."+name, trace.WithSpanKind(trace.SpanKindClient))
+	}
+	return q
+}
+
+// done finishes measuring of query, does nothing for nil query
+func (q *startedQuery) done(db *gorm.DB) *gorm.DB {
+	if q == nil {
+		return db
+	}
+	if q.span != nil {
+		q.endSpan(db)
+	}
+	if q.m.cfg.metrics != nil {
+		err := db.Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = nil
+		}
+		q.m.cfg.metrics.ObserveQuery(q.op, db.Statement.Table, time.Since(q.startAt), err)
+	}
+	if q.level != nil {
+		q.log(db)
+	}
+	if len(q.m.cfg.onQuery) > 0 {
+		q.m.runQueryHooks(q.op, time.Since(q.startAt), db.RowsAffected)
+	}
+	return db
+}
+
+// log logs finished query at configured level
+func (q *startedQuery) log(db *gorm.DB) {
+	fields := logrus.Fields{
+		"finisher":     q.name,
+		"duration":     time.Since(q.startAt).String(),
+		"rowsAffected": db.RowsAffected,
+	}
+	switch {
+	case *q.level <= logrus.ErrorLevel:
+		q.m.logError("query finished", db.Error, fields)
+	case *q.level == logrus.WarnLevel:
+		q.m.logWarn("query finished", db.Error, fields)
+	default:
+		q.m.logDebug("query finished", db.Error, fields)
+	}
+}
+
+// endSpan records result of query into span and ends it
+func (q *startedQuery) endSpan(db *gorm.DB) {
+	q.span.SetAttributes(
+		attribute.String("db.system", q.m.dialect()),
+		attribute.String("db.operation", q.op),
+		attribute.String("db.sql.table", db.Statement.Table),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if q.m.cfg.sqlInSpans {
+		q.span.SetAttributes(attribute.String("db.statement", db.Statement.SQL.String()))
+	}
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		q.span.RecordError(db.Error)
+		q.span.SetStatus(codes.Error, db.Error.Error())
+	}
+	q.span.End()
+}
+
+// Named names operation of chain for logs, metrics and hooks instead of finisher name.
+// Transactions begun from the chain inherit the name, the last call wins
+func (m *Model) Named(op string) *Model {
+	trace := m.logTrace.with("operation", op)
+	c := m.chain(m.db, trace)
+	c.op = op
+	return c
+}
+
+// operation returns name set by Named or given name of finisher
+func (m *Model) operation(finisher string) string {
+	if m.op != "" {
+		return m.op
+	}
+	return finisher
+}
+
+// Verbose logs every finisher of chain at debug level with its duration, see WithQueryLogging
+func (m *Model) Verbose() *Model {
+	c := m.chain(m.db, m.logTrace)
+	level := logrus.DebugLevel
+	c.queryLogLevel = &level
+	return c
+}
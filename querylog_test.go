@@ -0,0 +1,150 @@
+package builder
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type loggedQueryNode struct {
+	ID   int
+	Name string
+}
+
+func TestVerboseLogsFinishers(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &loggedQueryNode{})
+	if err := m.Create(&loggedQueryNode{Name: "a"}); err != nil {
+		t.Fatalf("can't create node: %v", err)
+	}
+	if entries := hook.AllEntries(); len(entries) != 0 {
+		t.Fatalf("expected no logs of successful query without Verbose, got %q", entries[0].Message)
+	}
+
+	var nodes []loggedQueryNode
+	if err := m.Verbose().Where("name = ?", "a").Find(&nodes); err != nil {
+		t.Fatalf("can't find nodes: %v", err)
+	}
+	entries := entriesAt(hook, logrus.DebugLevel)
+	if len(entries) != 1 {
+		t.Fatalf("expected single debug log, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Data["finisher"] != "find" || e.Data["rowsAffected"] != int64(1) {
+		t.Errorf("unexpected fields of logged query: %v", e.Data)
+	}
+	if _, ok := e.Data["duration"].(string); !ok {
+		t.Errorf("duration isn't logged: %v", e.Data)
+	}
+	if _, ok := e.Data["whereQuery0"]; !ok {
+		t.Errorf("trace of chain isn't logged: %v", e.Data)
+	}
+}
+
+func TestWithQueryLogging(t *testing.T) {
+	m, hook := newLoggedModel(t, []Option{WithQueryLogging(logrus.WarnLevel)}, &loggedQueryNode{})
+	if err := m.Create(&loggedQueryNode{Name: "a"}); err != nil {
+		t.Fatalf("can't create node: %v", err)
+	}
+	if _, err := m.Model(&loggedQueryNode{}).Count(); err != nil {
+		t.Fatalf("can't count nodes: %v", err)
+	}
+	entries := entriesAt(hook, logrus.WarnLevel)
+	if len(entries) != 2 {
+		t.Fatalf("expected warnings of both queries, got %d", len(entries))
+	}
+	if entries[0].Data["finisher"] != "create" || entries[1].Data["finisher"] != "count" {
+		t.Errorf("unexpected finishers logged: %v, %v", entries[0].Data["finisher"], entries[1].Data["finisher"])
+	}
+}
+
+func TestStartQueryIsNilWhenDisabled(t *testing.T) {
+	m, _ := newLoggedModel(t, nil)
+	if q := m.startQuery("find"); q != nil {
+		t.Fatalf("expected nil query when logging, tracing, metrics and hooks are disabled, got %+v", q)
+	}
+}
+
+// BenchmarkQueryLogging measures overhead of query logging around the finisher, disabled logging has to be free
+func BenchmarkQueryLogging(b *testing.B) {
+	for _, bench := range []struct {
+		name string
+		opts []Option
+	}{
+		{"disabled", nil},
+		{"enabled", []Option{WithQueryLogging(logrus.DebugLevel)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			m, _ := newLoggedModel(b, bench.opts)
+			db := m.db
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.startQuery("find").done(db)
+			}
+		})
+	}
+}
+
+// recordingMetrics stores operations of observed queries
+type recordingMetrics struct {
+	ops []string
+}
+
+func (r *recordingMetrics) ObserveQuery(op, _ string, _ time.Duration, _ error) {
+	r.ops = append(r.ops, op)
+}
+
+func TestNamedOperation(t *testing.T) {
+	metrics := &recordingMetrics{}
+	var queried, failed []string
+	m, hook := newLoggedModel(t, []Option{
+		WithMetrics(metrics),
+		OnQuery(func(op string, _ time.Duration, _ int64) { queried = append(queried, op) }),
+		OnError(func(op string, _ error, _ logrus.Fields) { failed = append(failed, op) }),
+	}, &loggedQueryNode{})
+
+	var nodes []loggedQueryNode
+	if err := m.Named("listNodes").Find(&nodes); err != nil {
+		t.Fatalf("can't find nodes: %v", err)
+	}
+	if err := m.Find(&nodes); err != nil {
+		t.Fatalf("can't find nodes: %v", err)
+	}
+	if err := m.Named("first").Named("listMissing").Table("missing_table").Find(&nodes); err == nil {
+		t.Fatal("expected error of missing table")
+	}
+
+	want := []string{"listNodes", "find", "listMissing"}
+	if fmt.Sprint(metrics.ops) != fmt.Sprint(want) || fmt.Sprint(queried) != fmt.Sprint(want) {
+		t.Errorf("expected operations %v, metrics got %v, hooks got %v", want, metrics.ops, queried)
+	}
+	if len(failed) != 1 || failed[0] != "listMissing" {
+		t.Errorf("expected failure of listMissing, got %v", failed)
+	}
+	entries := entriesAt(hook, logrus.ErrorLevel)
+	if len(entries) != 1 || entries[0].Data["operation"] != "listMissing" {
+		t.Errorf("operation isn't logged: %v", entries)
+	}
+}
+
+func TestNamedOperationSurvivesBegin(t *testing.T) {
+	metrics := &recordingMetrics{}
+	m, hook := newLoggedModel(t, []Option{WithMetrics(metrics)}, &loggedQueryNode{})
+	tx := m.Named("importNodes").Begin()
+	defer tx.EnsureRollback()
+	if err := tx.Create(&loggedQueryNode{Name: "a"}); err != nil {
+		t.Fatalf("can't create node: %v", err)
+	}
+	var nodes []loggedQueryNode
+	if err := tx.Table("missing_table").Find(&nodes); err == nil {
+		t.Fatal("expected error of missing table")
+	}
+	if len(metrics.ops) != 2 || metrics.ops[0] != "importNodes" || metrics.ops[1] != "importNodes" {
+		t.Errorf("transaction doesn't inherit operation: %v", metrics.ops)
+	}
+	if entries := entriesAt(hook, logrus.ErrorLevel); len(entries) != 1 || entries[0].Data["operation"] != "importNodes" {
+		t.Errorf("operation isn't logged in transaction: %v", entries)
+	}
+}
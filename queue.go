@@ -0,0 +1,39 @@
+package builder
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DequeueBatch is gorm extension for job queues on table. Inside transaction selects up to n rows matching
+// conditions of chain in its order with FOR UPDATE SKIP LOCKED into dest, so concurrent consumers never get
+// the same rows, and calls markClaimed with primary keys of selected rows before commit.
+// markClaimed is not called when nothing is selected, its error rollbacks the transaction and is returned as is
+func (m *Model) DequeueBatch(dest interface{}, n int, markClaimed func(tx *Model, ids []interface{}) error) error {
+	if err := m.requireDialect("DequeueBatch", dialectPostgres, dialectMySQL); err != nil {
+		return err
+	}
+	// transaction is begun from clean statement, so conditions of chain don't leak into markClaimed
+	base := m.chain(m.db.Session(&gorm.Session{NewDB: true}), m.logTrace)
+	return base.Transaction(func(tx *Model) error {
+		query := m.applyPreloads().db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).Limit(n)
+		query.Statement.ConnPool = tx.db.Statement.ConnPool
+		q := m.startQuery("dequeueBatch")
+		res := q.done(query.Find(dest))
+		if err := res.Error; err != nil {
+			tx.tx.remember(err)
+			return m.fail("dequeueBatch", "can't dequeue batch from the database", err, m.sqlFields(res), logrus.Fields{
+				"dequeueBatchDest": fmt.Sprintf("%T", dest),
+				"dequeueBatchSize": n,
+				"trace":            m.frames(),
+			})
+		}
+		if res.RowsAffected == 0 {
+			return nil
+		}
+		return markClaimed(tx, primaryKeys(res.Statement))
+	})
+}
@@ -0,0 +1,105 @@
+package builder
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/gorm/logger"
+)
+
+type queueJob struct {
+	ID      int
+	Status  string `gorm:"size:16"`
+	Claimer int
+}
+
+func TestDequeueBatchRequiresDialect(t *testing.T) {
+	m := newTestModel(t, nil, &queueJob{})
+	var jobs []queueJob
+	err := m.DequeueBatch(&jobs, 10, func(*Model, []interface{}) error { return nil })
+	if !errors.Is(err, common.ErrUnsupportedDialect) {
+		t.Errorf("expected unsupported dialect error, got %v", err)
+	}
+}
+
+// TestDequeueBatchConcurrent runs consumers against postgres, see postgresDSNEnv
+func TestDequeueBatchConcurrent(t *testing.T) {
+	dsn := requireDSN(t, postgresDSNEnv)
+	l, hook := test.NewNullLogger()
+	m, err := New(dsn, WithLogger(l), WithGormLogLevel(logger.Silent), WithAllowDestructive(true))
+	if err != nil {
+		t.Fatalf("can't connect to postgres: %v", err)
+	}
+	defer m.Close()
+	if err := m.DropTable(&queueJob{}); err != nil {
+		t.Fatalf("can't drop table: %v", err)
+	}
+	if err := m.Migrate(&queueJob{}); err != nil {
+		t.Fatalf("can't migrate table: %v", err)
+	}
+	const total = 100
+	jobs := make([]queueJob, total)
+	for i := range jobs {
+		jobs[i].Status = "new"
+	}
+	if err := m.Create(&jobs); err != nil {
+		t.Fatalf("can't create jobs: %v", err)
+	}
+
+	const consumers = 5
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		claimed = make(map[int]int)
+	)
+	for c := 1; c <= consumers; c++ {
+		wg.Add(1)
+		go func(consumer int) {
+			defer wg.Done()
+			for {
+				var batch []queueJob
+				err := m.Where("status = ?", "new").Order("id").DequeueBatch(&batch, 7, func(tx *Model, ids []interface{}) error {
+					return tx.Model(&queueJob{}).Where("id IN ?", ids).
+						Updates(map[string]interface{}{"status": "claimed", "claimer": consumer})
+				})
+				if err != nil {
+					t.Errorf("consumer %d can't dequeue: %v", consumer, err)
+					return
+				}
+				if len(batch) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, job := range batch {
+					claimed[job.ID]++
+				}
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	if len(claimed) != total {
+		t.Errorf("expected %d claimed jobs, got %d", total, len(claimed))
+	}
+	for id, count := range claimed {
+		if count != 1 {
+			t.Errorf("job %d is claimed %d times", id, count)
+		}
+	}
+	count, err := m.Model(&queueJob{}).Where("status = ?", "claimed").Count()
+	if err != nil {
+		t.Fatalf("can't count claimed jobs: %v", err)
+	}
+	if count != total {
+		t.Errorf("expected %d jobs marked claimed, got %d", total, count)
+	}
+	if entries := entriesAt(hook, logrus.ErrorLevel); len(entries) != 0 {
+		t.Errorf("unexpected error log %q", entries[0].Message)
+	}
+}
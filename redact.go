@@ -0,0 +1,321 @@
+package builder
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/xolodniy/pretty"
+	"gorm.io/gorm"
+)
+
+// redactedValue replaces values of sensitive fields in logs
+const redactedValue = "[REDACTED]"
+
+// print pretty prints value for logs, hiding sensitive fields and summarizing LogSummarizer values
+func (m *Model) print(value interface{}) string {
+	if value != nil && hasSummaries(reflect.TypeOf(value)) {
+		return m.printSummarized(reflect.ValueOf(value))
+	}
+	return pretty.Print(redact(value, m.cfg.redactedFields))
+}
+
+// deferredPrint is value stored in trace by chainers, it is pretty printed only when error is logged
+type deferredPrint struct {
+	value interface{}
+}
+
+// deferPrint snapshots value for printing it on failure, so chainers don't pay for printing on success
+func deferPrint(value interface{}) deferredPrint {
+	return deferredPrint{value: snapshot(value)}
+}
+
+// snapshot returns copy of value deep enough that later mutations by caller don't change logged value.
+// Values without references are copied by interface itself and slices of them are copied at once,
+// so only values holding pointers, slices or maps are copied by reflection
+func snapshot(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if args, ok := value.([]interface{}); ok {
+		cp := make([]interface{}, len(args))
+		for i, arg := range args {
+			cp[i] = snapshot(arg)
+		}
+		return cp
+	}
+	t := reflect.TypeOf(value)
+	if !hasReferences(t) {
+		return value
+	}
+	if t.Kind() == reflect.Slice && !hasReferences(t.Elem()) {
+		return copySlice(reflect.ValueOf(value)).Interface()
+	}
+	// copy is redacted by tags only, the rest is redacted on printing. Cycles of associations are cut by redact
+	return redact(value, nil)
+}
+
+// referenceTypes caches whether types have references, see hasReferences
+var referenceTypes sync.Map
+
+// hasReferences reports whether values of type refer by exported fields to memory which caller may mutate,
+// as pointers, slices, maps and interfaces do
+func hasReferences(t reflect.Type) bool {
+	if res, ok := referenceTypes.Load(t); ok {
+		return res.(bool)
+	}
+	res := findReferences(t)
+	referenceTypes.Store(t, res)
+	return res
+}
+
+func findReferences(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	case reflect.Array:
+		return findReferences(t.Elem())
+	case reflect.Struct:
+		// unexported fields aren't copied deeper by redact either
+		for i := 0; i < t.NumField(); i++ {
+			if field := t.Field(i); field.IsExported() && findReferences(field.Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// copySlice copies slice at once, nil slice stays nil
+func copySlice(v reflect.Value) reflect.Value {
+	if v.IsNil() {
+		return v
+	}
+	cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(cp, v)
+	return cp
+}
+
+// redact returns copy of value where fields tagged `log:"-"` and fields or map keys from denylist are hidden.
+// String fields are replaced by "[REDACTED]", fields of other types are zeroed, so they are omitted by pretty.
+// Pointers referring back to values being copied, like parent of child association, are left nil in copy,
+// since pretty doesn't detect cycles. Value itself is never mutated
+func redact(value interface{}, denylist map[string]struct{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	res := redactValue(reflect.ValueOf(value), denylist, make(map[visit]reflect.Value))
+	if !res.IsValid() || !res.CanInterface() {
+		return value
+	}
+	return res.Interface()
+}
+
+// visit is pointer or map copied by redactValue
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+// redactValue copies v for redact. Pointers and maps seen before are replaced by their copies,
+// so values shared by associations are copied once, and ones being copied are replaced by nil
+func redactValue(v reflect.Value, denylist map[string]struct{}, visited map[visit]reflect.Value) reflect.Value {
+	// summarized values are printed by LogSummary, so they aren't copied
+	if isSummarizer(v.Type()) {
+		return v
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		seen := visit{ptr: v.Pointer(), typ: v.Type()}
+		if cp, ok := visited[seen]; ok {
+			return cp
+		}
+		visited[seen] = reflect.Zero(v.Type())
+		cp := reflect.New(v.Type().Elem())
+		cp.Elem().Set(redactValue(v.Elem(), denylist, visited))
+		visited[seen] = cp
+		return cp
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(redactValue(v.Elem(), denylist, visited))
+		return cp
+	case reflect.Struct:
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if isRedacted(field, denylist) {
+				redactField(cp.Field(i))
+				continue
+			}
+			if isSummaryField(field) {
+				continue
+			}
+			cp.Field(i).Set(redactValue(v.Field(i), denylist, visited))
+		}
+		return cp
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		// elements like bytes or numbers have nothing to redact
+		if elem := v.Type().Elem(); elem.Kind() != reflect.Struct && elem.Kind() != reflect.Array && !hasReferences(elem) {
+			return copySlice(v)
+		}
+		cp := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(redactValue(v.Index(i), denylist, visited))
+		}
+		return cp
+	case reflect.Array:
+		cp := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			cp.Index(i).Set(redactValue(v.Index(i), denylist, visited))
+		}
+		return cp
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		seen := visit{ptr: v.Pointer(), typ: v.Type()}
+		if cp, ok := visited[seen]; ok {
+			return cp
+		}
+		visited[seen] = reflect.Zero(v.Type())
+		cp := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, value := iter.Key(), iter.Value()
+			if key.Kind() == reflect.String && isDenied(key.String(), denylist) {
+				redacted := reflect.New(v.Type().Elem()).Elem()
+				redactField(redacted)
+				cp.SetMapIndex(key, redacted)
+				continue
+			}
+			cp.SetMapIndex(key, redactValue(value, denylist, visited))
+		}
+		visited[seen] = cp
+		return cp
+	default:
+		return v
+	}
+}
+
+// isRedacted reports whether struct field is tagged `log:"-"` or named in denylist
+func isRedacted(field reflect.StructField, denylist map[string]struct{}) bool {
+	if field.Tag.Get("log") == "-" {
+		return true
+	}
+	if isDenied(field.Name, denylist) {
+		return true
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return name != "" && isDenied(name, denylist)
+}
+
+func isDenied(name string, denylist map[string]struct{}) bool {
+	_, ok := denylist[strings.ToLower(name)]
+	return ok
+}
+
+// redactField sets "[REDACTED]" to field which can hold string, zeroes it otherwise
+func redactField(v reflect.Value) {
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(redactedValue)
+	case v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.String:
+		s := reflect.New(v.Type().Elem())
+		s.Elem().SetString(redactedValue)
+		v.Set(s)
+	case v.Kind() == reflect.Interface && reflect.TypeOf(redactedValue).AssignableTo(v.Type()):
+		v.Set(reflect.ValueOf(redactedValue))
+	default:
+		v.Set(reflect.Zero(v.Type()))
+	}
+}
+
+// redactVars returns copy of sql vars where values of redacted fields of statement destination are hidden.
+// Vars don't refer to fields, so they are matched by values
+func redactVars(stmt *gorm.Statement, denylist map[string]struct{}) []interface{} {
+	secrets := make(map[interface{}]struct{})
+	visited := make(map[uintptr]bool)
+	collectSecrets(reflect.ValueOf(stmt.Dest), denylist, secrets, visited)
+	collectSecrets(reflect.ValueOf(stmt.Model), denylist, secrets, visited)
+	res := make([]interface{}, len(stmt.Vars))
+	for i, v := range stmt.Vars {
+		res[i] = v
+		if v == nil || !reflect.TypeOf(v).Comparable() {
+			continue
+		}
+		if _, ok := secrets[v]; ok {
+			res[i] = redactedValue
+		}
+	}
+	return res
+}
+
+// collectSecrets adds non-zero values of redacted fields and map keys of v to secrets,
+// looking into pointers, slices and nested structs. Pointers are visited once, so cyclic associations are fine
+func collectSecrets(v reflect.Value, denylist map[string]struct{}, secrets map[interface{}]struct{}, visited map[uintptr]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || visited[v.Pointer()] {
+			return
+		}
+		visited[v.Pointer()] = true
+		collectSecrets(v.Elem(), denylist, secrets, visited)
+	case reflect.Interface:
+		if !v.IsNil() {
+			collectSecrets(v.Elem(), denylist, secrets, visited)
+		}
+	case reflect.Slice, reflect.Array:
+		if elem := v.Type().Elem(); elem.Kind() != reflect.Struct && elem.Kind() != reflect.Ptr && elem.Kind() != reflect.Map {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			collectSecrets(v.Index(i), denylist, secrets, visited)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if isDenied(iter.Key().String(), denylist) {
+				addSecret(iter.Value(), secrets)
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if isRedacted(field, denylist) {
+				addSecret(v.Field(i), secrets)
+				continue
+			}
+			collectSecrets(v.Field(i), denylist, secrets, visited)
+		}
+	}
+}
+
+// addSecret adds dereferenced value to secrets, zero and not comparable values are skipped
+func addSecret(v reflect.Value, secrets map[interface{}]struct{}) {
+	for (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.IsZero() || !v.Type().Comparable() {
+		return
+	}
+	secrets[v.Interface()] = struct{}{}
+}
@@ -0,0 +1,281 @@
+package builder
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type snapshotNode struct {
+	ID    int
+	Name  string
+	Tags  []string `gorm:"-"`
+	Token string   `log:"-"`
+}
+
+func TestDeferredValuesAreSnapshots(t *testing.T) {
+	m, hook := newLoggedModel(t, nil)
+	ids := []int{1, 2}
+	name := []byte("before")
+	node := &snapshotNode{Name: "before", Tags: []string{"before"}, Token: "secret"}
+	c := m.Table("missing_table").Where("id IN ? AND name = ?", ids, name).Where(node)
+
+	ids[0] = 100
+	copy(name, "after!")
+	node.Name = "after"
+	node.Tags[0] = "after"
+
+	var dest []snapshotNode
+	if err := c.Find(&dest); err == nil {
+		t.Fatal("expected error of missing table")
+	}
+	entries := hook.AllEntries()
+	if len(entries) != 1 {
+		t.Fatalf("expected single log, got %d", len(entries))
+	}
+	logged := entries[0].Data
+	for _, key := range []string{"whereArgs0", "whereQuery1"} {
+		printed, _ := logged[key].(string)
+		if strings.Contains(printed, "after") || strings.Contains(printed, "100") {
+			t.Errorf("%s has mutation made after chainer: %s", key, printed)
+		}
+		if strings.Contains(printed, "secret") {
+			t.Errorf("%s has redacted field: %s", key, printed)
+		}
+	}
+	// bytes are printed as numbers, "b" of "before" is 98
+	if printed, _ := logged["whereArgs0"].(string); !strings.Contains(printed, "uint8{98}") {
+		t.Errorf("whereArgs0 has mutated bytes: %v", logged["whereArgs0"])
+	}
+	if printed, _ := logged["whereQuery1"].(string); !strings.Contains(printed, "before") {
+		t.Errorf("whereQuery1 is not printed: %v", logged["whereQuery1"])
+	}
+}
+
+func TestSnapshotKeepsValuesWithoutReferences(t *testing.T) {
+	type point struct{ X, Y int }
+	for _, value := range []interface{}{1, "name", point{1, 2}, [2]int{1, 2}} {
+		if got := snapshot(value); got != value {
+			t.Errorf("snapshot of %#v is %#v", value, got)
+		}
+	}
+	var nilSlice []int
+	if got := snapshot(nilSlice).([]int); got != nil {
+		t.Errorf("snapshot of nil slice is %#v", got)
+	}
+}
+
+// BenchmarkChain measures chainers of successful query, values are printed only for comparison
+// with eager printing which chainers did before values were deferred
+func BenchmarkChain(b *testing.B) {
+	m, _ := newLoggedModel(b, nil)
+	node := &snapshotNode{Name: "name", Tags: []string{"a", "b"}}
+	ids := []int{1, 2, 3, 4, 5}
+	chain := func() *Model {
+		return m.Model(&snapshotNode{}).
+			Select("id, name").
+			Where("id IN ?", ids).
+			Where(node).
+			Joins("LEFT JOIN snapshot_nodes AS parents ON parents.id = ?", 1).
+			Order("id DESC")
+	}
+
+	b.Run("deferred", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			chain()
+		}
+	})
+	b.Run("printed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			c := chain()
+			for _, e := range c.logTrace {
+				c.traceValue(e.Value)
+			}
+		}
+	})
+}
+
+type credentials struct {
+	Login    string
+	Password string
+	Token    *string `json:"api_token"`
+}
+
+type account struct {
+	ID       int
+	Hash     string `log:"-"`
+	Primary  credentials
+	Backup   *credentials
+	History  []credentials
+	Settings map[string]interface{}
+}
+
+func TestRedact(t *testing.T) {
+	token := "token-value"
+	value := &account{
+		Hash:     "hash-value",
+		Primary:  credentials{Login: "login", Password: "password-value", Token: &token},
+		Backup:   &credentials{Login: "backup", Password: "password-value"},
+		History:  []credentials{{Login: "old", Password: "password-value"}},
+		Settings: map[string]interface{}{"theme": "dark", "Password": "password-value"},
+	}
+	m := newTestModel(t, []Option{WithRedactedFields("password", "api_token")})
+	// pretty omits slices and maps nested in structs, so they are printed separately
+	printed := m.print(value) + m.print(value.History) + m.print(value.Settings)
+
+	for _, secret := range []string{"hash-value", "password-value", "token-value"} {
+		if strings.Contains(printed, secret) {
+			t.Errorf("%s is printed: %s", secret, printed)
+		}
+	}
+	for _, kept := range []string{"login", "backup", "old", "dark"} {
+		if !strings.Contains(printed, kept) {
+			t.Errorf("%s isn't printed: %s", kept, printed)
+		}
+	}
+
+	if value.Hash != "hash-value" || value.Primary.Password != "password-value" || *value.Primary.Token != "token-value" ||
+		value.Backup.Password != "password-value" || value.History[0].Password != "password-value" ||
+		value.Settings["Password"] != "password-value" {
+		t.Errorf("value is mutated by redaction: %+v", value)
+	}
+}
+
+type redactedUser struct {
+	ID       int
+	Name     string `gorm:"unique"`
+	Password string
+	Token    string `log:"-"`
+}
+
+func TestRedactedFieldsAreNotLogged(t *testing.T) {
+	m, hook := newLoggedModel(t, []Option{WithRedactedFields("password")}, &redactedUser{})
+	if err := m.Create(&redactedUser{Name: "a"}); err != nil {
+		t.Fatalf("can't create user: %v", err)
+	}
+	hook.Reset()
+
+	err := m.Where("name = ?", "a").Create(&redactedUser{Name: "a", Password: "password-value", Token: "token-value"})
+	if err == nil {
+		t.Fatal("expected duplicate error")
+	}
+	entries := hook.AllEntries()
+	if len(entries) == 0 {
+		t.Fatal("failure isn't logged")
+	}
+	for _, e := range entries {
+		for key, value := range e.Data {
+			printed := fmt.Sprint(value)
+			if strings.Contains(printed, "password-value") || strings.Contains(printed, "token-value") {
+				t.Errorf("secret is logged in %s: %s", key, printed)
+			}
+		}
+	}
+}
+
+func TestRedactVars(t *testing.T) {
+	denylist := map[string]struct{}{"password": {}}
+	stmt := &gorm.Statement{
+		Dest:  map[string]interface{}{"password": "password-value", "name": "a"},
+		Model: &redactedUser{Token: "token-value"},
+		Vars:  []interface{}{"a", "password-value", "token-value", 1, []int{1}},
+	}
+	got := redactVars(stmt, denylist)
+	want := []interface{}{"a", redactedValue, redactedValue, 1, []int{1}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected vars %v, got %v", want, got)
+	}
+	if stmt.Vars[1] != "password-value" {
+		t.Error("vars of statement are mutated")
+	}
+}
+
+type cyclicUser struct {
+	Password string
+	Friend   *cyclicUser
+}
+
+func TestRedactVarsOfCyclicValue(t *testing.T) {
+	u := &cyclicUser{Password: "password-value"}
+	u.Friend = u
+	stmt := &gorm.Statement{Dest: u, Vars: []interface{}{"password-value"}}
+	if got := redactVars(stmt, map[string]struct{}{"password": {}}); got[0] != redactedValue {
+		t.Errorf("secret isn't redacted: %v", got)
+	}
+}
+
+type treeNode struct {
+	ID       int
+	Name     string
+	Password string
+	ParentID *int
+	Parent   *treeNode
+	Kids     []*treeNode `gorm:"foreignKey:ParentID"`
+}
+
+// newTree returns parent with two kids referring back to it, kids share the same sibling
+func newTree() *treeNode {
+	parent := &treeNode{ID: 1, Name: "parent", Password: "password-value"}
+	shared := &treeNode{ID: 4, Name: "shared"}
+	for _, id := range []int{2, 3} {
+		parent.Kids = append(parent.Kids, &treeNode{ID: id, Name: "kid", Parent: parent, Kids: []*treeNode{shared}})
+	}
+	return parent
+}
+
+func TestRedactCyclicValue(t *testing.T) {
+	tree := newTree()
+	got := redact(tree, map[string]struct{}{"password": {}}).(*treeNode)
+	if got == tree || got.Kids[0] == tree.Kids[0] {
+		t.Fatal("value isn't copied")
+	}
+	if got.Password != redactedValue || tree.Password != "password-value" {
+		t.Errorf("password isn't redacted in copy: %+v", got)
+	}
+	if got.Kids[0].Parent != nil {
+		t.Error("cycle is kept in copy")
+	}
+	if got.Kids[0].Kids[0] != got.Kids[1].Kids[0] || got.Kids[0].Kids[0] == tree.Kids[0].Kids[0] {
+		t.Error("shared value isn't copied once")
+	}
+	if tree.Kids[0].Parent != tree {
+		t.Error("value is mutated by redaction")
+	}
+}
+
+func TestFailureOfCyclicValueIsLogged(t *testing.T) {
+	m, hook := newLoggedModel(t, []Option{WithRedactedFields("password")})
+	nodes := []*treeNode{newTree()}
+	if err := m.Table("missing_table").Find(&nodes); err == nil {
+		t.Fatal("expected error of missing table")
+	}
+	entries := entriesAt(hook, logrus.ErrorLevel)
+	if len(entries) != 1 {
+		t.Fatalf("expected single log, got %v", hook.AllEntries())
+	}
+	printed, _ := entries[0].Data["findOut"].(string)
+	if !strings.Contains(printed, "parent") || strings.Contains(printed, "password-value") {
+		t.Errorf("unexpected findOut %q", printed)
+	}
+}
+
+func TestSnapshotOfCyclicValue(t *testing.T) {
+	m := NewDryRun(dialectPostgres)
+	tree := newTree()
+	c := m.Model(tree).Where(tree)
+	for _, e := range c.logTrace {
+		snap, _ := e.Value.(deferredPrint)
+		if copied, ok := snap.value.(*treeNode); !ok || copied == tree || copied.Kids[0].Parent != nil {
+			t.Errorf("%s isn't snapshot of cyclic value: %#v", e.Key, e.Value)
+		}
+	}
+	var nodes []treeNode
+	if err := c.Find(&nodes); err != nil {
+		t.Fatalf("can't build query: %v", err)
+	}
+}
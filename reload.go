@@ -0,0 +1,61 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+)
+
+// Reload is gorm extension. Refreshes dest, which is pointer to struct like &User{}, from the database by its primary keys,
+// as example after Updates by gorm.Expr or triggers. Queued preloads are loaded, cache of chain is bypassed.
+// dest is overwritten only if row is found, deleted row is reported as common.ErrNotFound
+func (m *Model) Reload(dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		m.logError("queryBuilder.Reload called with destination which isn't pointer to struct", nil, logrus.Fields{
+			"reloadDest": fmt.Sprintf("%T", dest),
+			"trace":      m.frames(),
+		})
+		return fmt.Errorf("%w: reload destination %T isn't pointer to struct", common.ErrInternal, dest)
+	}
+	s, err := m.parseSchema(dest)
+	if err != nil {
+		return m.fail("reload", "can't parse schema of reloaded object", err, logrus.Fields{"trace": m.frames()})
+	}
+	if len(s.PrimaryFields) == 0 {
+		m.logError("queryBuilder.Reload called with model without primary key", nil, logrus.Fields{
+			"reloadModel": s.Name,
+			"trace":       m.frames(),
+		})
+		return fmt.Errorf("%w: %s has no primary key to reload by", common.ErrInternal, s.Name)
+	}
+
+	trace := m.logTrace.with("reloadDest", deferPrint(dest))
+	db := m.db
+	for _, field := range s.PrimaryFields {
+		value, zero := field.ValueOf(context.Background(), v.Elem())
+		if zero {
+			m.logError("queryBuilder.Reload called with zero primary key", nil, logrus.Fields{
+				"reloadModel":      s.Name,
+				"reloadPrimaryKey": field.Name,
+				"trace":            m.frames(),
+			})
+			return fmt.Errorf("%w: primary key %s of reloaded %s is zero", common.ErrInternal, field.Name, s.Name)
+		}
+		db = db.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: value})
+	}
+	c := m.chain(db, trace)
+	c.cacheTTL = 0
+
+	fresh := reflect.New(v.Elem().Type())
+	if err := c.First(fresh.Interface()); err != nil {
+		return err
+	}
+	v.Elem().Set(fresh.Elem())
+	return nil
+}
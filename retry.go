@@ -0,0 +1,75 @@
+package builder
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Retry reruns read finishers of chain (First, Last, Take, Find, Scan, Pluck and Count) up to attempts times in total
+// when they fail by broken connection, as example during failover of replica. Every next retry waits twice longer than backoff.
+// Mutations and queries inside transactions are never retried
+func (m *Model) Retry(attempts int, backoff time.Duration) *Model {
+	c := m.chain(m.db, m.logTrace)
+	c.retry = &RetryOptions{MaxAttempts: attempts, Backoff: backoff}
+	return c
+}
+
+// read runs query of read finisher, rerunning it according to Retry while it fails by broken connection.
+// run must build query from scratch, so every attempt gets fresh statement
+func (m *Model) read(name string, run func() *gorm.DB) *gorm.DB {
+	res := m.startQuery(name).done(run())
+	if m.retry == nil || m.tx != nil {
+		return res
+	}
+	backoff := m.retry.Backoff
+	for attempt := 1; attempt < m.retry.MaxAttempts && isConnectionError(res.Error); attempt++ {
+		m.logWarn("query failed by broken connection, retrying", res.Error, logrus.Fields{
+			"finisher":    name,
+			"attempt":     attempt,
+			"maxAttempts": m.retry.MaxAttempts,
+			"backoff":     backoff.String(),
+		})
+		select {
+		case <-m.db.Statement.Context.Done():
+			return res
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		res = m.startQuery(name).done(run())
+	}
+	return res
+}
+
+// isConnectionError reports whether err is caused by broken or refused connection rather than by query itself
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// class 08 is connection exception, 57P01 is termination of connection by administrator
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "57P01"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// pgx reports connection closed by server as plain text
+	msg := err.Error()
+	return strings.Contains(msg, "server closed the connection") || strings.Contains(msg, "connection reset by peer")
+}
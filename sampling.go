@@ -0,0 +1,98 @@
+package builder
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// samplerIdleReset is idle period after which occurrences of error are counted from scratch,
+	// so the first error of the next outage is logged in full
+	samplerIdleReset = time.Minute
+	// samplerMaxKeys limits count of tracked errors, idle ones are forgotten when limit is reached
+	samplerMaxKeys = 10000
+)
+
+// errorSampler decides which error logs are emitted when the same error repeats
+type errorSampler struct {
+	// every is period of compact counter logs of suppressed errors, 0 disables them
+	every int
+	// burst is count of full logs allowed per interval, 0 allows only the first one
+	burst    int
+	interval time.Duration
+
+	mu   sync.Mutex
+	keys map[string]*sampledError
+}
+
+// sampledError is state of single (message, error) pair
+type sampledError struct {
+	last time.Time
+	// tokens are full logs left in current interval, suppressed is count of errors since the last full log
+	tokens     float64
+	suppressed int
+}
+
+// sampleDecision is what should be logged for error occurrence
+type sampleDecision struct {
+	full       bool
+	compact    bool
+	suppressed int
+}
+
+// sample registers occurrence of error with given key
+func (s *errorSampler) sample(key string, now time.Time) sampleDecision {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keys == nil {
+		s.keys = make(map[string]*sampledError)
+	}
+	e, ok := s.keys[key]
+	if !ok || now.Sub(e.last) > samplerIdleReset {
+		if !ok && len(s.keys) >= samplerMaxKeys {
+			s.forgetIdle(now)
+		}
+		e = &sampledError{tokens: float64(s.burst)}
+		if s.burst == 0 {
+			e.tokens = 1
+		}
+		s.keys[key] = e
+	}
+	if s.burst > 0 && s.interval > 0 {
+		e.tokens += float64(s.burst) * float64(now.Sub(e.last)) / float64(s.interval)
+		if e.tokens > float64(s.burst) {
+			e.tokens = float64(s.burst)
+		}
+	}
+	e.last = now
+
+	if e.tokens >= 1 {
+		e.tokens--
+		d := sampleDecision{full: true, suppressed: e.suppressed}
+		e.suppressed = 0
+		return d
+	}
+	e.suppressed++
+	if s.every > 0 && e.suppressed%s.every == 0 {
+		return sampleDecision{compact: true, suppressed: e.suppressed}
+	}
+	return sampleDecision{}
+}
+
+// forgetIdle drops errors which are idle long enough to be counted from scratch anyway
+func (s *errorSampler) forgetIdle(now time.Time) {
+	for key, e := range s.keys {
+		if now.Sub(e.last) > samplerIdleReset {
+			delete(s.keys, key)
+		}
+	}
+}
+
+// Unsampled disables sampling of error logs for chain, so every failure is logged in full.
+// Useful for debugging particular query while sampling is configured
+func (m *Model) Unsampled() *Model {
+	c := m.chain(m.db, m.logTrace)
+	c.unsampled = true
+	return c
+}
@@ -0,0 +1,68 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// pgIdentifier matches unquoted postgres identifier
+var pgIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+// errSchemaRequired fails finishers of chains without Schema, see WithRequiredSchema
+var errSchemaRequired = errors.New("schema isn't set for chain, but WithRequiredSchema option requires it")
+
+// Schema runs queries of chain against postgres schema, as example schema of tenant.
+// Unlike other chainers, inside transaction Schema executes SET LOCAL of search_path right away rather than
+// on finisher, so it affects the rest of transaction, including chains without Schema and CopyFrom.
+// Failure of SET LOCAL is logged and aborts transaction as failure of any other query.
+// Outside transaction table of query and tables of preloads are qualified by schema, joined tables are left as is.
+// Invalid name fails finishers of chain
+func (m *Model) Schema(name string) *Model {
+	trace := m.logTrace.with("schema", name)
+	c := m.chain(m.db, trace)
+	c.schema = name
+	if !pgIdentifier.MatchString(name) {
+		return c.failed(fmt.Errorf("invalid schema name %q", name))
+	}
+	if err := m.requireDialect("Schema", dialectPostgres); err != nil {
+		return c.failed(err)
+	}
+	if m.tx == nil || m.tx.schema == name {
+		return c
+	}
+	if err := c.exec("SET LOCAL search_path TO " + c.db.Statement.Quote(name)); err != nil {
+		return c.failed(err)
+	}
+	m.tx.schema = name
+	return c
+}
+
+// requireSchema fails query of chain without Schema when WithRequiredSchema option is set,
+// chains of transaction with search_path set by Schema pass
+func requireSchema(db *gorm.DB, q *tracedQuery) {
+	if q.m.cfg.requireSchema && q.m.schema == "" && (q.m.tx == nil || q.m.tx.schema == "") {
+		_ = db.AddError(errSchemaRequired)
+	}
+}
+
+// qualifySchema prefixes table of query by schema of chain outside of transaction
+func qualifySchema(db *gorm.DB, q *tracedQuery) {
+	table := db.Statement.Table
+	if q.m.schema == "" || q.m.tx != nil || table == "" || strings.Contains(table, ".") {
+		return
+	}
+	qualified := q.m.schema + "." + table
+	if expr := db.Statement.TableExpr; expr != nil {
+		// tables set by Table are kept as quoted expression, aliases and subqueries are left as is
+		if expr.SQL != db.Statement.Quote(table) {
+			return
+		}
+		db.Statement.TableExpr = &clause.Expr{SQL: db.Statement.Quote(qualified)}
+	}
+	db.Statement.Table = qualified
+}
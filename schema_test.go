@@ -0,0 +1,48 @@
+package builder
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgconn"
+)
+
+func TestRequiredSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		required bool
+		sent     bool
+	}{
+		{"required", true, false},
+		{"not required", false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := &recordingTxConn{pgErr: &pgconn.PgError{Code: "XX000", Message: "internal error"}}
+			m, _ := newRecordingTxModel(t, conn, WithRequiredSchema(test.required))
+			var nodes []errorNode
+			err := m.Find(&nodes)
+			if test.required && !errors.Is(err, errSchemaRequired) {
+				t.Errorf("expected error of required schema, got %v", err)
+			}
+			if sent := len(conn.statements) > 0; sent != test.sent {
+				t.Errorf("expected sent query %v, got statements %q", test.sent, conn.statements)
+			}
+		})
+	}
+}
+
+func TestSchemaSetsSearchPathInTransaction(t *testing.T) {
+	conn := &recordingTxConn{}
+	m, _ := newRecordingTxModel(t, conn, WithRequiredSchema(true))
+	tx := m.Begin()
+	defer tx.RollBack()
+	// search_path is set by chainer itself, before any finisher
+	tx.Schema("tenant")
+	if len(conn.statements) != 1 || conn.statements[0] != `SET LOCAL search_path TO "tenant"` {
+		t.Errorf("unexpected statements: %q", conn.statements)
+	}
+	if tx.Schema("tenant"); len(conn.statements) != 1 {
+		t.Errorf("search_path is set twice: %q", conn.statements)
+	}
+}
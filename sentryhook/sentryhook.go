@@ -0,0 +1,89 @@
+// Package sentryhook reports failures of finishers to Sentry by builder.OnError, so importing Sentry stays optional
+package sentryhook
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	builder "gorm-logged"
+	"gorm-logged/common"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/sirupsen/logrus"
+)
+
+// contextName is name of Sentry context with logged fields of failure
+const contextName = "gorm-logged"
+
+// New returns hook reporting failures to hub, pass it to builder.OnError.
+// Event has calling frames of failure as stack trace, logged fields including trace of chain as context,
+// operation and fingerprint as tags, and is grouped by fingerprint. Fields are redacted by the builder
+// the same way as logged ones. Failures which logs are suppressed by sampling or Silent aren't reported
+func New(hub *sentry.Hub) builder.ErrorHook {
+	return func(op string, err error, fields logrus.Fields) {
+		if suppressed, _ := fields[builder.LogSuppressedField].(bool); suppressed || err == nil {
+			return
+		}
+		hub.CaptureEvent(event(op, err, fields))
+	}
+}
+
+// event converts failure into Sentry event
+func event(op string, err error, fields logrus.Fields) *sentry.Event {
+	e := sentry.NewEvent()
+	e.Level = sentry.LevelError
+	e.Message = err.Error()
+	e.Tags["operation"] = op
+
+	exception := sentry.Exception{Type: fmt.Sprintf("%T", err), Value: err.Error()}
+	extra := make(sentry.Context, len(fields))
+	for key, value := range fields {
+		switch v := value.(type) {
+		case common.LazyFrames:
+			if frames := v.Frames(); (key == "trace" || key == "execTrace") && len(frames) > 0 {
+				exception.Stacktrace = stacktrace(frames)
+				continue
+			}
+			extra[key] = v.String()
+		case error:
+			extra[key] = v.Error()
+		default:
+			extra[key] = v
+		}
+	}
+	if fingerprint, _ := fields["fingerprint"].(string); fingerprint != "" {
+		e.Tags["fingerprint"] = fingerprint
+		e.Fingerprint = []string{fingerprint}
+	}
+	e.Exception = []sentry.Exception{exception}
+	e.Contexts[contextName] = extra
+	return e
+}
+
+// stacktrace converts calling frames, which are innermost first, into Sentry stack trace, which is outermost first
+func stacktrace(frames []common.Frame) *sentry.Stacktrace {
+	res := make([]sentry.Frame, 0, len(frames))
+	for i := len(frames) - 1; i >= 0; i-- {
+		module, function := splitFunction(frames[i].Function)
+		res = append(res, sentry.Frame{
+			Function: function,
+			Module:   module,
+			Filename: filepath.Base(frames[i].File),
+			AbsPath:  frames[i].File,
+			Lineno:   frames[i].Line,
+			InApp:    true,
+		})
+	}
+	return &sentry.Stacktrace{Frames: res}
+}
+
+// splitFunction splits full name of function like "example.com/app/pkg.(*T).Method" into package and function
+func splitFunction(name string) (string, string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+1+dot+1:]
+}
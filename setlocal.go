@@ -0,0 +1,110 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+// settingName matches name of postgres setting, custom settings are prefixed like app.current_user_id
+var settingName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// SetLocal sets postgres setting by SET LOCAL till the end of transaction, as example statement_timeout
+// or custom setting for row level security. Durations are passed in milliseconds.
+// Active settings are logged by error logs of all chains of transaction
+func (m *Model) SetLocal(name string, value interface{}) error {
+	if m.tx == nil || m.tx.done {
+		m.logError("queryBuilder.SetLocal called outside of transaction", nil, logrus.Fields{
+			"settingName": name,
+			"trace":       m.frames(),
+		})
+		return common.ErrNoTransaction
+	}
+	if !settingName.MatchString(name) {
+		m.logError("queryBuilder.SetLocal called with invalid setting name", nil, logrus.Fields{
+			"settingName": name,
+			"trace":       m.frames(),
+		})
+		return common.ErrInternal
+	}
+	if err := m.requireDialect("SetLocal", dialectPostgres); err != nil {
+		return err
+	}
+	literal := settingValue(value)
+	if err := m.exec("SET LOCAL " + name + " TO " + pgLiteral(literal)); err != nil {
+		return err
+	}
+	m.tx.mu.Lock()
+	if m.tx.settings == nil {
+		m.tx.settings = make(map[string]string)
+	}
+	m.tx.settings[name] = literal
+	m.tx.mu.Unlock()
+	return nil
+}
+
+// AsUser runs fn in transaction with setting of acting user set to userID, so row level security policies
+// keyed off the setting apply to queries of fn. Setting is transaction local, so it never leaks to other
+// chains sharing pooled connection. Error logs of fn include actingUserID. Must be called outside of transaction
+func (m *Model) AsUser(ctx context.Context, userID string, fn func(tx *Model) error) error {
+	if m.InTransaction() {
+		m.logError("queryBuilder.AsUser called inside of transaction", nil, logrus.Fields{
+			"actingUserID": userID,
+			"trace":        m.frames(),
+		})
+		return common.ErrInternal
+	}
+	return m.WithContext(ctx).Transaction(func(tx *Model) error {
+		tx = tx.chain(tx.db, tx.logTrace.with("actingUserID", userID))
+		if err := tx.SetLocal(tx.cfg.userSetting, userID); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// settingValue formats value of setting, durations are converted to milliseconds
+func settingValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Duration:
+		return strconv.FormatInt(v.Milliseconds(), 10) + "ms"
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// activeSettings returns settings of transaction set by SetLocal like "name=value", nil outside of transaction
+func (s *txState) activeSettings() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.settings) == 0 {
+		return nil
+	}
+	settings := make([]string, 0, len(s.settings))
+	for name, value := range s.settings {
+		settings = append(settings, name+"="+value)
+	}
+	sort.Strings(settings)
+	return settings
+}
+
+// pgLiteral quotes s as postgres escape string literal, which doesn't depend on standard_conforming_strings
+func pgLiteral(s string) string {
+	s = strings.ReplaceAll(s, "\x00", "")
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `''`)
+	return "E'" + s + "'"
+}
@@ -0,0 +1,241 @@
+package builder
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm-logged/common"
+
+	"github.com/jackc/pgconn"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// recordingTxConn records statements and transactions of postgres model, queries fail with pgErr
+type recordingTxConn struct {
+	pgErr *pgconn.PgError
+
+	mu         sync.Mutex
+	statements []string
+	commits    int
+	rollbacks  int
+}
+
+func (c *recordingTxConn) record(query string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.statements = append(c.statements, query)
+}
+
+func (c *recordingTxConn) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	return c, nil
+}
+
+func (c *recordingTxConn) Commit() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commits++
+	return nil
+}
+
+func (c *recordingTxConn) Rollback() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rollbacks++
+	return nil
+}
+
+func (c *recordingTxConn) PrepareContext(_ context.Context, query string) (*sql.Stmt, error) {
+	c.record(query)
+	return nil, c.pgErr
+}
+
+func (c *recordingTxConn) ExecContext(_ context.Context, query string, _ ...interface{}) (sql.Result, error) {
+	c.record(query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c *recordingTxConn) QueryContext(_ context.Context, query string, _ ...interface{}) (*sql.Rows, error) {
+	c.record(query)
+	return nil, c.pgErr
+}
+
+func (c *recordingTxConn) QueryRowContext(_ context.Context, query string, _ ...interface{}) *sql.Row {
+	c.record(query)
+	return &sql.Row{}
+}
+
+// newRecordingTxModel builds postgres model over conn, logs are written to returned hook
+func newRecordingTxModel(t *testing.T, conn *recordingTxConn, opts ...Option) (*Model, *test.Hook) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{
+		Logger:               logger.Discard,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("can't open postgres model: %v", err)
+	}
+	l, hook := test.NewNullLogger()
+	m := NewFromDB(db, append([]Option{WithLogger(l)}, opts...)...)
+	return &m, hook
+}
+
+func TestAsUser(t *testing.T) {
+	conn := &recordingTxConn{pgErr: &pgconn.PgError{Code: "XX000", Message: "internal error"}}
+	m, _ := newRecordingTxModel(t, conn)
+
+	var inTx bool
+	err := m.AsUser(context.Background(), "o'neil", func(tx *Model) error {
+		inTx = tx.InTransaction()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("AsUser failed: %v", err)
+	}
+	if !inTx {
+		t.Error("fn isn't called with transaction")
+	}
+	if len(conn.statements) != 1 || conn.statements[0] != `SET LOCAL app.user_id TO E'o''neil'` {
+		t.Errorf("unexpected statements: %q", conn.statements)
+	}
+	if conn.commits != 1 || conn.rollbacks != 0 {
+		t.Errorf("expected single commit, got %d commits and %d rollbacks", conn.commits, conn.rollbacks)
+	}
+}
+
+func TestAsUserWithUserSetting(t *testing.T) {
+	conn := &recordingTxConn{}
+	m, _ := newRecordingTxModel(t, conn, WithUserSetting("rls.actor"))
+	if err := m.AsUser(context.Background(), "42", func(*Model) error { return nil }); err != nil {
+		t.Fatalf("AsUser failed: %v", err)
+	}
+	if len(conn.statements) != 1 || conn.statements[0] != `SET LOCAL rls.actor TO E'42'` {
+		t.Errorf("unexpected statements: %q", conn.statements)
+	}
+}
+
+func TestAsUserLogsActingUser(t *testing.T) {
+	conn := &recordingTxConn{pgErr: &pgconn.PgError{Code: "XX000", Message: "internal error"}}
+	m, hook := newRecordingTxModel(t, conn)
+
+	err := m.AsUser(context.Background(), "42", func(tx *Model) error {
+		var nodes []errorNode
+		return tx.Find(&nodes)
+	})
+	if !errors.Is(err, common.ErrInternal) {
+		t.Fatalf("expected internal error, got %v", err)
+	}
+	if conn.commits != 0 || conn.rollbacks != 1 {
+		t.Errorf("expected single rollback, got %d commits and %d rollbacks", conn.commits, conn.rollbacks)
+	}
+	entries := entriesAt(hook, logrus.ErrorLevel)
+	if len(entries) == 0 {
+		t.Fatal("failure isn't logged")
+	}
+	for _, entry := range entries {
+		if entry.Data["actingUserID"] != "42" {
+			t.Errorf("acting user isn't logged by %q: %v", entry.Message, entry.Data)
+		}
+		if settings, _ := entry.Data["txSettings"].([]string); len(settings) != 1 || settings[0] != "app.user_id=42" {
+			t.Errorf("setting isn't logged by %q: %v", entry.Message, entry.Data)
+		}
+	}
+}
+
+func TestAsUserInsideTransaction(t *testing.T) {
+	conn := &recordingTxConn{}
+	m, hook := newRecordingTxModel(t, conn)
+	err := m.Transaction(func(tx *Model) error {
+		return tx.AsUser(context.Background(), "42", func(*Model) error {
+			t.Error("fn is called inside of transaction")
+			return nil
+		})
+	})
+	if !errors.Is(err, common.ErrInternal) {
+		t.Errorf("expected internal error, got %v", err)
+	}
+	if len(entriesAt(hook, logrus.ErrorLevel)) == 0 {
+		t.Error("misuse isn't logged")
+	}
+}
+
+func TestSetLocalOutsideTransaction(t *testing.T) {
+	conn := &recordingTxConn{}
+	m, _ := newRecordingTxModel(t, conn)
+	if err := m.SetLocal("statement_timeout", "1s"); !errors.Is(err, common.ErrNoTransaction) {
+		t.Errorf("expected ErrNoTransaction, got %v", err)
+	}
+	if len(conn.statements) != 0 {
+		t.Errorf("setting is sent outside of transaction: %q", conn.statements)
+	}
+}
+
+func TestSetLocalRejectsInvalidName(t *testing.T) {
+	conn := &recordingTxConn{}
+	m, _ := newRecordingTxModel(t, conn)
+	err := m.Transaction(func(tx *Model) error {
+		return tx.SetLocal("app.user_id = 1; DROP TABLE users; --", "1")
+	})
+	if !errors.Is(err, common.ErrInternal) {
+		t.Errorf("expected internal error, got %v", err)
+	}
+	for _, statement := range conn.statements {
+		if strings.Contains(statement, "DROP") {
+			t.Errorf("invalid setting name is sent: %q", statement)
+		}
+	}
+}
+
+func TestPGLiteral(t *testing.T) {
+	tests := map[string]string{
+		"42":     `E'42'`,
+		"o'neil": `E'o''neil'`,
+		`a\b`:    `E'a\\b'`,
+		"a\x00b": `E'ab'`,
+		`\'; --`: `E'\\''; --'`,
+	}
+	for in, expected := range tests {
+		if got := pgLiteral(in); got != expected {
+			t.Errorf("pgLiteral(%q) = %s, expected %s", in, got, expected)
+		}
+	}
+}
+
+func TestAsUserSettingDoesNotLeak(t *testing.T) {
+	dsn := requireDSN(t, postgresDSNEnv)
+	m, err := New(dsn)
+	pg := closeOnCleanup(t, m, err)
+	sqlDB, err := pg.db.DB()
+	if err != nil {
+		t.Fatalf("can't get connection pool: %v", err)
+	}
+	// the same connection serves transaction and query after it
+	sqlDB.SetMaxOpenConns(1)
+
+	var inside sql.NullString
+	err = pg.AsUser(context.Background(), "42", func(tx *Model) error {
+		return tx.raw("SELECT current_setting('app.user_id', true)").Scan(&inside)
+	})
+	if err != nil {
+		t.Fatalf("AsUser failed: %v", err)
+	}
+	if inside.String != "42" {
+		t.Errorf("setting isn't set inside of transaction: %+v", inside)
+	}
+
+	var after sql.NullString
+	if err := pg.raw("SELECT current_setting('app.user_id', true)").Scan(&after); err != nil {
+		t.Fatalf("can't read setting: %v", err)
+	}
+	if after.String != "" {
+		t.Errorf("setting leaks after commit: %q", after.String)
+	}
+}
@@ -0,0 +1,67 @@
+package builder
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v4"
+	"gorm.io/gorm"
+)
+
+// simpleProtocolPool executes queries of pool by simple protocol of pgx.
+// Protocol of caller-owned pool can't be reconfigured, so it is requested by every query
+type simpleProtocolPool struct {
+	gorm.ConnPool
+}
+
+// simpleProtocolTx is transaction opened by simpleProtocolPool
+type simpleProtocolTx struct {
+	simpleProtocolPool
+	tx *sql.Tx
+}
+
+// simpleProtocolArgs prepends option of simple protocol to args of query
+func simpleProtocolArgs(args []interface{}) []interface{} {
+	return append([]interface{}{pgx.QuerySimpleProtocol(true)}, args...)
+}
+
+func (p *simpleProtocolPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.ConnPool.ExecContext(ctx, query, simpleProtocolArgs(args)...)
+}
+
+func (p *simpleProtocolPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.ConnPool.QueryContext(ctx, query, simpleProtocolArgs(args)...)
+}
+
+func (p *simpleProtocolPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.ConnPool.QueryRowContext(ctx, query, simpleProtocolArgs(args)...)
+}
+
+// BeginTx opens transaction of wrapped pool or connection, so queries of transaction use simple protocol as well
+func (p *simpleProtocolPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	beginner, ok := p.ConnPool.(gorm.TxBeginner)
+	if !ok {
+		return nil, gorm.ErrInvalidTransaction
+	}
+	tx, err := beginner.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &simpleProtocolTx{simpleProtocolPool: simpleProtocolPool{ConnPool: tx}, tx: tx}, nil
+}
+
+// GetDBConn returns wrapped pool, so gorm can still expose it by DB
+func (p *simpleProtocolPool) GetDBConn() (*sql.DB, error) {
+	if sqlDB, ok := p.ConnPool.(*sql.DB); ok {
+		return sqlDB, nil
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+func (t *simpleProtocolTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *simpleProtocolTx) Rollback() error {
+	return t.tx.Rollback()
+}
@@ -0,0 +1,73 @@
+// Package slackalert posts failure bursts detected by builder.WithFailureAlert into Slack incoming webhook
+package slackalert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	builder "gorm-logged"
+)
+
+// timeout limits posting of single alert
+const timeout = 10 * time.Second
+
+// New returns notifier posting summary into webhook, pass it to builder.WithFailureAlert.
+// Alerting is best effort, failures of posting are logged by standard logger
+func New(webhookURL string) func(summary builder.FailureSummary) {
+	client := &http.Client{Timeout: timeout}
+	return func(summary builder.FailureSummary) {
+		body, err := json.Marshal(map[string]string{"text": text(summary)})
+		if err != nil {
+			log.Printf("slackalert: can't marshal alert: %v", err)
+			return
+		}
+		resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Printf("slackalert: can't post alert: %v", err)
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Printf("slackalert: webhook responded %s", resp.Status)
+		}
+	}
+}
+
+// text formats summary as message
+func text(s builder.FailureSummary) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ":rotating_light: %d database failures within %s (%s - %s)\n",
+		s.Count, s.Window, s.First.Format(time.TimeOnly), s.Last.Format(time.TimeOnly))
+	writeCounts(&b, "By kind", s.ByKind)
+	writeCounts(&b, "By table", s.ByTable)
+	if len(s.Fingerprints) > 0 {
+		fmt.Fprintf(&b, "*Fingerprints:* `%s`\n", strings.Join(s.Fingerprints, "`, `"))
+	}
+	return b.String()
+}
+
+// writeCounts writes counts sorted from the largest
+func writeCounts(b *strings.Builder, title string, counts map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return counts[keys[i]] > counts[keys[j]] || counts[keys[i]] == counts[keys[j]] && keys[i] < keys[j]
+	})
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key == "" {
+			parts = append(parts, fmt.Sprintf("unknown: %d", counts[key]))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d", key, counts[key]))
+	}
+	fmt.Fprintf(b, "*%s:* %s\n", title, strings.Join(parts, ", "))
+}
@@ -0,0 +1,46 @@
+// Package sqlitedb opens builder.Model over sqlite, so cgo driver of sqlite stays optional
+package sqlitedb
+
+import (
+	"fmt"
+	"testing"
+
+	builder "gorm-logged"
+
+	"gorm.io/driver/sqlite"
+)
+
+// memory is path of in-memory database
+const memory = ":memory:"
+
+// New opens sqlite database by path, ":memory:" opens in-memory database.
+// In-memory database exists per connection, so its pool is limited to single connection
+func New(path string, opts ...builder.Option) (builder.Model, error) {
+	if path == memory {
+		opts = append(opts, builder.WithMaxOpenConns(1))
+	}
+	m, err := builder.NewWithDialector(sqlite.Open(path), opts...)
+	if err != nil {
+		return builder.Model{}, fmt.Errorf("can't open sqlite database: %w", err)
+	}
+	return m, nil
+}
+
+// NewTestModel opens in-memory sqlite database with migrated models for unit tests.
+// Destructive queries are allowed, database is closed by t.Cleanup at the end of test
+func NewTestModel(t testing.TB, models ...interface{}) *builder.Model {
+	t.Helper()
+	m, err := New(memory, builder.WithAllowDestructive(true))
+	if err != nil {
+		t.Fatalf("can't open test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := m.Close(); err != nil {
+			t.Errorf("can't close test database: %v", err)
+		}
+	})
+	if err := m.Migrate(models...); err != nil {
+		t.Fatalf("can't migrate test database: %v", err)
+	}
+	return &m
+}
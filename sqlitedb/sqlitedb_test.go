@@ -0,0 +1,37 @@
+package sqlitedb
+
+import (
+	"testing"
+
+	builder "gorm-logged"
+)
+
+type testNode struct {
+	ID   int
+	Name string
+}
+
+func TestNewTestModel(t *testing.T) {
+	m := NewTestModel(t, &testNode{})
+	if err := m.Create(&testNode{Name: "a"}); err != nil {
+		t.Fatalf("can't create node: %v", err)
+	}
+	var nodes []testNode
+	if err := m.Find(&nodes); err != nil {
+		t.Fatalf("can't find nodes: %v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Name != "a" {
+		t.Errorf("unexpected nodes %+v", nodes)
+	}
+}
+
+func TestNewLimitsPoolOfMemoryDatabase(t *testing.T) {
+	m, err := New(memory, builder.WithMaxOpenConns(10))
+	if err != nil {
+		t.Fatalf("can't open database: %v", err)
+	}
+	defer m.Close()
+	if max := m.Stats().MaxOpenConnections; max != 1 {
+		t.Errorf("in-memory database is opened with %d connections", max)
+	}
+}
@@ -0,0 +1,106 @@
+package builder
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// statsStartedAt is instance key of start time of query accounted into QueryStats
+const statsStartedAt = "gorm-logged:stats_started_at"
+
+// statsKey is context key of QueryStats
+type statsKey struct{}
+
+// QueryStats accumulates count and duration of queries run with context returned by WithQueryStats,
+// as example all queries of single http request. Safe for concurrent use
+type QueryStats struct {
+	mu         sync.Mutex
+	count      int
+	total      time.Duration
+	slowest    time.Duration
+	slowestSQL string
+}
+
+// WithQueryStats returns context, which accounts queries of chains with this context into returned QueryStats.
+// Queries of chains without it are not accounted at all
+func WithQueryStats(ctx context.Context) (context.Context, *QueryStats) {
+	stats := &QueryStats{}
+	return context.WithValue(ctx, statsKey{}, stats), stats
+}
+
+// Count returns count of accounted queries
+func (s *QueryStats) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Total returns total duration of accounted queries
+func (s *QueryStats) Total() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
+
+// Slowest returns sql and duration of the slowest accounted query
+func (s *QueryStats) Slowest() (string, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.slowestSQL, s.slowest
+}
+
+// Fields returns stats as log fields, as example for logging middleware
+func (s *QueryStats) Fields() logrus.Fields {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fields := logrus.Fields{
+		"queryCount":    s.count,
+		"queryDuration": s.total.String(),
+	}
+	if s.count > 0 {
+		sql := s.slowestSQL
+		if len(sql) > maxLoggedSQLLen {
+			sql = sql[:maxLoggedSQLLen] + "... (" + strconv.Itoa(len(sql)) + " bytes total)"
+		}
+		fields["slowestQuery"] = sql
+		fields["slowestQueryDuration"] = s.slowest.String()
+	}
+	return fields
+}
+
+// add accounts query
+func (s *QueryStats) add(sql string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count++
+	s.total += d
+	if s.count == 1 || d > s.slowest {
+		s.slowest = d
+		s.slowestSQL = sql
+	}
+}
+
+// statsBefore remembers start time of query, which context carries QueryStats
+func statsBefore(db *gorm.DB) {
+	if _, ok := db.Statement.Context.Value(statsKey{}).(*QueryStats); ok && !db.DryRun {
+		db.InstanceSet(statsStartedAt, time.Now())
+	}
+}
+
+// statsAfter accounts query into QueryStats of its context
+func statsAfter(db *gorm.DB) {
+	stats, ok := db.Statement.Context.Value(statsKey{}).(*QueryStats)
+	if !ok {
+		return
+	}
+	startedAt, ok := db.InstanceGet(statsStartedAt)
+	if !ok {
+		return
+	}
+	stats.add(db.Statement.SQL.String(), time.Since(startedAt.(time.Time)))
+}
@@ -0,0 +1,86 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+)
+
+// streamFlushRows is count of rows, after which streamed output is flushed
+const streamFlushRows = 100
+
+// StreamJSON is gorm extension. Writes records of chain into w as json array one by one, fetching them
+// by batches of FindEach, so the whole result is never loaded into memory. newElem returns pointer
+// to new record, as example func() interface{} { return &User{} }. Writers implementing http.Flusher or
+// Flush() error are flushed periodically. Returns count of written rows. Failed stream has no closing bracket,
+// so client can detect truncated output
+func (m *Model) StreamJSON(w io.Writer, newElem func() interface{}) (int64, error) {
+	elem := newElem()
+	if v := reflect.ValueOf(elem); v.Kind() != reflect.Ptr || v.IsNil() {
+		m.logError("queryBuilder.StreamJSON called with newElem which returns non pointer", nil, logrus.Fields{
+			"typeOfElem": fmt.Sprintf("%T", elem),
+			"trace":      m.frames(),
+		})
+		return 0, common.ErrInternal
+	}
+	if _, err := io.WriteString(w, "["); err != nil {
+		return 0, m.fail("streamJSON", "can't write json stream", err, logrus.Fields{"trace": m.frames()})
+	}
+
+	var (
+		n        int64
+		writeErr error
+	)
+	// failed query is logged by FindEach with offset of failed row
+	err := m.FindEach(elem, func() error {
+		data, err := json.Marshal(elem)
+		if err == nil && n > 0 {
+			_, err = io.WriteString(w, ",")
+		}
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		if err != nil {
+			writeErr = err
+			return err
+		}
+		n++
+		if n%streamFlushRows == 0 {
+			writeErr = flush(w)
+		}
+		return writeErr
+	})
+	if writeErr != nil {
+		return n, m.fail("streamJSON", "can't write row of json stream", writeErr, logrus.Fields{
+			"streamRowIndex": n,
+			"trace":          m.frames(),
+		})
+	}
+	if err != nil {
+		return n, err
+	}
+	if _, err := io.WriteString(w, "]"); err != nil {
+		return n, m.fail("streamJSON", "can't write json stream", err, logrus.Fields{"trace": m.frames()})
+	}
+	if err := flush(w); err != nil {
+		return n, m.fail("streamJSON", "can't flush json stream", err, logrus.Fields{"trace": m.frames()})
+	}
+	return n, nil
+}
+
+// flush flushes w, when it is http.Flusher or buffered writer
+func flush(w io.Writer) error {
+	switch f := w.(type) {
+	case http.Flusher:
+		f.Flush()
+	case interface{ Flush() error }:
+		return f.Flush()
+	}
+	return nil
+}
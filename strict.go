@@ -0,0 +1,86 @@
+package builder
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Strict makes First, Find and Scan of chain with Select or raw sql fail, when returned columns have no fields
+// in destination struct, instead of dropping their values silently. See WithStrict to enable it for all chains
+func (m *Model) Strict() *Model {
+	trace := m.logTrace.with("strict", true)
+	c := m.chain(m.db, trace)
+	c.strict = true
+	return c
+}
+
+// checkStrict verifies that columns of query of finisher op have fields in dest struct for strict chains.
+// query builds the same query as finisher does, its columns are read by extra query without rows
+func (m *Model) checkStrict(op string, dest interface{}, query func(db *gorm.DB) *gorm.DB) error {
+	if !m.strict && !m.cfg.strict {
+		return nil
+	}
+	_, selected := m.db.Statement.Clauses["SELECT"]
+	if !selected && len(m.db.Statement.Selects) == 0 && m.db.Statement.SQL.Len() == 0 {
+		return nil
+	}
+	t := reflect.TypeOf(dest)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	s, err := m.parseSchema(reflect.New(t).Interface())
+	if err != nil {
+		return m.fail(op, "can't parse schema of strict destination", err, logrus.Fields{"trace": m.frames()})
+	}
+
+	// sql of raw chains is built already, other chains are built in dry run mode
+	db := m.db
+	if db.Statement.SQL.Len() == 0 {
+		db = query(m.db.Session(&gorm.Session{DryRun: true}))
+		if db.Error != nil {
+			return m.fail(op, "can't build query of strict chain", db.Error, logrus.Fields{"trace": m.frames()})
+		}
+	}
+	sql := "SELECT * FROM (" + db.Statement.SQL.String() + ") AS gorm_logged_strict LIMIT 0"
+	rows, err := db.Statement.ConnPool.QueryContext(db.Statement.Context, sql, db.Statement.Vars...)
+	if err != nil {
+		return m.fail(op, "can't get columns of strict chain", err, logrus.Fields{
+			"sql":   sql,
+			"trace": m.frames(),
+		})
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return m.fail(op, "can't get columns of strict chain", err, logrus.Fields{"trace": m.frames()})
+	}
+
+	var orphans []string
+	for _, column := range columns {
+		// columns of joined associations are named like Author__name
+		if strings.Contains(column, "__") {
+			continue
+		}
+		if field := s.LookUpField(column); field == nil || field.DBName == "" {
+			orphans = append(orphans, column)
+		}
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+	m.logError("strict chain selects columns which have no fields in destination", nil, logrus.Fields{
+		"strictDest":      s.Name,
+		"orphanedColumns": orphans,
+		"trace":           m.frames(),
+	})
+	return fmt.Errorf("%w: columns %v have no fields in %s", common.ErrInternal, orphans, s.Name)
+}
@@ -0,0 +1,51 @@
+package builder
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// default limits of summarize, see WithLoggedCollectionLimit and WithLoggedStringLimit
+const (
+	defaultLoggedMaxElements  = 100
+	defaultLoggedHeadElements = 5
+	defaultLoggedMaxStringLen = 1024
+)
+
+// summarize pretty prints value for logs like print does, but large values are summarized:
+// slices and maps over the limit are printed as type, length and the first elements,
+// strings and byte slices over the limit are printed as length and prefix
+func (m *Model) summarize(value interface{}) string {
+	v := reflect.ValueOf(value)
+	var ptr string
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+		ptr += "*"
+	}
+
+	head := min(m.cfg.loggedHeadElements, m.cfg.loggedMaxElements)
+	switch {
+	case v.Kind() == reflect.String && v.Len() > m.cfg.loggedMaxStringLen:
+		return fmt.Sprintf("%s%s(len %d){'%s...'}", ptr, v.Type(), v.Len(), v.String()[:m.cfg.loggedMaxStringLen])
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 && v.Len() > m.cfg.loggedMaxStringLen:
+		return fmt.Sprintf("%s%s(len %d){%q...}", ptr, v.Type(), v.Len(), v.Bytes()[:m.cfg.loggedMaxStringLen])
+	case (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Len() > m.cfg.loggedMaxElements:
+		elems := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), head, head)
+		reflect.Copy(elems, v)
+		return fmt.Sprintf("%s%s(len %d, first %d): %s", ptr, v.Type(), v.Len(), head, m.print(elems.Interface()))
+	case v.Kind() == reflect.Map && v.Len() > m.cfg.loggedMaxElements:
+		keys := v.MapKeys()
+		// map order is random, sorting keeps the same elements in logs of the same value
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		elems := reflect.MakeMapWithSize(v.Type(), head)
+		for _, key := range keys[:head] {
+			elems.SetMapIndex(key, v.MapIndex(key))
+		}
+		return fmt.Sprintf("%s%s(len %d, first %d): %s", ptr, v.Type(), v.Len(), head, m.print(elems.Interface()))
+	default:
+		return m.print(value)
+	}
+}
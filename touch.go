@@ -0,0 +1,76 @@
+package builder
+
+import (
+	"context"
+	"reflect"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Touch is gorm extension. Sets columns of model, which is pointer to struct like &User{ID: id}, to current time
+// of database server, UpdatedAt field by default. columns are names of struct fields or columns.
+// Row is found by primary key of model or by filter of chain. Other columns and hooks aren't touched.
+// Returns common.ErrNotFound when no rows are updated
+func (m *Model) Touch(model interface{}, columns ...string) error {
+	if len(columns) == 0 {
+		columns = []string{"UpdatedAt"}
+	}
+	logFields := logrus.Fields{
+		"touchModel":   m.summarize(model),
+		"touchColumns": columns,
+	}
+	s, err := m.parseSchema(model)
+	if err != nil {
+		return m.fail("touch", "can't parse touched model", err, logFields, logrus.Fields{"trace": m.frames()})
+	}
+	values := make(map[string]interface{}, len(columns))
+	var unknown []string
+	for _, name := range columns {
+		field := s.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			unknown = append(unknown, name)
+			continue
+		}
+		values[field.DBName] = gorm.Expr("CURRENT_TIMESTAMP")
+	}
+	if len(unknown) > 0 {
+		m.logError("queryBuilder.Touch called with fields which don't exist on model", nil, logFields,
+			logrus.Fields{"unknownTouchColumns": unknown, "trace": m.frames()})
+		return common.ErrInternal
+	}
+	if !hasPrimaryKey(s.PrimaryFields, model) && m.db.Statement.Clauses["WHERE"].Expression == nil {
+		m.logError("queryBuilder.Touch called without primary key and filter", nil, logFields,
+			logrus.Fields{"trace": m.frames()})
+		return common.ErrInternal
+	}
+
+	q := m.startQuery("touch")
+	res := q.done(m.applyPreloads().db.Model(model).UpdateColumns(values))
+	if err := res.Error; err != nil {
+		m.tx.remember(err)
+		return m.fail("touch", "can't touch object in database", err, m.sqlFields(res), logFields,
+			logrus.Fields{"trace": m.frames()})
+	}
+	if res.RowsAffected == 0 {
+		return m.notFound(model, res)
+	}
+	return nil
+}
+
+// hasPrimaryKey reports whether model has all primary keys set
+func hasPrimaryKey(primaryFields []*schema.Field, model interface{}) bool {
+	v := reflect.Indirect(reflect.ValueOf(model))
+	if len(primaryFields) == 0 || v.Kind() != reflect.Struct {
+		return false
+	}
+	for _, field := range primaryFields {
+		if _, zero := field.ValueOf(context.Background(), v); zero {
+			return false
+		}
+	}
+	return true
+}
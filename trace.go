@@ -0,0 +1,43 @@
+package builder
+
+import "strconv"
+
+// TraceEntry is single value recorded by chainer, see WithOrderedTrace
+type TraceEntry struct {
+	// Index is position of entry in trace of chain
+	Index int         `json:"index"`
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// chainTrace is append-only trace of chain, entries are kept in order of chainer calls.
+// Chains derived from the same model share entries of the model, but never see entries of each other
+type chainTrace []TraceEntry
+
+// with returns trace with appended entry, receiver is never modified
+func (t chainTrace) with(key string, value interface{}) chainTrace {
+	n := len(t)
+	// capacity is cut, so append copies entries instead of writing into array shared with sibling chains
+	return append(t[:n:n], TraceEntry{Index: n, Key: key, Value: value})
+}
+
+// freeIndex returns the first index which is not used yet with key in trace.
+// Allows to log every call of chainer which can be called several times
+func (t chainTrace) freeIndex(key string) string {
+	var i int
+	for {
+		if !t.has(key + strconv.Itoa(i)) {
+			return strconv.Itoa(i)
+		}
+		i++
+	}
+}
+
+func (t chainTrace) has(key string) bool {
+	for _, e := range t {
+		if e.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package builder
+
+import "gorm.io/gorm/clause"
+
+// WhereSimilar is gorm extension. Matches column by trigram similarity to term above threshold,
+// requires pg_trgm extension
+func (m *Model) WhereSimilar(column, term string, threshold float64) *Model {
+	trace := m.logTrace
+	i := trace.freeIndex("similarColumn")
+	trace = trace.with("similarColumn"+i, column).with("similarTerm"+i, term).with("similarThreshold"+i, threshold)
+	if err := m.requireDialect("WhereSimilar", dialectPostgres); err != nil {
+		return m.chain(m.db, trace).failed(err)
+	}
+	return m.chain(m.db.Where(clause.Expr{
+		SQL:  "similarity(?, ?) > ?",
+		Vars: []interface{}{clause.Column{Name: column}, term, threshold},
+	}), trace)
+}
+
+// OrderBySimilarity is gorm extension. Orders chain by trigram similarity of column to term,
+// the most similar rows first. Requires pg_trgm extension
+func (m *Model) OrderBySimilarity(column, term string) *Model {
+	trace := m.logTrace
+	i := trace.freeIndex("similarityOrderColumn")
+	trace = trace.with("similarityOrderColumn"+i, column).with("similarityOrderTerm"+i, term)
+	if err := m.requireDialect("OrderBySimilarity", dialectPostgres); err != nil {
+		return m.chain(m.db, trace).failed(err)
+	}
+	return m.chain(addOrder(m.db, clause.OrderBy{Expression: clause.Expr{
+		SQL:  "similarity(?, ?) DESC",
+		Vars: []interface{}{clause.Column{Name: column}, term},
+	}}), trace)
+}
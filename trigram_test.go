@@ -0,0 +1,28 @@
+package builder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type tag struct {
+	ID   int
+	Name string
+}
+
+func TestOrderBySimilarityBindsTerm(t *testing.T) {
+	m := NewDryRun(dialectPostgres)
+	term := `o'neil\`
+	var dest []tag
+	if err := m.WhereSimilar("name", term, 0.3).OrderBySimilarity("name", term).Order("id").Find(&dest); err != nil {
+		t.Fatalf("can't build query: %v", err)
+	}
+	sql, vars := m.LastSQL()
+	if !strings.HasSuffix(sql, `WHERE similarity("name", $1) > $2 ORDER BY similarity("name", $3) DESC,id`) {
+		t.Fatalf("unexpected sql %s", sql)
+	}
+	if !reflect.DeepEqual(vars, []interface{}{term, 0.3, term}) {
+		t.Fatalf("expected term bound as is, got %v", vars)
+	}
+}
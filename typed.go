@@ -0,0 +1,52 @@
+package builder
+
+import (
+	"reflect"
+)
+
+// First is typed version of Model.First, returns found object instead of filling out param.
+// T can be both struct and pointer to struct:
+//
+//	user, err := builder.First[User](m.Where("id = ?", id))
+func First[T any](m *Model, where ...interface{}) (T, error) {
+	out, dest := newTyped[T]()
+	if err := withTypedModel[T](m).First(dest, where...); err != nil {
+		var zero T
+		return zero, err
+	}
+	return *out, nil
+}
+
+// FindAll is typed version of Model.Find, returns found objects instead of filling out param
+//
+//	users, err := builder.FindAll[User](m.Where("active"))
+func FindAll[T any](m *Model, where ...interface{}) ([]T, error) {
+	var out []T
+	if err := withTypedModel[T](m).Find(&out, where...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// newTyped allocates value of type T and returns it with destination suitable for gorm.
+// For pointer types the pointed struct is allocated as well, so gorm doesn't get nil pointer
+func newTyped[T any]() (*T, interface{}) {
+	out := new(T)
+	if t := reflect.TypeOf(out).Elem(); t.Kind() == reflect.Ptr {
+		reflect.ValueOf(out).Elem().Set(reflect.New(t.Elem()))
+		return out, *out
+	}
+	return out, out
+}
+
+// withTypedModel sets model of chain to T, if chain has neither model nor table
+func withTypedModel[T any](m *Model) *Model {
+	if m.db.Statement.Model != nil || m.db.Statement.Table != "" {
+		return m
+	}
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return m.Model(reflect.New(t).Interface())
+}
@@ -0,0 +1,73 @@
+package builder
+
+import (
+	"errors"
+	"testing"
+
+	"gorm-logged/common"
+)
+
+func TestFirstTyped(t *testing.T) {
+	m := newTestModel(t, nil, &conformanceNode{})
+	createNodes(t, m, "a", "b")
+
+	node, err := First[conformanceNode](m.Where("name = ?", "b"))
+	if err != nil {
+		t.Fatalf("can't find node: %v", err)
+	}
+	if node.Name != "b" {
+		t.Errorf("expected node b, got %+v", node)
+	}
+
+	ptr, err := First[*conformanceNode](m, "name = ?", "a")
+	if err != nil {
+		t.Fatalf("can't find node by pointer type: %v", err)
+	}
+	if ptr == nil || ptr.Name != "a" {
+		t.Errorf("expected node a, got %+v", ptr)
+	}
+}
+
+func TestFirstTypedNotFound(t *testing.T) {
+	m := newTestModel(t, nil, &conformanceNode{})
+	createNodes(t, m, "a", "b")
+	ptr, err := First[*conformanceNode](m.Where("name = ?", "missing"))
+	if !errors.Is(err, common.ErrNotFound) {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	if ptr != nil {
+		t.Errorf("expected nil for not found, got %+v", ptr)
+	}
+}
+
+func TestFindAllTyped(t *testing.T) {
+	m := newTestModel(t, nil, &conformanceNode{})
+	createNodes(t, m, "a", "b")
+
+	nodes, err := FindAll[conformanceNode](m.Order("name DESC"))
+	if err != nil {
+		t.Fatalf("can't find nodes: %v", err)
+	}
+	if len(nodes) != 2 || nodes[0].Name != "b" || nodes[1].Name != "a" {
+		t.Errorf("unexpected nodes %+v", nodes)
+	}
+
+	ptrs, err := FindAll[*conformanceNode](m, "name = ?", "a")
+	if err != nil {
+		t.Fatalf("can't find nodes by pointer type: %v", err)
+	}
+	if len(ptrs) != 1 || ptrs[0].Name != "a" {
+		t.Errorf("unexpected nodes %+v", ptrs)
+	}
+}
+
+func TestWithTypedModel(t *testing.T) {
+	m := newTestModel(t, nil)
+	if _, ok := withTypedModel[*conformanceNode](m).db.Statement.Model.(*conformanceNode); !ok {
+		t.Error("model isn't set for chain without model")
+	}
+	c := m.Table("other_nodes")
+	if withTypedModel[conformanceNode](c).db.Statement.Model != nil {
+		t.Error("model is set for chain with table")
+	}
+}
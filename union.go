@@ -0,0 +1,104 @@
+package builder
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// unionTable is alias of derived table of Union, columns of result are referenced without it
+const unionTable = "gorm_logged_union"
+
+// Union is gorm extension. Combines rows of chain and other by UNION into derived table, so the result can be
+// ordered, limited and found like table, as example m.Where(...).Union(m.Where(...)).Order("created_at DESC").Find(&feed).
+// Both chains have to select the same columns, count of explicitly selected columns is checked before query.
+// Traces of chains are kept with prefixes "unionLeft-" and "unionRight-"
+func (m *Model) Union(other *Model) *Model {
+	return m.union("UNION", other)
+}
+
+// UnionAll is gorm extension. Works as Union, but keeps duplicate rows
+func (m *Model) UnionAll(other *Model) *Model {
+	return m.union("UNION ALL", other)
+}
+
+// union combines chain and other by operator into derived table
+func (m *Model) union(operator string, other *Model) *Model {
+	trace := unionTrace(nil, m.logTrace, "unionLeft-").with("unionOperator", operator)
+	if other == nil {
+		return m.chain(m.db, trace).failed(errors.New("union with nil chain"))
+	}
+	trace = unionTrace(trace, other.logTrace, "unionRight-")
+
+	left, leftOK := selectedColumns(m.db.Statement)
+	right, rightOK := selectedColumns(other.db.Statement)
+	if leftOK && rightOK && left != right {
+		return m.chain(m.db, trace).failed(fmt.Errorf("%s of chains selecting %d and %d columns", operator, left, right))
+	}
+
+	sql := fmt.Sprintf("(SELECT * FROM (?) AS %[1]s_left %[2]s SELECT * FROM (?) AS %[1]s_right) AS %[1]s", unionTable, operator)
+	db := m.db.Session(&gorm.Session{NewDB: true}).Table(sql, m.db, other.db)
+	return m.chain(db, trace)
+}
+
+// unionTrace appends entries of trace to res with keys prefixed, fields of WithLogFields keep their keys
+func unionTrace(res, trace chainTrace, prefix string) chainTrace {
+	for _, e := range trace {
+		key := e.Key
+		if !strings.HasPrefix(key, logFieldPrefix) {
+			key = prefix + key
+		}
+		res = res.with(key, e.Value)
+	}
+	return res
+}
+
+// selectedColumns counts columns explicitly selected by statement, false if they can't be counted,
+// as example for select of all columns
+func selectedColumns(stmt *gorm.Statement) (int, bool) {
+	if c, ok := stmt.Clauses["SELECT"]; ok {
+		if s, ok := c.Expression.(clause.Select); ok && s.Expression == nil && len(s.Columns) > 0 {
+			return len(s.Columns), true
+		}
+	}
+	if len(stmt.Selects) == 0 {
+		return 0, false
+	}
+	count := 0
+	for _, column := range stmt.Selects {
+		if strings.Contains(column, "*") {
+			return 0, false
+		}
+		count += topLevelCommas(column) + 1
+	}
+	return count, true
+}
+
+// topLevelCommas counts commas of expression outside of parentheses and quotes
+func topLevelCommas(expr string) int {
+	var (
+		count int
+		depth int
+		quote rune
+	)
+	for _, r := range expr {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,183 @@
+package builder
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sort"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// UpdatesWithNulls is gorm extension. Works as Updates with struct, but sets nullFields to NULL even though
+// they are zero values. Pointer and sql.Null* fields are updated when set, as with Updates.
+// nullFields are names of struct fields or columns, unknown ones fail the update before query
+func (m *Model) UpdatesWithNulls(attrs interface{}, nullFields ...string) error {
+	logFields := logrus.Fields{
+		"updateAttrs":      m.summarize(attrs),
+		"updateNullFields": nullFields,
+	}
+	s, err := m.parseSchema(attrs)
+	if err != nil {
+		return m.fail("updatesWithNulls", "can't parse updated struct", err, logFields,
+			logrus.Fields{"trace": m.frames()})
+	}
+	var unknown []string
+	for _, name := range nullFields {
+		if field := s.LookUpField(name); field == nil || field.DBName == "" {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		m.logError("queryBuilder.UpdatesWithNulls called with fields which don't exist on struct", nil, logFields,
+			logrus.Fields{"unknownNullFields": unknown, "trace": m.frames()})
+		return common.ErrInternal
+	}
+
+	values := updatedColumns(s, reflect.Indirect(reflect.ValueOf(attrs)))
+	for _, name := range nullFields {
+		values[s.LookUpField(name).DBName] = nil
+	}
+	q := m.startQuery("updatesWithNulls")
+	res := q.done(m.updatedModel(attrs).Updates(values))
+	if err := res.Error; err != nil {
+		m.tx.remember(err)
+		return m.fail("updatesWithNulls", "can't update object in database", err, m.sqlFields(res), logFields,
+			logrus.Fields{"trace": m.frames()})
+	}
+	return nil
+}
+
+// parseSchema parses schema of model according to naming strategy of database
+func (m *Model) parseSchema(model interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: m.db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// updatedModel returns gorm instance of chain, which updates attrs itself when chain has no Model
+func (m *Model) updatedModel(attrs interface{}) *gorm.DB {
+	db := m.applyPreloads().db
+	if db.Statement.Model == nil {
+		db = db.Model(attrs)
+	}
+	return db
+}
+
+// updatedColumns converts struct to column to value map as Updates does, skipping primary keys and zero values
+func updatedColumns(s *schema.Schema, v reflect.Value) map[string]interface{} {
+	values := make(map[string]interface{}, len(s.Fields))
+	for _, field := range s.Fields {
+		if field.DBName == "" || field.PrimaryKey || !field.Updatable {
+			continue
+		}
+		if value, zero := field.ValueOf(context.Background(), v); !zero {
+			values[field.DBName] = value
+		}
+	}
+	return values
+}
+
+// UpdatesAll is gorm extension. Updates only columns of includeFields by attrs struct, zero values included,
+// all updatable fields except primary keys and creation times by default. Non zero fields of attrs which aren't
+// in includeFields are not written, they are listed in debug log. includeFields are names of struct fields
+// or columns, unknown ones fail the update before query. Chain must be filtered by Where or by primary key of attrs
+// or Model, so zero values can't overwrite the whole table
+func (m *Model) UpdatesAll(attrs interface{}, includeFields ...string) error {
+	logFields := logrus.Fields{
+		"updateAttrs":         m.summarize(attrs),
+		"updateIncludeFields": includeFields,
+	}
+	s, err := m.parseSchema(attrs)
+	if err != nil {
+		return m.fail("updatesAll", "can't parse updated struct", err, logFields,
+			logrus.Fields{"trace": m.frames()})
+	}
+	db := m.updatedModel(attrs)
+	if !m.filtered(db, s, attrs) {
+		m.logError("queryBuilder.UpdatesAll called without Where and primary key", nil, logFields,
+			logrus.Fields{"trace": m.frames()})
+		return common.ErrInternal
+	}
+
+	var (
+		columns []string
+		unknown []string
+	)
+	for _, name := range includeFields {
+		field := s.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			unknown = append(unknown, name)
+			continue
+		}
+		columns = append(columns, field.DBName)
+	}
+	if len(unknown) > 0 {
+		m.logError("queryBuilder.UpdatesAll called with fields which don't exist on struct", nil, logFields,
+			logrus.Fields{"unknownIncludeFields": unknown, "trace": m.frames()})
+		return common.ErrInternal
+	}
+	if len(includeFields) == 0 {
+		for _, field := range s.Fields {
+			if field.DBName != "" && !field.PrimaryKey && field.Updatable && field.AutoCreateTime == 0 {
+				columns = append(columns, field.DBName)
+			}
+		}
+	}
+	logFields["updateIncludedColumns"] = columns
+	if skipped := skippedColumns(s, attrs, columns); len(skipped) > 0 {
+		logFields["updateSkippedColumns"] = skipped
+	}
+
+	q := m.startQuery("updatesAll")
+	res := q.done(db.Select(columns).Updates(attrs))
+	if err := res.Error; err != nil {
+		m.tx.remember(err)
+		return m.fail("updatesAll", "can't update object in database", err, m.sqlFields(res), logFields,
+			logrus.Fields{"trace": m.frames()})
+	}
+	m.logDebug("zero values are included into update", nil, logFields)
+	return nil
+}
+
+// skippedColumns returns sorted columns of non zero fields of attrs struct which aren't written as not selected
+func skippedColumns(s *schema.Schema, attrs interface{}, selected []string) []string {
+	v := reflect.Indirect(reflect.ValueOf(attrs))
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	var skipped []string
+	for column := range updatedColumns(s, v) {
+		if !slices.Contains(selected, column) {
+			skipped = append(skipped, column)
+		}
+	}
+	sort.Strings(skipped)
+	return skipped
+}
+
+// filtered reports whether update of db is limited by where conditions or by primary key of attrs or of model
+func (m *Model) filtered(db *gorm.DB, s *schema.Schema, attrs interface{}) bool {
+	if _, ok := db.Statement.Clauses["WHERE"]; ok {
+		return true
+	}
+	if s.PrioritizedPrimaryField == nil {
+		return false
+	}
+	for _, value := range []interface{}{attrs, db.Statement.Model} {
+		v := reflect.Indirect(reflect.ValueOf(value))
+		if v.Kind() != reflect.Struct || v.Type() != s.ModelType {
+			continue
+		}
+		if _, zero := s.PrioritizedPrimaryField.ValueOf(context.Background(), v); !zero {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package builder
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+type profile struct {
+	ID     int
+	Name   string
+	Bio    string
+	Rating int
+}
+
+func TestUpdatesAllWritesSelectedColumnsOnly(t *testing.T) {
+	m, hook := newLoggedModel(t, nil, &profile{})
+	if err := m.Create(&profile{Name: "old", Bio: "bio", Rating: 5}); err != nil {
+		t.Fatalf("can't create profile: %v", err)
+	}
+
+	if err := m.UpdatesAll(&profile{ID: 1, Name: "new", Bio: "", Rating: 7}, "Bio"); err != nil {
+		t.Fatalf("can't update profile: %v", err)
+	}
+	var got profile
+	if err := m.Where("id = ?", 1).First(&got); err != nil {
+		t.Fatalf("can't find profile: %v", err)
+	}
+	if want := (profile{ID: 1, Name: "old", Bio: "", Rating: 5}); got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	entries := entriesAt(hook, logrus.DebugLevel)
+	if len(entries) == 0 {
+		t.Fatal("expected debug log of update")
+	}
+	skipped := entries[len(entries)-1].Data["updateSkippedColumns"]
+	if !reflect.DeepEqual(skipped, []string{"name", "rating"}) {
+		t.Fatalf("expected unwritten non zero columns logged, got %v", skipped)
+	}
+}
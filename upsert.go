@@ -0,0 +1,128 @@
+package builder
+
+import (
+	"fmt"
+	"reflect"
+
+	"gorm-logged/common"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UpsertBatch is gorm extension. Inserts values by batches of batchSize, rows conflicting by conflictColumns
+// update updateColumns instead. Returns counts of inserted and updated rows, which are told apart by xmax
+// of returned rows, so primary keys aren't set back into values. Batches are not wrapped into transaction,
+// on error counts of already upserted batches are returned and index of failed batch is logged
+func (m *Model) UpsertBatch(values interface{}, conflictColumns, updateColumns []string, batchSize int) (inserted, updated int64, err error) {
+	if err := m.requireDialect("UpsertBatch", dialectPostgres); err != nil {
+		return 0, 0, err
+	}
+	logFields := logrus.Fields{
+		"typeOfUpsertValues":    fmt.Sprintf("%T", values),
+		"upsertConflictColumns": conflictColumns,
+		"upsertUpdateColumns":   updateColumns,
+		"upsertBatchSize":       batchSize,
+	}
+	if _, ignoring := m.db.Statement.Clauses["ON CONFLICT"]; ignoring {
+		m.logError("queryBuilder.UpsertBatch called on chain with IgnoreConflicts", nil, logFields,
+			logrus.Fields{"trace": m.frames()})
+		return 0, 0, common.ErrInternal
+	}
+	rv := reflect.Indirect(reflect.ValueOf(values))
+	if rv.Kind() != reflect.Slice || batchSize <= 0 {
+		m.logError("queryBuilder.UpsertBatch called with values which are not a slice or with non positive batch size", nil,
+			logFields, logrus.Fields{"trace": m.frames()})
+		return 0, 0, common.ErrInternal
+	}
+
+	conflict := clause.OnConflict{DoUpdates: clause.AssignmentColumns(updateColumns)}
+	for _, column := range conflictColumns {
+		conflict.Columns = append(conflict.Columns, clause.Column{Name: column})
+	}
+	// xmax of row is zero unless the row is locked by update of this statement
+	returning := clause.Returning{Columns: []clause.Column{{Name: "xmax = 0", Raw: true}}}
+
+	for batch, start := 0, 0; start < rv.Len(); batch, start = batch+1, start+batchSize {
+		end := start + batchSize
+		if end > rv.Len() {
+			end = rv.Len()
+		}
+		q := m.startQuery("upsertBatch")
+		res, batchInserted := m.upsert(rv.Slice(start, end).Interface(), conflict, returning)
+		q.done(res)
+		if err := res.Error; err != nil {
+			m.tx.remember(err)
+			return inserted, updated, m.fail("upsertBatch", "can't upsert batch into database", err, m.sqlFields(res), logFields,
+				logrus.Fields{
+					"upsertBatchIndex": batch,
+					"upsertInserted":   inserted,
+					"upsertUpdated":    updated,
+					"trace":            m.frames(),
+				})
+		}
+		inserted += batchInserted
+		updated += res.RowsAffected - batchInserted
+	}
+	return inserted, updated, nil
+}
+
+// upsert builds upsert of batch by gorm and runs it on connection of chain, returns count of inserted rows.
+// gorm scans returned rows into batch only, so statement is executed directly to read the inserted flags.
+// Circuit breaker and audit, which are applied by gorm callbacks to other queries, are applied here to the executed statement
+func (m *Model) upsert(batch interface{}, conflict clause.OnConflict, returning clause.Returning) (*gorm.DB, int64) {
+	db := m.traced().Session(&gorm.Session{DryRun: true, SkipDefaultTransaction: true}).Clauses(conflict, returning).Create(batch)
+	if db.Error != nil {
+		return db, 0
+	}
+	var inserted int64
+	run := func(tx *gorm.DB) error {
+		var err error
+		if inserted, err = m.execUpsert(tx, db); err != nil || db.RowsAffected == 0 || m.cfg.audit == nil {
+			return err
+		}
+		return m.writeAudit(tx, db.Statement, "upsert")
+	}
+	conn := m.db.Session(&gorm.Session{NewDB: true, Context: db.Statement.Context})
+	var err error
+	if m.cfg.audit == nil {
+		err = run(conn)
+	} else {
+		// audit record is written in transaction of the upsert, as gorm does for other mutations
+		err = conn.Transaction(run)
+	}
+	if err != nil {
+		_ = db.AddError(err)
+		// sql is captured by callback for queries executed by gorm only
+		if q, ok := db.Statement.Context.Value(queryKey{}).(*tracedQuery); ok && q.sql == "" {
+			q.sql, q.vars = db.Statement.SQL.String(), redactVars(db.Statement, m.cfg.redactedFields)
+		}
+	}
+	return db, inserted
+}
+
+// execUpsert executes sql built by dry run db on connection of tx under circuit breaker of chain,
+// sets affected rows of db and returns count of inserted rows
+func (m *Model) execUpsert(tx, db *gorm.DB) (int64, error) {
+	if err := m.breakerAllow(); err != nil {
+		return 0, err
+	}
+	rows, err := tx.Statement.ConnPool.QueryContext(db.Statement.Context, db.Statement.SQL.String(), db.Statement.Vars...)
+	var inserted int64
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() && err == nil {
+			var isInserted bool
+			if err = rows.Scan(&isInserted); isInserted {
+				inserted++
+			}
+			db.RowsAffected++
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+	}
+	m.breakerRecord(err)
+	return inserted, err
+}
@@ -0,0 +1,86 @@
+package builder
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type upsertItem struct {
+	ID    int
+	Name  string `gorm:"unique"`
+	Price int
+}
+
+// badConnPool fails every query with broken connection
+type badConnPool struct {
+	gorm.ConnPool
+}
+
+func (badConnPool) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, driver.ErrBadConn
+}
+
+// upsertClauses returns clauses of upsert of items by name, sqlite has no xmax, so every row is reported as inserted
+func upsertClauses() (clause.OnConflict, clause.Returning) {
+	return clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoUpdates: clause.AssignmentColumns([]string{"price"})},
+		clause.Returning{Columns: []clause.Column{{Name: "1", Raw: true}}}
+}
+
+func TestUpsertIsAudited(t *testing.T) {
+	m := newTestModel(t, []Option{WithAudit("audit_records", nil)}, &upsertItem{})
+	if err := m.MigrateAudit(); err != nil {
+		t.Fatalf("can't migrate audit: %v", err)
+	}
+	conflict, returning := upsertClauses()
+	res, inserted := m.upsert([]upsertItem{{Name: "a", Price: 1}, {Name: "b", Price: 2}}, conflict, returning)
+	if res.Error != nil {
+		t.Fatalf("can't upsert: %v", res.Error)
+	}
+	if inserted != 2 || res.RowsAffected != 2 {
+		t.Fatalf("expected 2 inserted rows, got %d of %d", inserted, res.RowsAffected)
+	}
+
+	var records []AuditRecord
+	if err := m.db.Table("audit_records").Find(&records).Error; err != nil {
+		t.Fatalf("can't read audit records: %v", err)
+	}
+	if len(records) != 1 || records[0].Operation != "upsert" || records[0].Table != "upsert_items" {
+		t.Fatalf("expected single audit record of upsert, got %+v", records)
+	}
+}
+
+func TestUpsertIsRecordedByBreaker(t *testing.T) {
+	m, _ := newLoggedModel(t, []Option{WithCircuitBreaker(1, time.Millisecond)}, &upsertItem{})
+	m.cfg.breaker.state = breakerOpen
+	m.cfg.breaker.openedAt = time.Now().Add(-time.Second)
+	m.db.Statement.ConnPool = badConnPool{m.db.Statement.ConnPool}
+
+	conflict, returning := upsertClauses()
+	res, _ := m.upsert([]upsertItem{{Name: "a", Price: 1}}, conflict, returning)
+	if res.Error == nil {
+		t.Fatal("expected error of broken connection")
+	}
+	// probe failed by the real query opens breaker again, dry run building the query must not close it
+	if state := m.BreakerState(); state != breakerOpen {
+		t.Fatalf("expected open breaker after failed probe, got %s", state)
+	}
+}
+
+func TestDryRunIsIgnoredByBreaker(t *testing.T) {
+	m, _ := newLoggedModel(t, []Option{WithCircuitBreaker(1, time.Millisecond)}, &upsertItem{})
+	m.cfg.breaker.state = breakerOpen
+	m.cfg.breaker.openedAt = time.Now().Add(-time.Second)
+
+	if err := m.traced().Session(&gorm.Session{DryRun: true}).Create(&upsertItem{Name: "a"}).Error; err != nil {
+		t.Fatalf("can't build query: %v", err)
+	}
+	if state := m.BreakerState(); state != breakerOpen {
+		t.Fatalf("expected breaker untouched by dry run, got %s", state)
+	}
+}
@@ -0,0 +1,76 @@
+// Package zaplog adapts zap logger to builder.Logger, so importing zap stays optional
+package zaplog
+
+import (
+	"sort"
+
+	"gorm-logged/common"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Logger logs by zap, fields are passed as typed zap fields
+type Logger struct {
+	l *zap.Logger
+}
+
+// New wraps zap logger, result can be passed to builder.WithCustomLogger
+func New(l *zap.Logger) Logger {
+	return Logger{l: l}
+}
+
+func (l Logger) Error(msg string, fields map[string]interface{}) {
+	l.l.Error(msg, zapFields(fields)...)
+}
+
+func (l Logger) Warn(msg string, fields map[string]interface{}) {
+	l.l.Warn(msg, zapFields(fields)...)
+}
+
+func (l Logger) Debug(msg string, fields map[string]interface{}) {
+	l.l.Debug(msg, zapFields(fields)...)
+}
+
+// zapFields converts fields to zap fields sorted by key, calling frames are rendered as array of objects
+func zapFields(fields map[string]interface{}) []zap.Field {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	res := make([]zap.Field, 0, len(fields))
+	for _, key := range keys {
+		switch value := fields[key].(type) {
+		case common.LazyFrames:
+			res = append(res, zap.Array(key, frames(value.Frames())))
+		case error:
+			res = append(res, zap.NamedError(key, value))
+		default:
+			res = append(res, zap.Any(key, value))
+		}
+	}
+	return res
+}
+
+// frames renders calling frames as array of objects
+type frames []common.Frame
+
+func (f frames) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for _, frame := range f {
+		if err := enc.AppendObject(zapFrame(frame)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type zapFrame common.Frame
+
+func (f zapFrame) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("function", f.Function)
+	enc.AddString("file", f.File)
+	enc.AddInt("line", f.Line)
+	return nil
+}
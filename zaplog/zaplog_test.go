@@ -0,0 +1,59 @@
+package zaplog
+
+import (
+	"errors"
+	"testing"
+
+	"gorm-logged/common"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	l := New(zap.New(core))
+	failure := errors.New("failure")
+	l.Error("can't find", map[string]interface{}{
+		"trace":       common.CaptureFrames(0, 2),
+		"error":       failure,
+		"whereQuery0": "id = ?",
+	})
+	l.Warn("duplicate", nil)
+	l.Debug("query finished", map[string]interface{}{"rowsAffected": int64(1)})
+
+	entries := logs.AllUntimed()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	levels := []zapcore.Level{zapcore.ErrorLevel, zapcore.WarnLevel, zapcore.DebugLevel}
+	for i, e := range entries {
+		if e.Level != levels[i] {
+			t.Errorf("entry %q is logged at %v instead of %v", e.Message, e.Level, levels[i])
+		}
+	}
+
+	fields := entries[0].Context
+	if len(fields) != 3 {
+		t.Fatalf("expected 3 fields, got %d", len(fields))
+	}
+	// fields are sorted by key
+	if fields[0].Key != "error" || fields[0].Type != zapcore.ErrorType || fields[0].Interface != failure {
+		t.Errorf("error isn't logged as error field: %+v", fields[0])
+	}
+	if fields[1].Key != "trace" || fields[1].Type != zapcore.ArrayMarshalerType {
+		t.Errorf("frames aren't logged as array: %+v", fields[1])
+	}
+	if fields[2].Key != "whereQuery0" || fields[2].String != "id = ?" {
+		t.Errorf("unexpected field %+v", fields[2])
+	}
+
+	frames := entries[0].ContextMap()["trace"].([]interface{})
+	if len(frames) == 0 {
+		t.Fatal("no frames are logged")
+	}
+	if frame := frames[0].(map[string]interface{}); frame["function"] != "gorm-logged/zaplog.TestLogger" || frame["line"] == 0 {
+		t.Errorf("unexpected frame %v", frame)
+	}
+}